@@ -15,6 +15,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/ericstrs/zet/internal/markdown"
 	"github.com/ericstrs/zet/internal/meta"
 	"github.com/ericstrs/zet/internal/storage"
 )
@@ -281,12 +282,12 @@ func constructZettel(s *storage.Storage, link string) (string, error) {
 		return "", fmt.Errorf("Failed to create transaction: %v\n", err)
 	}
 
-	matches := linkRegex.FindStringSubmatch(link)
-	if len(matches) <= 1 {
+	lines := markdown.Parse(link)
+	if len(lines) == 0 || len(lines[0].Refs) == 0 {
 		return "", nil
 	}
 
-	iso := matches[2]
+	iso := lines[0].Refs[0].ISO
 	id, err := storage.ZettelIdDir(tx, iso)
 	if err != nil {
 		return "", nil
@@ -8,17 +8,29 @@ Usage:
 
 Commands:
 
-	add     - Adds a new zettel with the given title and content.
-	search  - Searches for zettels given a query string.
-	split   - Splits up a given zettel into sub-zettels.
-	content - Prints different sections of zettel content.
-	merge   - Merges linked notes to form a single note.
-	list    - Lists all existing zettels.
-	link    - Prints the link of a zettel.
-	isosec  - Prints the current ISO date to the millisecond.
-	commit  - Performs a git commit using zettel's title.
-	config  - Displays configuration directory path.
-	related - Prints related zettel links for a given zettel.
+	add       - Adds a new zettel with the given title and content.
+	rm        - Moves a zettel to the trash.
+	trash     - Lists and restores removed zettels.
+	mv        - Renames a zettel and rewrites the links to it.
+	retitle   - Changes the title of a zettel and the links to it.
+	links     - Maintains the links between zettels.
+	tags      - Lists, renames, merges and removes tags.
+	search    - Searches for zettels given a query string.
+	split     - Splits up a given zettel into sub-zettels.
+	content   - Prints different sections of zettel content.
+	merge     - Merges linked notes to form a single note.
+	list      - Lists all existing zettels.
+	link      - Prints the link of a zettel.
+	isosec    - Prints the current ISO date to the millisecond.
+	commit    - Performs a git commit using zettel's title.
+	config    - Displays configuration directory path.
+	related   - Prints related zettel links for a given zettel.
+	backlinks - Prints links to a zettel from other zettels.
+	watch     - Keeps the database in sync with the zet directory.
+	check     - Reports broken links between zettels.
+	graph     - Exports and analyses the graph of links between zettels.
+	db        - Manages the zet database schema.
+	doctor    - Checks the database for problems and repairs them.
 
 Appending "help" after any command will print command info.
 */
@@ -39,17 +51,29 @@ const usage = `USAGE
 
 COMMANDS
 
-	add, a  - Adds a new zettel with the given title and content.
-	search  - Searches for zettels given a query string.
-	split   - Splits up a given zettel into sub-zettels.
-	content - Prints different sections of zettel content.
-	merge   - Merges linked notes to form a single note.
-	list    - Lists all existing zettels.
-	link, l - Prints the link of a zettel.
-	isosec  - Prints the current ISO date to the millisecond.
-	commit  - Performs a git commit using zettel's title.
-	config  - Displays configuration directory path.
-	related - Prints related zettel links for a given zettel.
+	add, a    - Adds a new zettel with the given title and content.
+	rm        - Moves a zettel to the trash.
+	trash     - Lists and restores removed zettels.
+	mv        - Renames a zettel and rewrites the links to it.
+	retitle   - Changes the title of a zettel and the links to it.
+	links     - Maintains the links between zettels.
+	tags      - Lists, renames, merges and removes tags.
+	search    - Searches for zettels given a query string.
+	split     - Splits up a given zettel into sub-zettels.
+	content   - Prints different sections of zettel content.
+	merge     - Merges linked notes to form a single note.
+	list      - Lists all existing zettels.
+	link, l   - Prints the link of a zettel.
+	isosec    - Prints the current ISO date to the millisecond.
+	commit    - Performs a git commit using zettel's title.
+	config    - Displays configuration directory path.
+	related   - Prints related zettel links for a given zettel.
+	backlinks - Prints links to a zettel from other zettels.
+	watch     - Keeps the database in sync with the zet directory.
+	check     - Reports broken links between zettels.
+	graph     - Exports and analyses the graph of links between zettels.
+	db        - Manages the zet database schema.
+	doctor    - Checks the database for problems and repairs them.
 
 DESCRIPTION
 
@@ -64,6 +88,7 @@ DESCRIPTION
 func main() {
 	if err := Run(); err != nil {
 		log.Println(err)
+		os.Exit(1)
 	}
 }
 
@@ -82,6 +107,30 @@ func Run() error {
 		if err := ui.AddCmd(args); err != nil {
 			return fmt.Errorf("Failed to add a zettel: %v", err)
 		}
+	case `rm`: // move a zettel to the trash
+		if err := ui.RmCmd(args); err != nil {
+			return fmt.Errorf("Failed to remove zettel: %v", err)
+		}
+	case `mv`: // rename a zettel
+		if err := ui.MvCmd(args); err != nil {
+			return fmt.Errorf("Failed to move zettel: %v", err)
+		}
+	case `retitle`:
+		if err := ui.RetitleCmd(args); err != nil {
+			return fmt.Errorf("Failed to retitle zettel: %v", err)
+		}
+	case `links`:
+		if err := ui.LinksCmd(args); err != nil {
+			return fmt.Errorf("Error refreshing links: %v", err)
+		}
+	case `tags`:
+		if err := ui.TagsCmd(args); err != nil {
+			return fmt.Errorf("Error managing tags: %v", err)
+		}
+	case `trash`:
+		if err := ui.TrashCmd(args); err != nil {
+			return fmt.Errorf("Error managing trash: %v", err)
+		}
 	case `link`, `l`: // get zettel link
 		if err := ui.LinkCmd(args); err != nil {
 			return fmt.Errorf("Failed to retrieve zettel link: %v", err)
@@ -120,6 +169,30 @@ func Run() error {
 		if err := ui.RelatedCmd(args); err != nil {
 			return fmt.Errorf("Failed to retrieve related zettels: %v", err)
 		}
+	case `watch`:
+		if err := ui.WatchCmd(args); err != nil {
+			return fmt.Errorf("Error watching zet directory: %v", err)
+		}
+	case `check`:
+		if err := ui.CheckCmd(args); err != nil {
+			return fmt.Errorf("Error checking zettels: %v", err)
+		}
+	case `backlinks`, `bl`:
+		if err := ui.BacklinksCmd(args); err != nil {
+			return fmt.Errorf("Failed to retrieve backlinks: %v", err)
+		}
+	case `graph`:
+		if err := ui.GraphCmd(args); err != nil {
+			return fmt.Errorf("Error building zettel graph: %v", err)
+		}
+	case `doctor`:
+		if err := ui.DoctorCmd(args); err != nil {
+			return fmt.Errorf("Error checking database: %v", err)
+		}
+	case `db`:
+		if err := ui.DBCmd(args); err != nil {
+			return fmt.Errorf("Error managing database: %v", err)
+		}
 	case `help`:
 		fmt.Printf(usage)
 	default:
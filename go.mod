@@ -6,6 +6,7 @@ toolchain go1.24.1
 
 require (
 	github.com/blevesearch/bleve/v2 v2.5.0
+	github.com/fsnotify/fsnotify v1.7.0
 	github.com/gdamore/tcell/v2 v2.6.0
 	github.com/jmoiron/sqlx v1.3.5
 	github.com/rivo/tview v0.0.0-20231102183219-1b91b8131c43
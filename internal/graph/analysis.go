@@ -0,0 +1,140 @@
+package graph
+
+import (
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Ranked is a node paired with a score used to rank it.
+type Ranked struct {
+	Node
+	Score float64
+}
+
+// Orphans returns the zettels that have no incoming or outgoing links.
+// Links from a zettel to itself are ignored.
+func (g *Graph) Orphans() []Node {
+	linked := make(map[string]bool)
+	for _, e := range g.Edges {
+		if e.From == e.To {
+			continue
+		}
+		linked[e.From] = true
+		linked[e.To] = true
+	}
+	var orphans []Node
+	for _, n := range g.Nodes {
+		if !linked[n.Key] {
+			orphans = append(orphans, n)
+		}
+	}
+	return orphans
+}
+
+// Degree ranks zettels by the number of distinct zettels they link to
+// or are linked from, highest first.
+func (g *Graph) Degree() []Ranked {
+	adj := g.adjacency(false)
+	deg := make(map[string]float64, len(g.Nodes))
+	for k, neighbours := range adj {
+		deg[k] = float64(len(neighbours))
+	}
+	return g.rank(deg)
+}
+
+// PageRank ranks zettels by their PageRank, highest first. Zettels
+// without outgoing links spread their rank evenly over all zettels.
+func (g *Graph) PageRank() []Ranked {
+	const (
+		damping   = 0.85
+		maxIter   = 100
+		tolerance = 1e-9
+	)
+	n := float64(len(g.Nodes))
+	if n == 0 {
+		return nil
+	}
+	adj := g.adjacency(true)
+	rank := make(map[string]float64, len(g.Nodes))
+	for _, node := range g.Nodes {
+		rank[node.Key] = 1 / n
+	}
+
+	for i := 0; i < maxIter; i++ {
+		var dangling float64
+		for _, node := range g.Nodes {
+			if len(adj[node.Key]) == 0 {
+				dangling += rank[node.Key]
+			}
+		}
+		next := make(map[string]float64, len(g.Nodes))
+		base := (1-damping)/n + damping*dangling/n
+		for _, node := range g.Nodes {
+			next[node.Key] += base
+			outs := adj[node.Key]
+			for _, to := range outs {
+				next[to] += damping * rank[node.Key] / float64(len(outs))
+			}
+		}
+		var diff float64
+		for k, v := range next {
+			diff += math.Abs(v - rank[k])
+		}
+		rank = next
+		if diff < tolerance {
+			break
+		}
+	}
+	return g.rank(rank)
+}
+
+// rank returns every node with its score, sorted by score and then by
+// key.
+func (g *Graph) rank(scores map[string]float64) []Ranked {
+	ranked := make([]Ranked, 0, len(g.Nodes))
+	for _, n := range g.Nodes {
+		ranked = append(ranked, Ranked{Node: n, Score: scores[n.Key]})
+	}
+	sort.SliceStable(ranked, func(i, j int) bool {
+		return ranked[i].Score > ranked[j].Score
+	})
+	return ranked
+}
+
+// ShortestPath returns the shortest chain of zettels linking the zettel
+// with key from to the zettel with key to, both included. If directed
+// is false, links may be followed backwards.
+func (g *Graph) ShortestPath(from, to string, directed bool) ([]Node, error) {
+	if _, ok := g.node(from); !ok {
+		return nil, fmt.Errorf("zettel %s not found", from)
+	}
+	if _, ok := g.node(to); !ok {
+		return nil, fmt.Errorf("zettel %s not found", to)
+	}
+
+	adj := g.adjacency(directed)
+	prev := map[string]string{from: ""}
+	queue := []string{from}
+	for len(queue) > 0 && prev[to] == "" && from != to {
+		curr := queue[0]
+		queue = queue[1:]
+		for _, next := range adj[curr] {
+			if _, seen := prev[next]; seen {
+				continue
+			}
+			prev[next] = curr
+			queue = append(queue, next)
+		}
+	}
+	if _, ok := prev[to]; !ok {
+		return nil, fmt.Errorf("no path from %s to %s", from, to)
+	}
+
+	var path []Node
+	for k := to; k != ""; k = prev[k] {
+		n, _ := g.node(k)
+		path = append([]Node{n}, path...)
+	}
+	return path, nil
+}
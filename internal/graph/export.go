@@ -0,0 +1,152 @@
+package graph
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"strings"
+)
+
+// Formats lists the supported export formats.
+var Formats = []string{`dot`, `graphml`, `json`}
+
+// Export writes the graph to w in the given format.
+func (g *Graph) Export(w io.Writer, format string) error {
+	switch strings.ToLower(format) {
+	case `dot`:
+		return g.WriteDOT(w)
+	case `graphml`:
+		return g.WriteGraphML(w)
+	case `json`:
+		return g.WriteJSON(w)
+	default:
+		return fmt.Errorf("unknown format %q, expected one of: %s", format, strings.Join(Formats, ", "))
+	}
+}
+
+// edgeStyles maps link types to the DOT style of their edges, so weak
+// relations stand out from references made in the text.
+var edgeStyles = map[string]string{
+	`inline`:   `solid`,
+	`footnote`: `dotted`,
+	`see-also`: `dashed`,
+}
+
+// WriteDOT writes the graph in the Graphviz DOT language. Edges carry
+// the type of their link and are styled after it.
+func (g *Graph) WriteDOT(w io.Writer) error {
+	var b strings.Builder
+	b.WriteString("digraph zet {\n")
+	for _, n := range g.Nodes {
+		fmt.Fprintf(&b, "  %s [label=%s];\n", dotQuote(n.Key), dotQuote(n.Title))
+	}
+	for _, e := range g.Edges {
+		if style, ok := edgeStyles[e.Type]; ok {
+			fmt.Fprintf(&b, "  %s -> %s [type=%s, style=%s];\n", dotQuote(e.From), dotQuote(e.To), dotQuote(e.Type), style)
+			continue
+		}
+		fmt.Fprintf(&b, "  %s -> %s;\n", dotQuote(e.From), dotQuote(e.To))
+	}
+	b.WriteString("}\n")
+	_, err := io.WriteString(w, b.String())
+	return err
+}
+
+// dotQuote returns s as a quoted DOT identifier.
+func dotQuote(s string) string {
+	s = strings.ReplaceAll(s, `\`, `\\`)
+	s = strings.ReplaceAll(s, `"`, `\"`)
+	return `"` + s + `"`
+}
+
+// WriteGraphML writes the graph as a GraphML document.
+func (g *Graph) WriteGraphML(w io.Writer) error {
+	type data struct {
+		Key   string `xml:"key,attr"`
+		Value string `xml:",chardata"`
+	}
+	type node struct {
+		ID   string `xml:"id,attr"`
+		Data []data `xml:"data"`
+	}
+	type edge struct {
+		Source string `xml:"source,attr"`
+		Target string `xml:"target,attr"`
+		Data   []data `xml:"data"`
+	}
+	type key struct {
+		ID       string `xml:"id,attr"`
+		For      string `xml:"for,attr"`
+		AttrName string `xml:"attr.name,attr"`
+		AttrType string `xml:"attr.type,attr"`
+	}
+	type graph struct {
+		ID          string `xml:"id,attr"`
+		EdgeDefault string `xml:"edgedefault,attr"`
+		Nodes       []node `xml:"node"`
+		Edges       []edge `xml:"edge"`
+	}
+	type graphML struct {
+		XMLName xml.Name `xml:"graphml"`
+		XMLNS   string   `xml:"xmlns,attr"`
+		Keys    []key    `xml:"key"`
+		Graph   graph    `xml:"graph"`
+	}
+
+	doc := graphML{
+		XMLNS: "http://graphml.graphdrawing.org/xmlns",
+		Keys: []key{
+			{ID: "title", For: "node", AttrName: "title", AttrType: "string"},
+			{ID: "tags", For: "node", AttrName: "tags", AttrType: "string"},
+			{ID: "type", For: "edge", AttrName: "type", AttrType: "string"},
+			{ID: "context", For: "edge", AttrName: "context", AttrType: "string"},
+		},
+		Graph: graph{ID: "zet", EdgeDefault: "directed"},
+	}
+	for _, n := range g.Nodes {
+		doc.Graph.Nodes = append(doc.Graph.Nodes, node{
+			ID: n.Key,
+			Data: []data{
+				{Key: "title", Value: n.Title},
+				{Key: "tags", Value: strings.Join(n.Tags, " ")},
+			},
+		})
+	}
+	for _, e := range g.Edges {
+		doc.Graph.Edges = append(doc.Graph.Edges, edge{
+			Source: e.From,
+			Target: e.To,
+			Data: []data{
+				{Key: "type", Value: e.Type},
+				{Key: "context", Value: e.Context},
+			},
+		})
+	}
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	enc := xml.NewEncoder(w)
+	enc.Indent("", "  ")
+	if err := enc.Encode(doc); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// WriteJSON writes the graph as a JSON object with a list of nodes and
+// a list of edges.
+func (g *Graph) WriteJSON(w io.Writer) error {
+	out := *g
+	if out.Nodes == nil {
+		out.Nodes = []Node{}
+	}
+	if out.Edges == nil {
+		out.Edges = []Edge{}
+	}
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	return enc.Encode(out)
+}
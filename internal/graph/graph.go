@@ -0,0 +1,211 @@
+// Package graph provides the zettel link graph built from the zet
+// database, along with ways to narrow it down and export it.
+package graph
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/ericstrs/zet/internal/storage"
+)
+
+// Node is a single zettel in the graph.
+type Node struct {
+	ID    int      `json:"-"`     // zettel id
+	Key   string   `json:"id"`    // unique key, the isosec for README.md files
+	Dir   string   `json:"dir"`   // zettel directory name
+	Name  string   `json:"name"`  // file name
+	Title string   `json:"title"` // zettel title
+	Tags  []string `json:"tags"`  // zettel tags
+}
+
+// Edge is a link from one zettel to another.
+type Edge struct {
+	From    string `json:"from"`    // key of the zettel the link lives in
+	To      string `json:"to"`      // key of the zettel the link points to
+	Content string `json:"content"` // zettel link
+	Type    string `json:"type"`    // inline, footnote or see-also
+	Context string `json:"context"` // sentence or entry the link is in
+}
+
+// Graph is a directed graph of zettels and the links between them.
+// Nodes and edges are kept sorted by key.
+type Graph struct {
+	Nodes []Node `json:"nodes"`
+	Edges []Edge `json:"edges"`
+}
+
+// Load builds the graph of every zettel and link in the database.
+func Load(s *storage.Storage) (*Graph, error) {
+	zettels, err := s.ZettelSummaries(`dir_name ASC, name ASC`)
+	if err != nil {
+		return nil, err
+	}
+	tags, err := s.ZettelTags()
+	if err != nil {
+		return nil, err
+	}
+	links, err := s.AllLinks()
+	if err != nil {
+		return nil, err
+	}
+
+	g := &Graph{}
+	keys := make(map[int]string, len(zettels))
+	for _, z := range zettels {
+		n := Node{
+			ID:    z.ID,
+			Key:   key(z.DirName, z.Name),
+			Dir:   z.DirName,
+			Name:  z.Name,
+			Title: z.Title,
+			Tags:  tags[z.ID],
+		}
+		if n.Tags == nil {
+			n.Tags = []string{}
+		}
+		keys[z.ID] = n.Key
+		g.Nodes = append(g.Nodes, n)
+	}
+	for _, l := range links {
+		from, ok := keys[l.FromZettelID]
+		if !ok {
+			continue
+		}
+		to, ok := keys[l.ToZettelID]
+		if !ok {
+			continue
+		}
+		g.Edges = append(g.Edges, Edge{From: from, To: to, Content: l.Content, Type: l.Type, Context: l.Context})
+	}
+	g.sort()
+	return g, nil
+}
+
+// key returns the node key for a zettel file. README.md files are
+// identified by their directory name alone since that is what links
+// refer to.
+func key(dir, name string) string {
+	if name == `README.md` {
+		return dir
+	}
+	return dir + "/" + name
+}
+
+// sort orders nodes and edges by key.
+func (g *Graph) sort() {
+	sort.Slice(g.Nodes, func(i, j int) bool {
+		return g.Nodes[i].Key < g.Nodes[j].Key
+	})
+	sort.SliceStable(g.Edges, func(i, j int) bool {
+		if g.Edges[i].From != g.Edges[j].From {
+			return g.Edges[i].From < g.Edges[j].From
+		}
+		return g.Edges[i].To < g.Edges[j].To
+	})
+}
+
+// Subgraph returns the graph induced by the nodes keep reports true
+// for. Only edges between kept nodes remain.
+func (g *Graph) Subgraph(keep func(Node) bool) *Graph {
+	sg := &Graph{}
+	kept := make(map[string]bool)
+	for _, n := range g.Nodes {
+		if keep(n) {
+			sg.Nodes = append(sg.Nodes, n)
+			kept[n.Key] = true
+		}
+	}
+	for _, e := range g.Edges {
+		if kept[e.From] && kept[e.To] {
+			sg.Edges = append(sg.Edges, e)
+		}
+	}
+	return sg
+}
+
+// WithTag returns the subgraph of zettels tagged with tag.
+func (g *Graph) WithTag(tag string) *Graph {
+	return g.Subgraph(func(n Node) bool {
+		for _, t := range n.Tags {
+			if t == tag {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Between returns the subgraph of zettels created within a date range.
+// The start and end dates should be in YYYYMMDD format.
+func (g *Graph) Between(start, end string) *Graph {
+	// Pad dates to match dir name format (YYYYMMDDHHmmss)
+	startISO := start + "000000"
+	endISO := end + "235959"
+	return g.Subgraph(func(n Node) bool {
+		return n.Dir >= startISO && n.Dir <= endISO
+	})
+}
+
+// Neighbourhood returns the subgraph of zettels at most hops links away
+// from the zettel with the given key. Links are followed in both
+// directions.
+func (g *Graph) Neighbourhood(k string, hops int) (*Graph, error) {
+	if _, ok := g.node(k); !ok {
+		return nil, fmt.Errorf("zettel %s not found", k)
+	}
+	adj := g.adjacency(false)
+	dist := map[string]int{k: 0}
+	queue := []string{k}
+	for len(queue) > 0 {
+		curr := queue[0]
+		queue = queue[1:]
+		if dist[curr] == hops {
+			continue
+		}
+		for _, next := range adj[curr] {
+			if _, seen := dist[next]; seen {
+				continue
+			}
+			dist[next] = dist[curr] + 1
+			queue = append(queue, next)
+		}
+	}
+	return g.Subgraph(func(n Node) bool {
+		_, ok := dist[n.Key]
+		return ok
+	}), nil
+}
+
+// node returns the node with the given key.
+func (g *Graph) node(k string) (Node, bool) {
+	i := sort.Search(len(g.Nodes), func(i int) bool {
+		return g.Nodes[i].Key >= k
+	})
+	if i < len(g.Nodes) && g.Nodes[i].Key == k {
+		return g.Nodes[i], true
+	}
+	return Node{}, false
+}
+
+// adjacency returns the keys of the nodes each node links to. If
+// directed is false, links are followed in both directions. Self links
+// and duplicate links are dropped.
+func (g *Graph) adjacency(directed bool) map[string][]string {
+	adj := make(map[string][]string, len(g.Nodes))
+	seen := make(map[[2]string]bool)
+	add := func(from, to string) {
+		if from == to || seen[[2]string{from, to}] {
+			return
+		}
+		seen[[2]string{from, to}] = true
+		adj[from] = append(adj[from], to)
+	}
+	for _, e := range g.Edges {
+		add(e.From, e.To)
+		if !directed {
+			add(e.To, e.From)
+		}
+	}
+	return adj
+}
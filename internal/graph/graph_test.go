@@ -0,0 +1,146 @@
+package graph
+
+import (
+	"fmt"
+	"os"
+)
+
+func testGraph() *Graph {
+	g := &Graph{
+		Nodes: []Node{
+			{Key: "20231028012959", Dir: "20231028012959", Title: "A", Tags: []string{"go"}},
+			{Key: "20231028013010", Dir: "20231028013010", Title: "B", Tags: []string{"go", "draft"}},
+			{Key: "20231028013031", Dir: "20231028013031", Title: "C \"quoted\""},
+			{Key: "20240108034433", Dir: "20240108034433", Title: "D"},
+			{Key: "20240108034500", Dir: "20240108034500", Title: "E"},
+		},
+		Edges: []Edge{
+			{From: "20231028012959", To: "20231028013010", Type: "inline"},
+			{From: "20231028013010", To: "20231028013031", Type: "see-also"},
+			{From: "20240108034433", To: "20231028013031"},
+		},
+	}
+	g.sort()
+	return g
+}
+
+func ExampleGraph_WriteDOT() {
+	g := testGraph().WithTag("go")
+	g.WriteDOT(os.Stdout)
+
+	// Output:
+	// digraph zet {
+	//   "20231028012959" [label="A"];
+	//   "20231028013010" [label="B"];
+	//   "20231028012959" -> "20231028013010" [type="inline", style=solid];
+	// }
+}
+
+func ExampleGraph_Neighbourhood() {
+	g, err := testGraph().Neighbourhood("20231028013031", 1)
+	if err != nil {
+		return
+	}
+	g.WriteDOT(os.Stdout)
+
+	// Output:
+	// digraph zet {
+	//   "20231028013010" [label="B"];
+	//   "20231028013031" [label="C \"quoted\""];
+	//   "20240108034433" [label="D"];
+	//   "20231028013010" -> "20231028013031" [type="see-also", style=dashed];
+	//   "20240108034433" -> "20231028013031";
+	// }
+}
+
+func ExampleGraph_Between() {
+	g := testGraph().Between("20240101", "20241231")
+	g.WriteJSON(os.Stdout)
+
+	// Output:
+	// {
+	//   "nodes": [
+	//     {
+	//       "id": "20240108034433",
+	//       "dir": "20240108034433",
+	//       "name": "",
+	//       "title": "D",
+	//       "tags": null
+	//     },
+	//     {
+	//       "id": "20240108034500",
+	//       "dir": "20240108034500",
+	//       "name": "",
+	//       "title": "E",
+	//       "tags": null
+	//     }
+	//   ],
+	//   "edges": []
+	// }
+}
+
+func ExampleGraph_Orphans() {
+	for _, n := range testGraph().Orphans() {
+		fmt.Println(n.Key, n.Title)
+	}
+
+	// Output:
+	// 20240108034500 E
+}
+
+func ExampleGraph_Degree() {
+	g := testGraph()
+	// A link back counts the same zettel again, so it changes nothing.
+	g.Edges = append(g.Edges, Edge{From: "20231028013010", To: "20231028012959"})
+	for _, r := range g.Degree() {
+		fmt.Printf("%.0f %s\n", r.Score, r.Key)
+	}
+
+	// Output:
+	// 2 20231028013010
+	// 2 20231028013031
+	// 1 20231028012959
+	// 1 20240108034433
+	// 0 20240108034500
+}
+
+func ExampleGraph_PageRank() {
+	ranked := testGraph().PageRank()
+	var sum float64
+	for _, r := range ranked {
+		sum += r.Score
+	}
+	fmt.Printf("top: %s sum: %.4f\n", ranked[0].Key, sum)
+
+	// Output:
+	// top: 20231028013031 sum: 1.0000
+}
+
+func ExampleGraph_ShortestPath() {
+	g := testGraph()
+	path, err := g.ShortestPath("20231028012959", "20231028013031", true)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, n := range path {
+		fmt.Println(n.Key)
+	}
+
+	_, err = g.ShortestPath("20231028012959", "20240108034433", true)
+	fmt.Println(err)
+
+	path, err = g.ShortestPath("20231028012959", "20240108034433", false)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println(len(path), "zettels")
+
+	// Output:
+	// 20231028012959
+	// 20231028013010
+	// 20231028013031
+	// no path from 20231028012959 to 20240108034433
+	// 4 zettels
+}
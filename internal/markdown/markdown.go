@@ -0,0 +1,494 @@
+// Package markdown splits zettel content into lines of known kinds. It
+// understands just enough Markdown to tell zettel structure, such as
+// the title, links and tag lines, apart from code that looks like it.
+package markdown
+
+import (
+	"regexp"
+	"sort"
+	"strings"
+)
+
+// Kind is the kind of a line of zettel content.
+type Kind int
+
+const (
+	Text        Kind = iota // body text, including blank lines
+	FrontMatter             // line of the front matter block, including delimiters
+	Title                   // title, the first `# ` heading
+	Heading                 // any other ATX heading
+	Fence                   // opening or closing line of a fenced code block
+	Code                    // line inside a fenced or indented code block
+	Link                    // link line, a line given over to a zettel link
+	Tags                    // tag line, e.g. `    #pkms #productivity`
+)
+
+func (k Kind) String() string {
+	switch k {
+	case FrontMatter:
+		return "front matter"
+	case Title:
+		return "title"
+	case Heading:
+		return "heading"
+	case Fence:
+		return "fence"
+	case Code:
+		return "code"
+	case Link:
+		return "link"
+	case Tags:
+		return "tags"
+	}
+	return "text"
+}
+
+// Line is a line of zettel content.
+type Line struct {
+	Num   int    // line number, starting at one
+	Text  string // content of the line
+	Kind  Kind   // what the line holds
+	Level int    // heading level of Title and Heading lines
+
+	// Link is the zettel link of a Link line, e.g.
+	// `[20231028012959](../20231028012959) Title`, ISO is the
+	// directory name it is labeled with and Anchor is the section it
+	// points to, if any.
+	Link   string
+	ISO    string
+	Anchor string
+
+	// Refs holds every zettel link on the line, in the order written.
+	// Lines of code have none.
+	Refs []Ref
+}
+
+// Kinds of zettel links.
+const (
+	LinkLine   = "line"   // link line, e.g. `* [iso](../iso) title`
+	LinkWiki   = "wiki"   // wiki link, e.g. `[[iso]]` or `[[iso|label]]`
+	LinkInline = "inline" // Markdown link within text, e.g. `[label](../iso)`
+)
+
+// Types of zettel links, which tell a reference made in the text from
+// a looser relation.
+const (
+	TypeInline   = "inline"   // reference within a sentence
+	TypeFootnote = "footnote" // footnote, e.g. `[^r]: [iso](../iso) title`
+	TypeSeeAlso  = "see-also" // entry of a list of related zettels
+)
+
+// Ref is a link to a zettel.
+type Ref struct {
+	Kind    string // LinkLine, LinkWiki or LinkInline
+	Type    string // TypeInline, TypeFootnote or TypeSeeAlso
+	Content string // link as written
+	ISO     string // directory name the link points to
+	Anchor  string // anchor of the section the link points to, if any
+	Label   string // text shown for the link, if any
+	Col     int    // column the link starts at, starting at one
+	Context string // sentence or list entry the link is found in
+}
+
+const (
+	// frontMatterDelim opens and closes a front matter block, which may
+	// also be closed by frontMatterEnd.
+	frontMatterDelim = `---`
+	frontMatterEnd   = `...`
+	// titlePrefix starts the title of a zettel.
+	titlePrefix = `# `
+)
+
+var (
+	// headingRegex matches an ATX heading.
+	headingRegex = regexp.MustCompile(`^ {0,3}(#{1,6})(?:[ \t]|$)`)
+	// fenceRegex matches the opening line of a fenced code block.
+	fenceRegex = regexp.MustCompile("^ {0,3}(`{3,}|~{3,})")
+	// indentRegex matches a line indented enough to be indented code.
+	indentRegex = regexp.MustCompile(`^(?: {4}| {0,3}\t)`)
+	// tagLineRegex matches an indented line that starts with a hashtag
+	// and holds nothing but hashtags and plain words.
+	tagLineRegex = regexp.MustCompile(`^ {4,}#[a-zA-Z][^\s#]*(?:\s+(?:#[a-zA-Z][^\s#]*|[a-zA-Z]+))*\s*$`)
+	// linkRegex matches a zettel link, e.g. `[dir](../dir) title`.
+	linkRegex = regexp.MustCompile(`^.*(\[(.+)\]\(\.\./(.*?)/?\) (.+))`)
+	// wikiLinkRegex matches a wiki link, e.g. `[[iso]]` or
+	// `[[iso|label]]`.
+	wikiLinkRegex = regexp.MustCompile(`\[\[([^\[\]|]+?)(?:\|([^\[\]]*))?\]\]`)
+	// wikiLineRegex matches a line given over to a wiki link, e.g.
+	// `* [[iso]]`.
+	wikiLineRegex = regexp.MustCompile(`^\s*(?:[*+-]\s+)?(\[\[([^\[\]|]+?)(?:\|[^\[\]]*)?\]\])\s*$`)
+	// inlineLinkRegex matches a Markdown link to a zettel, e.g.
+	// `[label](../iso)` or `[label](../iso#anchor)`. Images are matched
+	// too so they can be skipped.
+	inlineLinkRegex = regexp.MustCompile(`(!?)\[([^\[\]]*)\]\(\.\./([^/()\s#]+)/?(?:#([^()\s]*))?\)`)
+	// codeSpanRegex matches an inline code span.
+	codeSpanRegex = regexp.MustCompile("`+[^`]*`+")
+	// footnoteDefRegex matches the start of a footnote definition, e.g.
+	// `[^r]: `.
+	footnoteDefRegex = regexp.MustCompile(`^ {0,3}\[\^([^\]\s]+)\]:\s*`)
+	// footnoteRefRegex matches a reference to a footnote, e.g. `[^r]`.
+	footnoteRefRegex = regexp.MustCompile(`\[\^([^\]\s]+)\]`)
+	// listItemRegex matches the marker of a list item, e.g. `* ` or
+	// `1. `.
+	listItemRegex = regexp.MustCompile(`^\s*(?:[*+-]|\d+[.)])\s+`)
+)
+
+// FrontMatterLen returns the number of lines taken up by the front
+// matter block at the top of lines, including its delimiters, or zero
+// if there is none. The block starts with a `---` line and ends with a
+// `---` or `...` line.
+func FrontMatterLen(lines []string) int {
+	if len(lines) == 0 || strings.TrimRight(lines[0], " \r") != frontMatterDelim {
+		return 0
+	}
+	for i := 1; i < len(lines); i++ {
+		l := strings.TrimRight(lines[i], " \r")
+		if l == frontMatterDelim || l == frontMatterEnd {
+			return i + 1
+		}
+	}
+	// Without a closing delimiter it is not front matter.
+	return 0
+}
+
+// Parse splits content into lines and tells what each one holds. Lines
+// are split the way bufio.ScanLines does, so a final newline doesn't
+// start another line and carriage returns are dropped.
+//
+// Headings, links and tag lines inside code blocks are code. A tag line
+// is an indented line that starts with a hashtag and holds nothing but
+// hashtags and plain words. Indented lines are looked at in chunks
+// separated by blank lines, and a chunk is only made of tag lines if
+// every line in it is one, so code such as `    #include <stdio.h>` or
+// a `#define` within a block of code is not mistaken for tags.
+func Parse(content string) []Line {
+	if content == "" {
+		return nil
+	}
+	texts := strings.Split(strings.TrimSuffix(content, "\n"), "\n")
+	for i, t := range texts {
+		texts[i] = strings.TrimSuffix(t, "\r")
+	}
+	lines := make([]Line, len(texts))
+	fm := FrontMatterLen(texts)
+
+	var fence string  // fence of the open code block, if any
+	indented := false // inside an indented code block
+	// Indented code can't continue a paragraph or list item, so it only
+	// starts after a blank line, a heading or a code block.
+	codeMayStart := true
+	hasTitle := false
+	tagsUntil := 0 // end of the chunk of tag lines being read
+	for i, t := range texts {
+		l := Line{Num: i + 1, Text: t}
+		blank := strings.TrimSpace(t) == ""
+
+		switch {
+		case i < fm:
+			l.Kind = FrontMatter
+		case fence != "":
+			l.Kind = Code
+			if closesFence(t, fence) {
+				l.Kind = Fence
+				fence = ""
+			}
+		case fenceRegex.MatchString(t):
+			l.Kind = Fence
+			fence = fenceRegex.FindStringSubmatch(t)[1]
+		case i < tagsUntil:
+			l.Kind = Tags
+		case startsChunk(texts, i) && tagChunk(texts, i) > i:
+			l.Kind = Tags
+			tagsUntil = tagChunk(texts, i)
+		case indented && indentRegex.MatchString(t):
+			l.Kind = Code
+		case indented && blank && nextIndented(texts, i):
+			l.Kind = Code
+		case codeMayStart && !blank && indentRegex.MatchString(t):
+			l.Kind = Code
+			indented = true
+		case !hasTitle && strings.HasPrefix(t, titlePrefix):
+			l.Kind = Title
+			l.Level = 1
+			hasTitle = true
+		default:
+			if m := headingRegex.FindStringSubmatch(t); m != nil {
+				l.Kind = Heading
+				l.Level = len(m[1])
+			}
+			if link, iso, anchor, ok := findLink(t); ok {
+				l.Kind = Link
+				l.Link, l.ISO, l.Anchor = link, iso, anchor
+			} else if m := wikiLineRegex.FindStringSubmatch(t); m != nil {
+				l.Kind = Link
+				l.Link = m[1]
+				l.ISO, l.Anchor = splitTarget(m[2])
+			}
+		}
+		switch l.Kind {
+		case Text, Heading, Link:
+			l.Refs = findRefs(l)
+		}
+		if l.Kind != Code {
+			indented = false
+		}
+		switch l.Kind {
+		case Title, Heading, Fence, Code:
+			codeMayStart = true
+		default:
+			codeMayStart = blank
+		}
+		lines[i] = l
+	}
+	typeRefs(lines)
+
+	return lines
+}
+
+// typeRefs sets the type and context of the refs on lines. Links on a
+// footnote definition are footnotes, with the sentence that refers to
+// the footnote as context. Links on link lines are see-also entries,
+// with the entry as context. Any other link is inline, with the
+// sentence it is in as context.
+func typeRefs(lines []Line) {
+	paras := paragraphs(lines)
+
+	// Sentence each footnote is referred to in, by label.
+	notes := make(map[string]string)
+	for _, p := range paras {
+		masked := maskCode(p.text)
+		for _, m := range footnoteRefRegex.FindAllStringSubmatchIndex(masked, -1) {
+			label := p.text[m[2]:m[3]]
+			if _, ok := notes[label]; !ok {
+				notes[label] = sentence(p.text, m[0], m[1])
+			}
+		}
+	}
+
+	for _, p := range paras {
+		for k, i := range p.lines {
+			for j := range lines[i].Refs {
+				r := &lines[i].Refs[j]
+				start := p.starts[k] + r.Col - 1 - p.trims[k]
+				r.Type = TypeInline
+				r.Context = sentence(p.text, start, start+len(r.Content))
+			}
+		}
+	}
+
+	for i := range lines {
+		l := &lines[i]
+		if len(l.Refs) == 0 {
+			continue
+		}
+		if m := footnoteDefRegex.FindStringSubmatch(l.Text); m != nil {
+			ctx, ok := notes[m[1]]
+			if !ok {
+				ctx = strings.TrimSpace(l.Text[len(m[0]):])
+			}
+			for j := range l.Refs {
+				l.Refs[j].Type, l.Refs[j].Context = TypeFootnote, ctx
+			}
+		} else if l.Kind == Link {
+			ctx := strings.TrimSpace(listItemRegex.ReplaceAllString(l.Text, ""))
+			for j := range l.Refs {
+				l.Refs[j].Type, l.Refs[j].Context = TypeSeeAlso, ctx
+			}
+		}
+	}
+}
+
+// paragraph is a run of text lines read as one.
+type paragraph struct {
+	text   string // lines joined by spaces, without indents or list markers
+	lines  []int  // index of each line
+	starts []int  // offset in text of each line
+	trims  []int  // bytes trimmed from the start of each line
+}
+
+// paragraphs returns the paragraphs of text lines. Blank lines and
+// lines of any other kind end a paragraph, a list item starts a new
+// one and a heading is a paragraph of its own. Footnote definitions
+// are left out.
+func paragraphs(lines []Line) []paragraph {
+	var paras []paragraph
+	var p *paragraph
+	for i, l := range lines {
+		inText := (l.Kind == Text || l.Kind == Heading) && strings.TrimSpace(l.Text) != "" &&
+			!footnoteDefRegex.MatchString(l.Text)
+		if !inText {
+			p = nil
+			continue
+		}
+		if p == nil || l.Kind == Heading || listItemRegex.MatchString(l.Text) {
+			paras = append(paras, paragraph{})
+			p = &paras[len(paras)-1]
+		}
+		t := strings.TrimLeft(l.Text, " \t")
+		if m := listItemRegex.FindString(l.Text); m != "" {
+			t = l.Text[len(m):]
+		}
+		if p.text != "" {
+			p.text += " "
+		}
+		p.lines = append(p.lines, i)
+		p.starts = append(p.starts, len(p.text))
+		p.trims = append(p.trims, len(l.Text)-len(t))
+		p.text += strings.TrimRight(t, " \t")
+		if l.Kind == Heading {
+			p = nil
+		}
+	}
+	return paras
+}
+
+// sentence returns the sentence of text that holds text[start:end]. A
+// sentence ends with a `.`, `!` or `?` followed by a space.
+func sentence(text string, start, end int) string {
+	from, to := 0, len(text)
+	for i := start - 1; i > 0; i-- {
+		if text[i] == ' ' && strings.IndexByte(".!?", text[i-1]) >= 0 {
+			from = i + 1
+			break
+		}
+	}
+	for i := end; i < len(text)-1; i++ {
+		if strings.IndexByte(".!?", text[i]) >= 0 && text[i+1] == ' ' {
+			to = i + 1
+			break
+		}
+	}
+	return strings.TrimSpace(text[from:to])
+}
+
+// maskCode blanks out the code spans of s, keeping its length so
+// indexes still line up.
+func maskCode(s string) string {
+	return codeSpanRegex.ReplaceAllStringFunc(s, func(c string) string {
+		return strings.Repeat(" ", len(c))
+	})
+}
+
+// startsChunk reports whether line i of texts is indented and starts a
+// chunk of indented lines.
+func startsChunk(texts []string, i int) bool {
+	if strings.TrimSpace(texts[i]) == "" || !indentRegex.MatchString(texts[i]) {
+		return false
+	}
+	return i == 0 || strings.TrimSpace(texts[i-1]) == "" || !indentRegex.MatchString(texts[i-1])
+}
+
+// tagChunk returns the end of the chunk of indented lines starting at
+// line i of texts if every line in it is a tag line, and i otherwise.
+func tagChunk(texts []string, i int) int {
+	j := i
+	for ; j < len(texts); j++ {
+		t := texts[j]
+		if strings.TrimSpace(t) == "" || !indentRegex.MatchString(t) {
+			break
+		}
+		if !tagLineRegex.MatchString(t) {
+			return i
+		}
+	}
+	return j
+}
+
+// nextIndented reports whether the next line of texts after i that
+// isn't blank continues an indented code block, that is, it is
+// indented and doesn't start a chunk of tag lines.
+func nextIndented(texts []string, i int) bool {
+	for j := i + 1; j < len(texts); j++ {
+		if strings.TrimSpace(texts[j]) != "" {
+			return indentRegex.MatchString(texts[j]) && tagChunk(texts, j) == j
+		}
+	}
+	return false
+}
+
+// closesFence reports whether line closes a code block opened with
+// fence. The closing fence uses the same character and is at least as
+// long.
+func closesFence(line, fence string) bool {
+	t := strings.TrimLeft(line, " ")
+	if len(line)-len(t) > 3 {
+		return false
+	}
+	t = strings.TrimRight(t, " \t")
+	return len(t) >= len(fence) && strings.Trim(t, fence[:1]) == ""
+}
+
+// findLink returns the zettel link of a link line, the directory name
+// it is labeled with and the anchor it points to. A link line has a
+// link labeled with the directory it points to followed by a title, as
+// written by zet, so a Markdown link with a label of its own is left to
+// be an inline link. Links inside code spans are ignored.
+func findLink(line string) (link, iso, anchor string, ok bool) {
+	masked := maskCode(line)
+	m := linkRegex.FindStringSubmatchIndex(masked)
+	if m == nil {
+		return "", "", "", false
+	}
+	iso, anchor = splitTarget(line[m[6]:m[7]])
+	if line[m[4]:m[5]] != iso {
+		return "", "", "", false
+	}
+	return line[m[2]:m[3]], iso, anchor, true
+}
+
+// splitTarget splits the target of a zettel link, e.g. `iso#anchor`,
+// into the directory name and the anchor.
+func splitTarget(target string) (iso, anchor string) {
+	iso, anchor, _ = strings.Cut(target, "#")
+	return strings.TrimSuffix(strings.TrimSpace(iso), "/"), strings.TrimSpace(anchor)
+}
+
+// findRefs returns the zettel links on line l. The link of a link line
+// is a LinkLine reference unless it is a wiki link. Links inside code
+// spans and images are skipped.
+func findRefs(l Line) []Ref {
+	masked := maskCode(l.Text)
+
+	var refs []Ref
+	lineLink := -1 // start of the link of a link line
+	if l.Kind == Link && !strings.HasPrefix(l.Link, `[[`) {
+		lineLink = strings.LastIndex(l.Text, l.Link)
+		refs = append(refs, Ref{Kind: LinkLine, Content: l.Link, ISO: l.ISO, Anchor: l.Anchor, Label: l.ISO, Col: lineLink + 1})
+	}
+	for _, m := range wikiLinkRegex.FindAllStringSubmatchIndex(masked, -1) {
+		r := Ref{Kind: LinkWiki, Content: l.Text[m[0]:m[1]], Col: m[0] + 1}
+		r.ISO, r.Anchor = splitTarget(l.Text[m[2]:m[3]])
+		if m[4] >= 0 {
+			r.Label = strings.TrimSpace(l.Text[m[4]:m[5]])
+		}
+		refs = append(refs, r)
+	}
+	for _, m := range inlineLinkRegex.FindAllStringSubmatchIndex(masked, -1) {
+		if m[3] > m[2] || (lineLink >= 0 && m[0] >= lineLink) {
+			continue
+		}
+		r := Ref{Kind: LinkInline, Content: l.Text[m[0]:m[1]], ISO: l.Text[m[6]:m[7]], Label: l.Text[m[4]:m[5]], Col: m[0] + 1}
+		if m[8] >= 0 {
+			r.Anchor = l.Text[m[8]:m[9]]
+		}
+		refs = append(refs, r)
+	}
+	sort.Slice(refs, func(i, j int) bool { return refs[i].Col < refs[j].Col })
+	return refs
+}
+
+// TagLine returns the hashtags of a Tags line without the indent, e.g.
+// `#pkms #productivity`.
+func (l Line) TagLine() string {
+	return strings.TrimLeft(l.Text, " ")
+}
+
+// IsBody reports whether the line belongs to the body of a zettel, that
+// is, everything but front matter, the title, links and tag lines.
+func (l Line) IsBody() bool {
+	switch l.Kind {
+	case FrontMatter, Title, Link, Tags:
+		return false
+	}
+	return true
+}
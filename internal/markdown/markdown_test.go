@@ -0,0 +1,162 @@
+package markdown
+
+import (
+	"fmt"
+	"strings"
+)
+
+func ExampleParse() {
+	content := "---\n" +
+		"status: draft\n" +
+		"---\n" +
+		"# C preprocessor\n" +
+		"\n" +
+		"```c\n" +
+		"# not a title\n" +
+		"## not a heading\n" +
+		"    #include <stdio.h>\n" +
+		"* [20231028012959](../20231028012959) Not a link\n" +
+		"```\n" +
+		"\n" +
+		"    #define MAX 10\n" +
+		"    #pragma once\n" +
+		"\n" +
+		"    #c\n" +
+		"\n" +
+		"## Notes\n" +
+		"\n" +
+		"Use `[x](../x) y` for links.\n" +
+		"* [20231028013010](../20231028013010) A link\n" +
+		"    * [20231028013031](../20231028013031) Nested link\n" +
+		"\n" +
+		"    #c #lang/c"
+
+	for _, l := range Parse(content) {
+		fmt.Println(strings.TrimSpace(fmt.Sprintf("%d %s %s", l.Num, l.Kind, l.ISO)))
+	}
+	// Output:
+	// 1 front matter
+	// 2 front matter
+	// 3 front matter
+	// 4 title
+	// 5 text
+	// 6 fence
+	// 7 code
+	// 8 code
+	// 9 code
+	// 10 code
+	// 11 fence
+	// 12 text
+	// 13 code
+	// 14 code
+	// 15 text
+	// 16 tags
+	// 17 text
+	// 18 heading
+	// 19 text
+	// 20 text
+	// 21 link 20231028013010
+	// 22 link 20231028013031
+	// 23 text
+	// 24 tags
+}
+
+func ExampleParse_tagLines() {
+	content := "# Shell\n" +
+		"\n" +
+		"    # a comment\n" +
+		"    #!/bin/sh\n" +
+		"\n" +
+		"Text.\n" +
+		"\n" +
+		"    #shell #cli\n" +
+		"    #tools"
+
+	for _, l := range Parse(content) {
+		if l.Kind == Tags {
+			fmt.Printf("%d %q\n", l.Num, l.TagLine())
+		}
+	}
+	// Output:
+	// 8 "#shell #cli"
+	// 9 "#tools"
+}
+
+func ExampleParse_fences() {
+	content := "# Fences\n" +
+		"~~~~\n" +
+		"```\n" +
+		"# still code\n" +
+		"~~~\n" +
+		"~~~~~\n" +
+		"# Not the title\n" +
+		"````go\n" +
+		"```\n" +
+		"````"
+
+	for _, l := range Parse(content) {
+		fmt.Printf("%d %s %d\n", l.Num, l.Kind, l.Level)
+	}
+	// Output:
+	// 1 title 1
+	// 2 fence 0
+	// 3 code 0
+	// 4 code 0
+	// 5 code 0
+	// 6 fence 0
+	// 7 heading 1
+	// 8 fence 0
+	// 9 code 0
+	// 10 fence 0
+}
+
+func ExampleParse_links() {
+	content := "# Links\n" +
+		"\n" +
+		"Wiki links such as [[20231028012959]] and [[20231028013010|zet]] work,\n" +
+		"and so does [a Markdown link](../20231028013031) or `[[code]]`.\n" +
+		"![image](../20231028013031/diagram.png)\n" +
+		"\n" +
+		"* [[20231028012959]]\n" +
+		"* [old](../20231028013031) and [20231028013010](../20231028013010) Zet"
+
+	for _, l := range Parse(content) {
+		for _, r := range l.Refs {
+			fmt.Printf("%d:%d %s %s %q %s\n", l.Num, r.Col, l.Kind, r.Kind, r.Label, r.Content)
+		}
+	}
+	// Output:
+	// 3:20 text wiki "" [[20231028012959]]
+	// 3:43 text wiki "zet" [[20231028013010|zet]]
+	// 4:13 text inline "a Markdown link" [a Markdown link](../20231028013031)
+	// 7:3 link wiki "" [[20231028012959]]
+	// 8:3 link inline "old" [old](../20231028013031)
+	// 8:32 link line "20231028013010" [20231028013010](../20231028013010) Zet
+}
+
+func ExampleParse_linkTypes() {
+	content := "# Reverse proxy\n" +
+		"\n" +
+		"A reverse proxy sits in front of web servers. Unlike a\n" +
+		"[forward proxy](../20230127234254), it hides the servers[^r]. It is\n" +
+		"often used for caching.\n" +
+		"\n" +
+		"* Also see [[20230127210850|gateways]] when in doubt.\n" +
+		"\n" +
+		"See:\n" +
+		"\n" +
+		"* [20230127234254](../20230127234254) What is a proxy?\n" +
+		"\n" +
+		"[^r]: [20240809000017](../20240809000017) What is a firewall?"
+
+	for _, l := range Parse(content) {
+		for _, r := range l.Refs {
+			fmt.Printf("%d %s %s: %s\n", l.Num, r.ISO, r.Type, r.Context)
+		}
+	}
+	// Output:
+	// 4 20230127234254 inline: Unlike a [forward proxy](../20230127234254), it hides the servers[^r].
+	// 7 20230127210850 inline: Also see [[20230127210850|gateways]] when in doubt.
+	// 11 20230127234254 see-also: [20230127234254](../20230127234254) What is a proxy?
+	// 13 20240809000017 footnote: Unlike a [forward proxy](../20230127234254), it hides the servers[^r].
+}
@@ -0,0 +1,77 @@
+package markdown
+
+import (
+	"strconv"
+	"strings"
+	"unicode"
+)
+
+// Section is the part of a zettel under its title or a heading, up to
+// the next heading.
+type Section struct {
+	Heading string // heading text, e.g. `Further reading`
+	Anchor  string // anchor links point to, e.g. `further-reading`
+	Level   int    // heading level
+	Start   int    // line of the heading
+	End     int    // last line of the section
+}
+
+// Sections returns the sections of lines as returned by Parse. Lines
+// before the title are not part of any section. Anchors are unique
+// within a zettel: a heading repeated further down gets `-1`, `-2` and
+// so on added to its anchor.
+func Sections(lines []Line) []Section {
+	var sections []Section
+	seen := make(map[string]int)
+	for _, l := range lines {
+		if l.Kind != Title && l.Kind != Heading {
+			continue
+		}
+		if n := len(sections); n > 0 {
+			sections[n-1].End = l.Num - 1
+		}
+		h := HeadingText(l.Text)
+		a := Anchor(h)
+		if n, ok := seen[a]; ok {
+			seen[a] = n + 1
+			a += "-" + strconv.Itoa(n+1)
+		} else {
+			seen[a] = 0
+		}
+		sections = append(sections, Section{Heading: h, Anchor: a, Level: l.Level, Start: l.Num})
+	}
+	if n := len(sections); n > 0 {
+		sections[n-1].End = len(lines)
+	}
+	return sections
+}
+
+// HeadingText returns the text of an ATX heading line without its `#`
+// marks, e.g. `Further reading` for `## Further reading ##`.
+func HeadingText(line string) string {
+	t := strings.TrimLeft(strings.TrimSpace(line), "#")
+	t = strings.TrimSpace(t)
+	// A closing sequence of `#` marks has to follow a space.
+	if i := strings.LastIndex(t, " #"); i >= 0 && strings.Trim(t[i+1:], "#") == "" {
+		t = strings.TrimSpace(t[:i])
+	} else if strings.Trim(t, "#") == "" {
+		t = ""
+	}
+	return t
+}
+
+// Anchor returns the anchor of a heading the way GitHub makes them: the
+// text is lower cased, spaces become hyphens and anything other than
+// letters, digits, hyphens and underscores is dropped.
+func Anchor(heading string) string {
+	var b strings.Builder
+	for _, r := range strings.ToLower(strings.TrimSpace(heading)) {
+		switch {
+		case r == ' ':
+			b.WriteRune('-')
+		case r == '-' || r == '_' || unicode.IsLetter(r) || unicode.IsDigit(r):
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,34 @@
+package markdown
+
+import "fmt"
+
+func ExampleSections() {
+	content := "# Reading notes\n" +
+		"\n" +
+		"Intro.\n" +
+		"\n" +
+		"## Chapter 1: Why? ##\n" +
+		"\n" +
+		"```md\n" +
+		"## Not a heading\n" +
+		"```\n" +
+		"\n" +
+		"## Notes\n" +
+		"### Notes\n" +
+		"See [[20231028013010#chapter-1-why|why]] and [the intro](../20231028013010#reading-notes)."
+
+	lines := Parse(content)
+	for _, s := range Sections(lines) {
+		fmt.Printf("%d-%d %d %s #%s\n", s.Start, s.End, s.Level, s.Heading, s.Anchor)
+	}
+	for _, r := range lines[len(lines)-1].Refs {
+		fmt.Printf("%s #%s\n", r.ISO, r.Anchor)
+	}
+	// Output:
+	// 1-4 1 Reading notes #reading-notes
+	// 5-10 2 Chapter 1: Why? #chapter-1-why
+	// 11-11 2 Notes #notes
+	// 12-13 3 Notes #notes-1
+	// 20231028013010 #chapter-1-why
+	// 20231028013010 #reading-notes
+}
@@ -1,13 +1,13 @@
 package meta
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+
+	"github.com/ericstrs/zet/internal/markdown"
 )
 
 // Body returns the body for a zettel at the given path. A body is
@@ -40,40 +40,23 @@ func Body(path string) (string, error) {
 	return strings.Join(bodyLines, "\n"), nil
 }
 
-// ParseBody parses out and returns the body of zettel content.
+// ParseBody parses out and returns the body of zettel content. Front
+// matter is not part of the body.
 func ParseBody(content string) []string {
 	var bodyLines []string
-	var title string
 	isBody := false
-	// Match lines that contain a link. E.g., `* [dir][../dir] title`
-	linkRegex := regexp.MustCompile(`^.*(\[(.+)\]\(\.\./(.*?)/?\) (.+))`)
-	tagRegex := regexp.MustCompile(`^ {4,}#[a-zA-Z]+`)
-
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	for scanner.Scan() {
-		line := scanner.Text()
 
+	for _, line := range markdown.Parse(content) {
 		// Is line the title?
-		if title == "" && strings.HasPrefix(line, `# `) {
-			title = strings.TrimPrefix(line, `# `)
+		if line.Kind == markdown.Title {
 			isBody = true
 			continue
 		}
 
-		// Is line a markdown link?
-		matches := linkRegex.FindStringSubmatch(line)
-		if len(matches) > 1 {
-			continue
-		}
-
-		// Is line the tag line?
-		if tagRegex.MatchString(line) {
-			continue
-		}
-
-		// Everything else is considered as body.
-		if isBody {
-			bodyLines = append(bodyLines, line)
+		// Everything else but links, tag lines and front matter is
+		// considered as body.
+		if isBody && line.IsBody() {
+			bodyLines = append(bodyLines, line.Text)
 		}
 	}
 
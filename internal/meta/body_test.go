@@ -27,7 +27,7 @@ See more:
     #ignore me`
 
 	body := strings.Join(ParseBody(content), "\n")
-	fmt.Printf(body)
+	fmt.Print(body)
 
 	// Output:
 	//
@@ -45,3 +45,14 @@ See more:
 	//
 	// See more:
 }
+
+func ExampleParseBody_code() {
+	content := "```\n# not the title\n```\n# Title\n\n    #include <stdio.h>\n\n```\n    #not-tags\n```\n\n    #c"
+
+	fmt.Printf("%q\n", strings.Join(ParseBody(content), "\n"))
+	fmt.Printf("%q\n", ParseTags(content))
+
+	// Output:
+	// "\n    #include <stdio.h>\n\n```\n    #not-tags\n```\n"
+	// ["#c"]
+}
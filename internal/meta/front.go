@@ -0,0 +1,51 @@
+package meta
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ericstrs/zet/internal/storage"
+)
+
+// Meta returns the front matter for a zettel at the given path, one
+// key/value pair per line.
+func Meta(path string) (string, error) {
+	// This essentially locks support to just readme files.
+	if !strings.HasSuffix(path, `README.md`) {
+		path = filepath.Join(path, `README.md`)
+	}
+
+	// Does the file exist?
+	ok, err := IsFile(path)
+	if err != nil {
+		if err == ErrPathDoesNotExist {
+			return "", err
+		}
+		return "", fmt.Errorf("Failed to ensure file exists: %v", err)
+	}
+	if !ok {
+		return "", errors.New("path corresponds to a directory")
+	}
+
+	contentBytes, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	metaLines := ParseMeta(string(contentBytes))
+
+	return strings.Join(metaLines, "\n"), nil
+}
+
+// ParseMeta parses out and returns the front matter of zettel content
+// as `key: value` lines. Each item of a list gets a line of its own.
+func ParseMeta(content string) []string {
+	var metaLines []string
+	front, _, _ := storage.SplitFrontMatter(content)
+	for _, m := range storage.ParseFrontMatter(front) {
+		metaLines = append(metaLines, m.Key+`: `+m.Value)
+	}
+	return metaLines
+}
@@ -0,0 +1,28 @@
+package meta
+
+import (
+	"fmt"
+	"strings"
+)
+
+func ExampleParseMeta() {
+	content := `---
+aliases: [Golang, Go language]
+tags:
+  - lang/go
+status: draft
+---
+# Go
+
+Body.`
+
+	fmt.Println(strings.Join(ParseMeta(content), "\n"))
+	fmt.Printf("%q\n", strings.Join(ParseBody(content), "\n"))
+
+	// Output:
+	// aliases: Golang
+	// aliases: Go language
+	// tags: lang/go
+	// status: draft
+	// "\nBody."
+}
@@ -1,13 +1,13 @@
 package meta
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+
+	"github.com/ericstrs/zet/internal/markdown"
 )
 
 const (
@@ -60,8 +60,13 @@ func Link(path string) (string, error) {
 
 	d := filepath.Base(path)
 
-	l := fmt.Sprintf(linkFormat, d, d, t)
-	return l, nil
+	return FormatLink(d, t), nil
+}
+
+// FormatLink returns the zettel link for a zettel directory name and
+// title.
+func FormatLink(dir, title string) string {
+	return fmt.Sprintf(linkFormat, dir, dir, title)
 }
 
 // Links returns links from a zettel at the given path.
@@ -93,20 +98,75 @@ func Links(path string) (string, error) {
 	return strings.Join(linkLines, "\n"), nil
 }
 
-// ParseLinks parses out and returns the links from zettel content.
-// A link is takes the form of a line containing the substring
-// "[dir](../dir) title".
+// ParseLinks parses out and returns the lines holding links from zettel
+// content. A link takes the form of "[dir](../dir) title", a wiki link
+// such as "[[dir]]" or "[[dir|label]]", or a Markdown link within text
+// such as "[label](../dir)". Front matter and code are skipped.
 func ParseLinks(content string) []string {
 	var linkLines []string
-	linkRegex := regexp.MustCompile(`^.*(\[(.+)\]\(\.\./(.*?)/?\) (.+))`)
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	for scanner.Scan() {
-		line := scanner.Text()
-		matches := linkRegex.FindStringSubmatch(line)
-		if len(matches) > 1 {
-			linkLines = append(linkLines, line)
-			continue
+	for _, line := range markdown.Parse(content) {
+		if len(line.Refs) > 0 {
+			linkLines = append(linkLines, line.Text)
 		}
 	}
 	return linkLines
 }
+
+// LinkRef is a zettel link along with where it is and what it is for.
+type LinkRef struct {
+	Line    int    `json:"line"`            // line the link is on
+	To      string `json:"to"`              // directory name the link points to
+	Kind    string `json:"kind"`            // how the link is written, e.g. wiki
+	Type    string `json:"type"`            // inline, footnote or see-also
+	Label   string `json:"label,omitempty"` // text shown for the link
+	Content string `json:"content"`         // link as written
+	Context string `json:"context"`         // sentence or entry the link is in
+}
+
+// LinkRefs returns every link from a zettel at the given path.
+func LinkRefs(path string) ([]LinkRef, error) {
+	// This essentially locks support to just readme files.
+	if !strings.HasSuffix(path, `README.md`) {
+		path = filepath.Join(path, `README.md`)
+	}
+
+	// Does the file exist?
+	ok, err := IsFile(path)
+	if err != nil {
+		if err == ErrPathDoesNotExist {
+			return nil, err
+		}
+		return nil, fmt.Errorf("Failed to ensure file exists: %v", err)
+	}
+	if !ok {
+		return nil, errors.New("path corresponds to a directory")
+	}
+
+	contentBytes, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	return ParseLinkRefs(string(contentBytes)), nil
+}
+
+// ParseLinkRefs parses out and returns every link in zettel content, in
+// the order written. Each link is typed as an inline reference, a
+// footnote or a see-also entry, and carries the sentence or entry it is
+// found in.
+func ParseLinkRefs(content string) []LinkRef {
+	refs := []LinkRef{}
+	for _, line := range markdown.Parse(content) {
+		for _, r := range line.Refs {
+			refs = append(refs, LinkRef{
+				Line:    line.Num,
+				To:      r.ISO,
+				Kind:    r.Kind,
+				Type:    r.Type,
+				Label:   r.Label,
+				Content: r.Content,
+				Context: r.Context,
+			})
+		}
+	}
+	return refs
+}
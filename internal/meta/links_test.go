@@ -0,0 +1,42 @@
+package meta
+
+import (
+	"encoding/json"
+	"os"
+)
+
+func ExampleParseLinkRefs() {
+	content := `# Proxy
+
+A [reverse proxy](../20240809000017) hides servers. It helps.
+
+See:
+
+* [20230127234254](../20230127234254) What is a gateway?`
+
+	enc := json.NewEncoder(os.Stdout)
+	enc.SetIndent("", "  ")
+	enc.Encode(ParseLinkRefs(content))
+
+	// Output:
+	// [
+	//   {
+	//     "line": 3,
+	//     "to": "20240809000017",
+	//     "kind": "inline",
+	//     "type": "inline",
+	//     "label": "reverse proxy",
+	//     "content": "[reverse proxy](../20240809000017)",
+	//     "context": "A [reverse proxy](../20240809000017) hides servers."
+	//   },
+	//   {
+	//     "line": 7,
+	//     "to": "20230127234254",
+	//     "kind": "line",
+	//     "type": "see-also",
+	//     "label": "20230127234254",
+	//     "content": "[20230127234254](../20230127234254) What is a gateway?",
+	//     "context": "[20230127234254](../20230127234254) What is a gateway?"
+	//   }
+	// ]
+}
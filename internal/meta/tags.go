@@ -1,13 +1,14 @@
 package meta
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
-	"regexp"
 	"strings"
+
+	"github.com/ericstrs/zet/internal/markdown"
+	"github.com/ericstrs/zet/internal/storage"
 )
 
 // Tags returns the tags for a zettel at the given path. A tags is
@@ -40,20 +41,44 @@ func Tags(path string) (string, error) {
 	return strings.Join(tagLines, "\n"), nil
 }
 
-// ParseTags parses out and returns the body of zettel content.
+// ParseTags parses out and returns the tag lines of zettel content.
 // A tag line takes the form of a line containing four or more spaces
-// followed by a hash tag.
+// followed by hash tags only, outside of code blocks. The tags listed
+// in front matter and, if inline tags are enabled, the tags written
+// inline in the body that aren't on a tag line are returned as one
+// extra line.
 func ParseTags(content string) []string {
 	var tagLines []string
-	tagRegex := regexp.MustCompile(`^ {4,}(#[a-zA-Z]+.*)`)
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	for scanner.Scan() {
-		line := scanner.Text()
-		matches := tagRegex.FindStringSubmatch(line)
-		if len(matches) > 1 {
-			tagLines = append(tagLines, matches[1])
+	seen := make(map[string]bool)
+	for _, line := range markdown.Parse(content) {
+		if line.Kind != markdown.Tags {
 			continue
 		}
+		tagLine := line.TagLine()
+		tagLines = append(tagLines, tagLine)
+		for _, t := range strings.Fields(tagLine) {
+			seen[storage.NormalizeTag(strings.TrimPrefix(t, `#`))] = true
+		}
+	}
+
+	var extra []string
+	front, _, _ := storage.SplitFrontMatter(content)
+	for _, t := range storage.FrontMatterTags(storage.ParseFrontMatter(front)) {
+		if !seen[t.Name] {
+			seen[t.Name] = true
+			extra = append(extra, `#`+t.Name)
+		}
+	}
+	if storage.InlineTags {
+		for _, t := range storage.ParseInlineTags(content) {
+			if !seen[t.Name] {
+				seen[t.Name] = true
+				extra = append(extra, `#`+t.Name)
+			}
+		}
+	}
+	if len(extra) > 0 {
+		tagLines = append(tagLines, strings.Join(extra, ` `))
 	}
 	return tagLines
 }
@@ -1,12 +1,14 @@
 package meta
 
 import (
-	"bufio"
 	"errors"
 	"fmt"
+	"io"
 	"os"
 	"path/filepath"
 	"strings"
+
+	"github.com/ericstrs/zet/internal/markdown"
 )
 
 var ErrPathDoesNotExist = errors.New("path does not exist")
@@ -85,20 +87,20 @@ func prefix(f string) (string, error) {
 
 // parseTitle returns the title from a file using the given prefix. If a
 // title is found, the title is returned without the prefix. If the
-// given file doesn't have a title, an empty string is returned.
+// given file doesn't have a title, an empty string is returned. Front
+// matter and code blocks are skipped.
 func parseTitle(f *os.File, p string) (string, error) {
 	var t string
-	s := bufio.NewScanner(f)
-	for s.Scan() {
-		line := s.Text()
-		if strings.HasPrefix(line, p) {
-			t = line
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return "", err
+	}
+	for _, line := range markdown.Parse(string(b)) {
+		if line.Kind == markdown.Title && strings.HasPrefix(line.Text, p) {
+			t = line.Text
 			break
 		}
 	}
-	if err := s.Err(); err != nil {
-		return "", err
-	}
 
 	return strings.TrimPrefix(t, p), nil
 }
@@ -5,7 +5,7 @@ import (
 	"os"
 )
 
-func ExampleParseTitle_md() {
+func Example_parseTitle_md() {
 	// Create a temporary file
 	tmpFile, err := os.CreateTemp("", "test")
 	if err != nil {
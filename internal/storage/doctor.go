@@ -0,0 +1,404 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ericstrs/zet/internal/markdown"
+	"github.com/jmoiron/sqlx"
+)
+
+// Names of the checks run by Diagnose.
+const (
+	CheckFTS   = "fts"   // search index out of sync with zettels
+	CheckLinks = "links" // links from or to zettels that are gone
+	CheckDirs  = "dirs"  // directories without zettels
+	CheckFiles = "files" // zettels whose directory is gone
+)
+
+// Problem is an inconsistency between the database and the zet
+// directory.
+type Problem struct {
+	Check  string // name of the check that found the problem
+	Detail string // description of the problem
+}
+
+func (p Problem) String() string {
+	return p.Check + ": " + p.Detail
+}
+
+// ftsTagsSQL selects the tag line of zettel z the same way the zettel
+// triggers do.
+const ftsTagsSQL = `(
+	SELECT GROUP_CONCAT(name, ' ')
+	FROM tag
+	JOIN zettel_tags ON tag.id = zettel_tags.tag_id
+	WHERE zettel_tags.zettel_id = z.id
+)`
+
+// Diagnose cross-checks the database against itself and the zet
+// directory and returns every problem found. It doesn't change
+// anything.
+func (s *Storage) Diagnose(zetPath string) ([]Problem, error) {
+	var problems []Problem
+	checks := []func(*sqlx.DB, string) ([]Problem, error){
+		diagnoseFTS,
+		diagnoseSectionFTS,
+		diagnoseLinks,
+		diagnoseDirs,
+		diagnoseFiles,
+	}
+	for _, check := range checks {
+		ps, err := check(s.DB, zetPath)
+		if err != nil {
+			return nil, err
+		}
+		problems = append(problems, ps...)
+	}
+	return problems, nil
+}
+
+// diagnoseFTS finds search index rows that are missing, have no zettel,
+// or hold stale content, and reports a corrupt index.
+func diagnoseFTS(db *sqlx.DB, _ string) ([]Problem, error) {
+	var problems []Problem
+
+	if _, err := db.Exec(`INSERT INTO zettel_fts(zettel_fts) VALUES('integrity-check');`); err != nil {
+		problems = append(problems, Problem{CheckFTS, fmt.Sprintf("search index is corrupt: %v", err)})
+	}
+
+	var missing []Zettel
+	const missingQuery = `
+		SELECT id, dir_name, name FROM zettel
+		WHERE id NOT IN (SELECT rowid FROM zettel_fts)
+		ORDER BY dir_name, name;`
+	if err := db.Select(&missing, missingQuery); err != nil {
+		return nil, fmt.Errorf("Error checking search index: %v", err)
+	}
+	for _, z := range missing {
+		problems = append(problems, Problem{CheckFTS, fmt.Sprintf("%s is missing from search index", filepath.Join(z.DirName, z.Name))})
+	}
+
+	var extra []int
+	const extraQuery = `
+		SELECT rowid FROM zettel_fts
+		WHERE rowid NOT IN (SELECT id FROM zettel)
+		ORDER BY rowid;`
+	if err := db.Select(&extra, extraQuery); err != nil {
+		return nil, fmt.Errorf("Error checking search index: %v", err)
+	}
+	for _, id := range extra {
+		problems = append(problems, Problem{CheckFTS, fmt.Sprintf("search index row %d has no zettel", id)})
+	}
+
+	var stale []Zettel
+	const staleQuery = `
+		SELECT z.id, z.dir_name, z.name FROM zettel z
+		JOIN zettel_fts f ON f.rowid = z.id
+		WHERE f.title IS NOT z.title OR f.body IS NOT z.body
+			OR IFNULL(f.tags, '') != IFNULL(` + ftsTagsSQL + `, '')
+		ORDER BY z.dir_name, z.name;`
+	if err := db.Select(&stale, staleQuery); err != nil {
+		return nil, fmt.Errorf("Error checking search index: %v", err)
+	}
+	for _, z := range stale {
+		problems = append(problems, Problem{CheckFTS, fmt.Sprintf("%s is out of date in search index", filepath.Join(z.DirName, z.Name))})
+	}
+
+	return problems, nil
+}
+
+// diagnoseSectionFTS finds section index rows that are missing, have no
+// section, or hold stale content, and reports a corrupt index.
+func diagnoseSectionFTS(db *sqlx.DB, _ string) ([]Problem, error) {
+	var problems []Problem
+
+	if _, err := db.Exec(`INSERT INTO section_fts(section_fts) VALUES('integrity-check');`); err != nil {
+		problems = append(problems, Problem{CheckFTS, fmt.Sprintf("section index is corrupt: %v", err)})
+	}
+
+	type section struct {
+		ID      int    `db:"id"`
+		DirName string `db:"dir_name"`
+		Name    string `db:"name"`
+		Anchor  string `db:"anchor"`
+	}
+	var missing []section
+	const missingQuery = `
+		SELECT s.id, z.dir_name, z.name, s.anchor FROM section s
+		JOIN zettel z ON z.id = s.zettel_id
+		WHERE s.id NOT IN (SELECT rowid FROM section_fts)
+		ORDER BY z.dir_name, z.name, s.start_line;`
+	if err := db.Select(&missing, missingQuery); err != nil {
+		return nil, fmt.Errorf("Error checking section index: %v", err)
+	}
+	for _, sec := range missing {
+		problems = append(problems, Problem{CheckFTS, fmt.Sprintf("%s#%s is missing from section index", filepath.Join(sec.DirName, sec.Name), sec.Anchor)})
+	}
+
+	var extra []int
+	const extraQuery = `
+		SELECT rowid FROM section_fts
+		WHERE rowid NOT IN (SELECT id FROM section)
+		ORDER BY rowid;`
+	if err := db.Select(&extra, extraQuery); err != nil {
+		return nil, fmt.Errorf("Error checking section index: %v", err)
+	}
+	for _, id := range extra {
+		problems = append(problems, Problem{CheckFTS, fmt.Sprintf("section index row %d has no section", id)})
+	}
+
+	var stale []section
+	const staleQuery = `
+		SELECT s.id, z.dir_name, z.name, s.anchor FROM section s
+		JOIN zettel z ON z.id = s.zettel_id
+		JOIN section_fts f ON f.rowid = s.id
+		WHERE f.title IS NOT s.heading OR f.body IS NOT s.body
+		ORDER BY z.dir_name, z.name, s.start_line;`
+	if err := db.Select(&stale, staleQuery); err != nil {
+		return nil, fmt.Errorf("Error checking section index: %v", err)
+	}
+	for _, sec := range stale {
+		problems = append(problems, Problem{CheckFTS, fmt.Sprintf("%s#%s is out of date in section index", filepath.Join(sec.DirName, sec.Name), sec.Anchor)})
+	}
+
+	return problems, nil
+}
+
+// diagnoseLinks finds links that live in or point to zettels that no
+// longer exist.
+func diagnoseLinks(db *sqlx.DB, _ string) ([]Problem, error) {
+	var problems []Problem
+
+	var links []Link
+	const query = `
+		SELECT id, content, from_zettel_id, to_zettel_id FROM link
+		WHERE from_zettel_id NOT IN (SELECT id FROM zettel)
+			OR to_zettel_id NOT IN (SELECT id FROM zettel)
+		ORDER BY id;`
+	if err := db.Select(&links, query); err != nil {
+		return nil, fmt.Errorf("Error checking links: %v", err)
+	}
+	for _, l := range links {
+		problems = append(problems, Problem{CheckLinks, fmt.Sprintf("link %d from zettel %d to zettel %d refers to a missing zettel: %s", l.ID, l.FromZettelID, l.ToZettelID, l.Content)})
+	}
+
+	var unresolved []Link
+	const unresolvedQuery = `
+		SELECT id, content, from_zettel_id, to_dir FROM unresolved_link
+		WHERE from_zettel_id NOT IN (SELECT id FROM zettel)
+		ORDER BY id;`
+	if err := db.Select(&unresolved, unresolvedQuery); err != nil {
+		return nil, fmt.Errorf("Error checking unresolved links: %v", err)
+	}
+	for _, l := range unresolved {
+		problems = append(problems, Problem{CheckLinks, fmt.Sprintf("unresolved link %d lives in missing zettel %d: %s", l.ID, l.FromZettelID, l.Content)})
+	}
+
+	return problems, nil
+}
+
+// diagnoseDirs finds directories that have no zettels.
+func diagnoseDirs(db *sqlx.DB, _ string) ([]Problem, error) {
+	var problems []Problem
+	var names []string
+	const query = `
+		SELECT name FROM dir
+		WHERE name NOT IN (SELECT dir_name FROM zettel)
+		ORDER BY name;`
+	if err := db.Select(&names, query); err != nil {
+		return nil, fmt.Errorf("Error checking directories: %v", err)
+	}
+	for _, n := range names {
+		problems = append(problems, Problem{CheckDirs, fmt.Sprintf("directory %s has no zettels", n)})
+	}
+	return problems, nil
+}
+
+// diagnoseFiles finds zettels whose directory no longer exists in the
+// zet directory.
+func diagnoseFiles(db *sqlx.DB, zetPath string) ([]Problem, error) {
+	var problems []Problem
+	names, err := vanishedDirs(db, zetPath)
+	if err != nil {
+		return nil, err
+	}
+	for _, n := range names {
+		problems = append(problems, Problem{CheckFiles, fmt.Sprintf("directory %s no longer exists", n)})
+	}
+	return problems, nil
+}
+
+// vanishedDirs returns the names of directories that have zettels in
+// the database but are missing from the zet directory.
+func vanishedDirs(q sqlx.Queryer, zetPath string) ([]string, error) {
+	var names []string
+	const query = `SELECT DISTINCT dir_name FROM zettel ORDER BY dir_name;`
+	if err := sqlx.Select(q, &names, query); err != nil {
+		return nil, fmt.Errorf("Error getting zettel directories: %v", err)
+	}
+	var vanished []string
+	for _, n := range names {
+		_, err := os.Stat(filepath.Join(zetPath, n))
+		if errors.Is(err, os.ErrNotExist) {
+			vanished = append(vanished, n)
+		} else if err != nil {
+			return nil, fmt.Errorf("Error checking directory %s: %v", n, err)
+		}
+	}
+	return vanished, nil
+}
+
+// Repair fixes every problem Diagnose can find in a single transaction.
+// Zettels whose directory is gone are deleted, links pointing to missing
+// zettels become unresolved, links living in missing zettels and empty
+// directories are deleted, and the search index is rebuilt from the
+// zettel table.
+func (s *Storage) Repair(zetPath string) error {
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("Failed to create transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := repairFiles(tx, zetPath); err != nil {
+		return err
+	}
+	if err := repairLinks(tx); err != nil {
+		return err
+	}
+	if err := repairDirs(tx); err != nil {
+		return err
+	}
+	if err := rebuildFTS(tx); err != nil {
+		return err
+	}
+	if err := resolveLinks(tx); err != nil {
+		return err
+	}
+	if err := cleanTags(tx); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("Failed to commit transaction: %v", err)
+	}
+	return nil
+}
+
+// repairFiles deletes zettels whose directory no longer exists.
+func repairFiles(tx *sqlx.Tx, zetPath string) error {
+	names, err := vanishedDirs(tx, zetPath)
+	if err != nil {
+		return err
+	}
+	for _, n := range names {
+		var zettels []Zettel
+		const query = `SELECT id, name, dir_name FROM zettel WHERE dir_name = $1;`
+		if err := tx.Select(&zettels, query, n); err != nil {
+			return fmt.Errorf("Error getting zettels in %s: %v", n, err)
+		}
+		zm := make(map[string]Zettel, len(zettels))
+		for _, z := range zettels {
+			zm[z.Name] = z
+		}
+		if err := deleteFiles(tx, zm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// repairLinks deletes links that live in missing zettels and turns
+// links pointing to missing zettels into unresolved links.
+func repairLinks(tx *sqlx.Tx) error {
+	const delFrom = `
+		DELETE FROM link WHERE from_zettel_id NOT IN (SELECT id FROM zettel);`
+	if _, err := tx.Exec(delFrom); err != nil {
+		return fmt.Errorf("Error deleting links from missing zettels: %v", err)
+	}
+	const delUnresolved = `
+		DELETE FROM unresolved_link WHERE from_zettel_id NOT IN (SELECT id FROM zettel);`
+	if _, err := tx.Exec(delUnresolved); err != nil {
+		return fmt.Errorf("Error deleting unresolved links from missing zettels: %v", err)
+	}
+
+	var links []Link
+	const query = `
+		SELECT id, content, from_zettel_id, to_zettel_id, line, col, kind, type, context, anchor FROM link
+		WHERE to_zettel_id NOT IN (SELECT id FROM zettel);`
+	if err := tx.Select(&links, query); err != nil {
+		return fmt.Errorf("Error getting links to missing zettels: %v", err)
+	}
+	for i, l := range links {
+		links[i].ToDir = linkTarget(l.Content)
+	}
+	for _, l := range links {
+		if l.ToDir != "" {
+			if err := insertUnresolved(tx, l.FromZettelID, []Link{l}); err != nil {
+				return err
+			}
+		}
+		if _, err := tx.Exec(`DELETE FROM link WHERE id = $1;`, l.ID); err != nil {
+			return fmt.Errorf("Error deleting link %d: %v", l.ID, err)
+		}
+	}
+	return nil
+}
+
+// linkTarget returns the directory name a stored link points to,
+// parsing its content the same way as the zettel it lives in.
+func linkTarget(content string) string {
+	for _, line := range markdown.Parse(content) {
+		for _, r := range line.Refs {
+			return r.ISO
+		}
+	}
+	return ""
+}
+
+// repairDirs deletes directories that have no zettels.
+func repairDirs(tx *sqlx.Tx) error {
+	const query = `DELETE FROM dir WHERE name NOT IN (SELECT dir_name FROM zettel);`
+	if _, err := tx.Exec(query); err != nil {
+		return fmt.Errorf("Error deleting empty directories: %v", err)
+	}
+	return nil
+}
+
+// rebuildFTS rebuilds the search, section and word indexes and
+// repopulates them from the zettel and section tables.
+func rebuildFTS(tx *sqlx.Tx) error {
+	// Rebuild the index from the stored content first, since deleting
+	// rows from a corrupt index can fail.
+	if _, err := tx.Exec(`INSERT INTO zettel_fts(zettel_fts) VALUES('rebuild');`); err != nil {
+		return fmt.Errorf("Error rebuilding search index: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM zettel_fts;`); err != nil {
+		return fmt.Errorf("Error clearing search index: %v", err)
+	}
+	const query = `
+		INSERT INTO zettel_fts(rowid, title, body, tags)
+		SELECT z.id, z.title, z.body, ` + ftsTagsSQL + ` FROM zettel z;`
+	if _, err := tx.Exec(query); err != nil {
+		return fmt.Errorf("Error repopulating search index: %v", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO section_fts(section_fts) VALUES('rebuild');`); err != nil {
+		return fmt.Errorf("Error rebuilding section index: %v", err)
+	}
+	if _, err := tx.Exec(`DELETE FROM section_fts;`); err != nil {
+		return fmt.Errorf("Error clearing section index: %v", err)
+	}
+	const sectionQuery = `
+		INSERT INTO section_fts(rowid, title, body)
+		SELECT id, heading, body FROM section;`
+	if _, err := tx.Exec(sectionQuery); err != nil {
+		return fmt.Errorf("Error repopulating section index: %v", err)
+	}
+	if _, err := tx.Exec(`INSERT INTO word_fts(word_fts) VALUES('rebuild');`); err != nil {
+		return fmt.Errorf("Error rebuilding word index: %v", err)
+	}
+	return nil
+}
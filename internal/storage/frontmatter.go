@@ -0,0 +1,248 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/ericstrs/zet/internal/markdown"
+	"github.com/jmoiron/sqlx"
+)
+
+// Front matter keys with a meaning to zet. Other keys are stored as
+// they are.
+const (
+	MetaAliases = "aliases" // other titles the zettel goes by
+	MetaTags    = "tags"    // tags, in addition to the tag lines
+	MetaStatus  = "status"  // e.g. draft or done
+	MetaSource  = "source"  // where the idea came from, e.g. a URL
+	MetaCreated = "created" // creation date, e.g. 2024-01-31
+)
+
+// Meta is a key/value pair from the front matter of a zettel. A list
+// value is split into one Meta per item.
+type Meta struct {
+	Key   string `db:"key"`   // front matter key, e.g. `status`
+	Value string `db:"value"` // value or list item, e.g. `draft`
+	Line  int    `db:"line"`  // line the value is on
+}
+
+var (
+	// metaKeyRegex matches a top level front matter key and its value.
+	metaKeyRegex = regexp.MustCompile(`^([a-zA-Z_][\w-]*)\s*:(?:\s+(.*))?$`)
+	// metaItemRegex matches an item of a block list.
+	metaItemRegex = regexp.MustCompile(`^\s+-\s+(.*)$`)
+)
+
+// SplitFrontMatter splits content into the lines of its front matter
+// block and the rest of the content. Front matter is a block of YAML
+// at the very top of the content that starts with a `---` line and
+// ends with a `---` or `...` line. n is the number of lines taken up by
+// the block, including the delimiters, and is zero if there is none.
+func SplitFrontMatter(content string) (front []string, rest string, n int) {
+	lines := strings.Split(content, "\n")
+	n = markdown.FrontMatterLen(lines)
+	if n == 0 {
+		return nil, content, 0
+	}
+	return lines[1 : n-1], strings.Join(lines[n:], "\n"), n
+}
+
+// ParseFrontMatter returns the key/value pairs of the front matter
+// lines returned by SplitFrontMatter. Only the subset of YAML used for
+// metadata is understood: top level scalars, flow lists such as
+// `[a, b]` and block lists of `- item` lines. Keys are lower cased,
+// nested mappings are skipped and empty values are dropped. Line
+// numbers count the opening delimiter as line one.
+func ParseFrontMatter(front []string) []Meta {
+	var metas []Meta
+	key := ""
+	for i, line := range front {
+		n := i + 2
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, `#`) {
+			continue
+		}
+		if m := metaKeyRegex.FindStringSubmatch(line); m != nil {
+			key = strings.ToLower(m[1])
+			for _, v := range metaValues(m[2]) {
+				metas = append(metas, Meta{Key: key, Value: v, Line: n})
+			}
+			continue
+		}
+		if m := metaItemRegex.FindStringSubmatch(line); m != nil && key != "" {
+			if v := metaScalar(m[1]); v != "" {
+				metas = append(metas, Meta{Key: key, Value: v, Line: n})
+			}
+			continue
+		}
+		if !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			key = ""
+		}
+	}
+	return metas
+}
+
+// metaValues returns the values of a front matter value, which is
+// either a scalar or a flow list.
+func metaValues(s string) []string {
+	s = strings.TrimSpace(s)
+	if !strings.HasPrefix(s, `[`) {
+		if v := metaScalar(s); v != "" {
+			return []string{v}
+		}
+		return nil
+	}
+	s = strings.TrimPrefix(s, `[`)
+	if i := strings.LastIndex(s, `]`); i >= 0 {
+		s = s[:i]
+	}
+	var vs []string
+	for _, item := range splitFlow(s) {
+		if v := metaScalar(item); v != "" {
+			vs = append(vs, v)
+		}
+	}
+	return vs
+}
+
+// splitFlow splits the items of a flow list on commas outside of
+// quotes.
+func splitFlow(s string) []string {
+	var items []string
+	var quote rune
+	start := 0
+	for i, r := range s {
+		switch {
+		case quote != 0:
+			if r == quote {
+				quote = 0
+			}
+		case r == '"' || r == '\'':
+			quote = r
+		case r == ',':
+			items = append(items, s[start:i])
+			start = i + 1
+		}
+	}
+	return append(items, s[start:])
+}
+
+// metaScalar returns the value of a scalar with quotes and trailing
+// comments removed.
+func metaScalar(s string) string {
+	s = strings.TrimSpace(s)
+	if len(s) >= 2 && (s[0] == '"' || s[0] == '\'') {
+		if i := strings.IndexByte(s[1:], s[0]); i >= 0 {
+			return s[1 : i+1]
+		}
+	}
+	if strings.HasPrefix(s, `#`) {
+		return ""
+	}
+	if i := strings.Index(s, ` #`); i >= 0 {
+		s = s[:i]
+	}
+	s = strings.TrimSpace(s)
+	if s == `~` || s == `null` {
+		return ""
+	}
+	return s
+}
+
+// FrontMatterTags returns the tags listed in front matter. Tags may be
+// written with or without a leading `#` and a scalar value may hold
+// several tags separated by spaces.
+func FrontMatterTags(metas []Meta) []Tag {
+	var tags []Tag
+	for _, m := range metas {
+		if m.Key != MetaTags {
+			continue
+		}
+		for _, f := range strings.Fields(m.Value) {
+			name := NormalizeTag(strings.TrimPrefix(f, `#`))
+			if name != "" {
+				tags = append(tags, Tag{Name: name, Parent: TagParent(name), Line: m.Line})
+			}
+		}
+	}
+	return tags
+}
+
+// replaceMeta replaces the front matter rows of the zettel with the
+// given id.
+func replaceMeta(tx *sqlx.Tx, id int, metas []Meta) error {
+	if _, err := tx.Exec(`DELETE FROM zettel_meta WHERE zettel_id = $1;`, id); err != nil {
+		return fmt.Errorf("Error deleting front matter: %v", err)
+	}
+	const query = `
+		INSERT INTO zettel_meta (zettel_id, key, value, line)
+		VALUES ($1, $2, $3, $4);`
+	for _, m := range metas {
+		if _, err := tx.Exec(query, id, m.Key, m.Value, m.Line); err != nil {
+			return fmt.Errorf("Error inserting front matter: %v", err)
+		}
+	}
+	return nil
+}
+
+// ZettelMeta returns the front matter of the zettel with the given id,
+// in the order it was written.
+func (s *Storage) ZettelMeta(id int) ([]Meta, error) {
+	metas := []Meta{}
+	const query = `
+		SELECT key, value, line FROM zettel_meta
+		WHERE zettel_id = $1 ORDER BY line, id;`
+	if err := s.DB.Select(&metas, query, id); err != nil {
+		return nil, fmt.Errorf("Error getting front matter: %v", err)
+	}
+	return metas, nil
+}
+
+// metaFilter is a search term on the front matter of zettels.
+type metaFilter struct {
+	key    string
+	value  string
+	prefix bool // match any value starting with value
+}
+
+// metaTermRegex matches a front matter search term, e.g.
+// `status:draft`, `alias:golang`, `source:book*` or
+// `meta:project=zet`.
+var metaTermRegex = regexp.MustCompile(`^(?:(aliases|alias|status|source):|meta:([a-zA-Z_][\w-]*)=)([^\s*]+?)(\*)?$`)
+
+// parseMetaTerm returns the filter for a front matter search term. A
+// term ending in `*` matches values by prefix. Values are matched
+// without regard to case. It reports false if tok isn't a front matter
+// term.
+func parseMetaTerm(tok string) (metaFilter, bool) {
+	m := metaTermRegex.FindStringSubmatch(tok)
+	if m == nil {
+		return metaFilter{}, false
+	}
+	key := strings.ToLower(m[1] + m[2])
+	if key == `alias` {
+		key = MetaAliases
+	}
+	return metaFilter{
+		key:    key,
+		value:  m[3],
+		prefix: m[4] == "*",
+	}, true
+}
+
+func (f metaFilter) args() []any {
+	return []any{f.key, f.value}
+}
+
+// cond returns the condition for the filter on zettel z. The key and
+// value are bound to parameters n and n+1.
+func (f metaFilter) cond(n int) string {
+	cond := fmt.Sprintf(`lower(m.value) = lower($%d)`, n+1)
+	if f.prefix {
+		cond = fmt.Sprintf(`lower(substr(m.value, 1, length($%[1]d))) = lower($%[1]d)`, n+1)
+	}
+	return fmt.Sprintf(`z.id IN (
+							SELECT m.zettel_id FROM zettel_meta m
+							WHERE m.key = $%d AND %s)`, n, cond)
+}
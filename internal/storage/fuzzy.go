@@ -0,0 +1,249 @@
+package storage
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+)
+
+// Scores of fuzzy matches. A matched character scores more when it
+// starts a word or follows the previous match, and every character
+// skipped between two matches costs a little, so `zt` ranks `Zet tool`
+// above `Lazy tree`.
+const (
+	fuzzyMatchScore       = 16
+	fuzzyBoundaryBonus    = 8
+	fuzzyConsecutiveBonus = 8
+	fuzzyGapPenalty       = 1
+	// fuzzyTypoPenalty is what each typo of a word matched by edit
+	// distance costs.
+	fuzzyTypoPenalty = 12
+)
+
+// FuzzyZettels returns the zettels whose titles fuzzily match pattern,
+// best match first. Every word of pattern has to match the title,
+// either as a subsequence of its characters, e.g. `cnptl` for
+// `conceptual`, or as a title word with a typo or two, e.g. `lnking`
+// for `linking`. Matching ignores case. The before and after options
+// are wrapped around the matched characters of TitleSnippet and the
+// limit and offset options apply, while the others have no effect.
+func (s *Storage) FuzzyZettels(pattern string, opts SearchOptions) ([]ResultZettel, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	zettels, err := s.ZettelSummaries(`dir_name DESC`)
+	if err != nil {
+		return nil, err
+	}
+
+	type match struct {
+		z     ResultZettel
+		score int
+	}
+	var matches []match
+	for _, z := range zettels {
+		score, pos, ok := fuzzyMatch(pattern, z.Title)
+		if !ok {
+			continue
+		}
+		rz := ResultZettel{Zettel: z}
+		rz.TitleSnippet = highlightRunes(z.Title, pos, opts.Before, opts.After)
+		matches = append(matches, match{rz, score})
+	}
+	// Shorter titles win ties, as they are matched more closely.
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].score != matches[j].score {
+			return matches[i].score > matches[j].score
+		}
+		return len(matches[i].z.Title) < len(matches[j].z.Title)
+	})
+
+	results := []ResultZettel{}
+	for i, m := range matches {
+		if i < opts.Offset {
+			continue
+		}
+		if opts.Limit > 0 && len(results) == opts.Limit {
+			break
+		}
+		results = append(results, m.z)
+	}
+	return results, nil
+}
+
+// fuzzyMatch reports whether every word of pattern matches text and
+// returns the score of the match along with the positions of the
+// matched runes of text, in order.
+func fuzzyMatch(pattern, text string) (int, []int, bool) {
+	t := []rune(text)
+	lower := make([]rune, len(t))
+	for i, r := range t {
+		lower[i] = unicode.ToLower(r)
+	}
+
+	total := 0
+	matched := make(map[int]bool)
+	for _, w := range strings.Fields(pattern) {
+		word := []rune(strings.ToLower(w))
+		score, pos, ok := subsequenceMatch(word, lower)
+		if !ok {
+			score, pos, ok = typoMatch(word, lower)
+		}
+		if !ok {
+			return 0, nil, false
+		}
+		total += score
+		for _, p := range pos {
+			matched[p] = true
+		}
+	}
+
+	var pos []int
+	for p := range matched {
+		pos = append(pos, p)
+	}
+	sort.Ints(pos)
+	return total, pos, true
+}
+
+// subsequenceMatch finds the best scoring match of word as a
+// subsequence of text. Each place the first rune of word appears in
+// text is tried as a start.
+func subsequenceMatch(word, text []rune) (int, []int, bool) {
+	if len(word) == 0 {
+		return 0, nil, true
+	}
+	best, bestPos, found := 0, []int(nil), false
+	for start, r := range text {
+		if r != word[0] {
+			continue
+		}
+		pos := []int{start}
+		for i := start + 1; i < len(text) && len(pos) < len(word); i++ {
+			if text[i] == word[len(pos)] {
+				pos = append(pos, i)
+			}
+		}
+		if len(pos) < len(word) {
+			// No later start can match either.
+			break
+		}
+		if score := subsequenceScore(text, pos); !found || score > best {
+			best, bestPos, found = score, pos, true
+		}
+	}
+	return best, bestPos, found
+}
+
+// subsequenceScore returns the score of the runes of text at pos
+// matching a word.
+func subsequenceScore(text []rune, pos []int) int {
+	score := 0
+	for i, p := range pos {
+		score += fuzzyMatchScore
+		if p == 0 || !isWordRune(text[p-1]) {
+			score += fuzzyBoundaryBonus
+		}
+		if i > 0 {
+			if gap := p - pos[i-1] - 1; gap == 0 {
+				score += fuzzyConsecutiveBonus
+			} else {
+				score -= gap * fuzzyGapPenalty
+			}
+		}
+	}
+	return score
+}
+
+// typoMatch finds the word of text closest to word that is no more
+// than maxTypos edits away from it.
+func typoMatch(word, text []rune) (int, []int, bool) {
+	max := maxTypos(len(word))
+	if max == 0 {
+		return 0, nil, false
+	}
+	best, bestPos, found := 0, []int(nil), false
+	for start := 0; start < len(text); {
+		if !isWordRune(text[start]) {
+			start++
+			continue
+		}
+		end := start
+		for end < len(text) && isWordRune(text[end]) {
+			end++
+		}
+		if d := editDistance(word, text[start:end]); d <= max {
+			score := len(word)*fuzzyMatchScore - d*fuzzyTypoPenalty
+			if !found || score > best {
+				best, bestPos, found = score, nil, true
+				for i := start; i < end; i++ {
+					bestPos = append(bestPos, i)
+				}
+			}
+		}
+		start = end
+	}
+	return best, bestPos, found
+}
+
+// maxTypos returns the number of typos allowed in a word of n runes.
+// Words too short to tell apart from others allow none.
+func maxTypos(n int) int {
+	switch {
+	case n < 4:
+		return 0
+	case n < 7:
+		return 1
+	}
+	return 2
+}
+
+// editDistance returns the Levenshtein distance between a and b.
+func editDistance(a, b []rune) int {
+	prev := make([]int, len(b)+1)
+	curr := make([]int, len(b)+1)
+	for j := range prev {
+		prev[j] = j
+	}
+	for i := 1; i <= len(a); i++ {
+		curr[0] = i
+		for j := 1; j <= len(b); j++ {
+			cost := 1
+			if a[i-1] == b[j-1] {
+				cost = 0
+			}
+			curr[j] = min(prev[j]+1, curr[j-1]+1, prev[j-1]+cost)
+		}
+		prev, curr = curr, prev
+	}
+	return prev[len(b)]
+}
+
+// isWordRune reports whether r is part of a word.
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+// highlightRunes wraps each run of consecutive runes of s at pos in
+// before and after.
+func highlightRunes(s string, pos []int, before, after string) string {
+	if len(pos) == 0 || (before == "" && after == "") {
+		return s
+	}
+	hl := make(map[int]bool, len(pos))
+	for _, p := range pos {
+		hl[p] = true
+	}
+	var b strings.Builder
+	r := []rune(s)
+	for i := range r {
+		if hl[i] && (i == 0 || !hl[i-1]) {
+			b.WriteString(before)
+		}
+		b.WriteRune(r[i])
+		if hl[i] && (i == len(r)-1 || !hl[i+1]) {
+			b.WriteString(after)
+		}
+	}
+	return b.String()
+}
@@ -0,0 +1,140 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"regexp"
+	"time"
+)
+
+// maxHistory is the number of searches kept in the history of a user.
+const maxHistory = 1000
+
+// ErrNoSavedSearch is returned for a saved search that doesn't exist.
+var ErrNoSavedSearch = errors.New("no such saved search")
+
+// savedNameRegex matches a valid saved search name.
+var savedNameRegex = regexp.MustCompile(`^[\w-]+$`)
+
+// HistoryUser is the user the search history is kept for. It defaults
+// to the name of the current user.
+var HistoryUser = currentUser()
+
+// currentUser returns the name of the current user.
+func currentUser() string {
+	if u, err := user.Current(); err == nil && u.Username != "" {
+		return u.Username
+	}
+	return os.Getenv("USER")
+}
+
+// SavedSearch is a search query saved under a name to be run again.
+type SavedSearch struct {
+	Name    string `db:"name"`    // name, e.g. `drafts`
+	Query   string `db:"query"`   // query, e.g. `tag:draft modified:<7d`
+	Created string `db:"created"` // time the search was saved
+}
+
+// SaveSearch saves the query under name, replacing any search saved
+// under the same name. Names are made of letters, digits, hyphens and
+// underscores. The query has to be valid, see ParseQuery.
+func (s *Storage) SaveSearch(name, query string) error {
+	if !savedNameRegex.MatchString(name) {
+		return fmt.Errorf("Invalid saved search name %q: use letters, digits, - and _", name)
+	}
+	if _, err := ParseQuery(query); err != nil {
+		return err
+	}
+	const q = `
+		INSERT INTO saved_search (name, query, created) VALUES ($1, $2, $3)
+		ON CONFLICT(name) DO UPDATE SET query = excluded.query, created = excluded.created;`
+	if _, err := s.DB.Exec(q, name, query, time.Now().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("Error saving search: %v", err)
+	}
+	return nil
+}
+
+// SavedSearch returns the search saved under name, or an error wrapping
+// ErrNoSavedSearch if there is none.
+func (s *Storage) SavedSearch(name string) (SavedSearch, error) {
+	var ss SavedSearch
+	err := s.DB.Get(&ss, `SELECT name, query, created FROM saved_search WHERE name = $1;`, name)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ss, fmt.Errorf("%w: %s", ErrNoSavedSearch, name)
+	}
+	if err != nil {
+		return ss, fmt.Errorf("Error getting saved search: %v", err)
+	}
+	return ss, nil
+}
+
+// SavedSearches returns every saved search ordered by name.
+func (s *Storage) SavedSearches() ([]SavedSearch, error) {
+	searches := []SavedSearch{}
+	const q = `SELECT name, query, created FROM saved_search ORDER BY name;`
+	if err := s.DB.Select(&searches, q); err != nil {
+		return nil, fmt.Errorf("Error getting saved searches: %v", err)
+	}
+	return searches, nil
+}
+
+// AddHistory adds a query to the search history of HistoryUser. A query
+// that is the same as the last one isn't added again, and only the
+// latest maxHistory queries are kept.
+func (s *Storage) AddHistory(query string) error {
+	if query == "" {
+		return nil
+	}
+	var last string
+	const lastQuery = `
+		SELECT query FROM search_history WHERE user = $1
+		ORDER BY id DESC LIMIT 1;`
+	err := s.DB.Get(&last, lastQuery, HistoryUser)
+	if err == nil && last == query {
+		return nil
+	}
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		return fmt.Errorf("Error getting search history: %v", err)
+	}
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("Failed to create transaction: %v", err)
+	}
+	defer tx.Rollback()
+	const insert = `
+		INSERT INTO search_history (user, query, searched_at) VALUES ($1, $2, $3);`
+	if _, err := tx.Exec(insert, HistoryUser, query, time.Now().Format(time.RFC3339)); err != nil {
+		return fmt.Errorf("Error adding to search history: %v", err)
+	}
+	const trim = `
+		DELETE FROM search_history WHERE user = $1 AND id NOT IN (
+			SELECT id FROM search_history WHERE user = $1
+			ORDER BY id DESC LIMIT $2);`
+	if _, err := tx.Exec(trim, HistoryUser, maxHistory); err != nil {
+		return fmt.Errorf("Error trimming search history: %v", err)
+	}
+	return tx.Commit()
+}
+
+// SearchHistory returns the distinct queries in the search history of
+// HistoryUser, latest first. A limit of 0 returns all of them.
+func (s *Storage) SearchHistory(limit int) ([]string, error) {
+	queries := []string{}
+	q := `
+		SELECT query FROM search_history WHERE user = $1
+		GROUP BY query
+		ORDER BY MAX(id) DESC`
+	args := []any{HistoryUser}
+	if limit > 0 {
+		q += ` LIMIT $2`
+		args = append(args, limit)
+	}
+	if err := s.DB.Select(&queries, q+`;`, args...); err != nil {
+		return nil, fmt.Errorf("Error getting search history: %v", err)
+	}
+	return queries, nil
+}
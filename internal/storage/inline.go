@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"regexp"
+	"strings"
+
+	"github.com/ericstrs/zet/internal/markdown"
+)
+
+// InlineTags reports whether hashtags written inline in body text, e.g.
+// `an #idea worth keeping`, count as tags in addition to the ones on
+// indented tag lines. It holds the inline-tags setting of the database
+// last opened or synced, which is changed with SetSetting.
+var InlineTags bool
+
+var (
+	// inlineTagRegex matches a hashtag that starts a word.
+	inlineTagRegex = regexp.MustCompile(`(^|[\s(\[{>*_~"'])#([a-zA-Z][\w/-]*)`)
+	// inlineCodeRegex matches a code span.
+	inlineCodeRegex = regexp.MustCompile("`+[^`]*`+")
+	// urlRegex matches a URL or the target of a markdown link.
+	urlRegex = regexp.MustCompile(`[a-zA-Z][a-zA-Z0-9+.-]*://\S+|\]\([^)]*\)|<[^>]*>`)
+)
+
+// ParseInlineTags returns the hashtags written inline in content along
+// with the line (starting at one) and column (starting at one) they
+// were found at. Only text lines as told by markdown.Parse are looked
+// at, so front matter, headings, tag lines, link lines and code blocks
+// are skipped, and so are code spans and URLs. Each tag is only
+// returned for its first occurrence.
+func ParseInlineTags(content string) []Tag {
+	var tags []Tag
+	seen := make(map[string]bool)
+	for _, l := range markdown.Parse(content) {
+		if l.Kind != markdown.Text {
+			continue
+		}
+		line := l.Text
+
+		// Blank out the parts that can't hold tags so columns still
+		// line up with the original line.
+		masked := line
+		for _, re := range []*regexp.Regexp{inlineCodeRegex, urlRegex} {
+			masked = re.ReplaceAllStringFunc(masked, func(s string) string {
+				return strings.Repeat(" ", len(s))
+			})
+		}
+
+		for _, m := range inlineTagRegex.FindAllStringSubmatchIndex(masked, -1) {
+			name := NormalizeTag(strings.TrimRight(masked[m[4]:m[5]], "-"))
+			if name == "" || seen[name] {
+				continue
+			}
+			seen[name] = true
+			tags = append(tags, Tag{
+				Name:   name,
+				Parent: TagParent(name),
+				Line:   l.Num,
+				Col:    m[4], // one past the index of the #
+			})
+		}
+	}
+	return tags
+}
+
+// mergeTags returns the tags in a followed by the tags in b that aren't
+// in a.
+func mergeTags(a, b []Tag) []Tag {
+	seen := make(map[string]bool, len(a))
+	for _, t := range a {
+		seen[t.Name] = true
+	}
+	for _, t := range b {
+		if !seen[t.Name] {
+			seen[t.Name] = true
+			a = append(a, t)
+		}
+	}
+	return a
+}
@@ -0,0 +1,112 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+)
+
+// BrokenLink is a link whose target zettel couldn't be found, along
+// with the zettel the link lives in.
+type BrokenLink struct {
+	Link
+	FromDir  string `db:"from_dir"`  // directory name of source zettel
+	FromName string `db:"from_name"` // file name of source zettel
+}
+
+// BrokenLinks returns all links pointing to zettels that don't exist,
+// ordered by source zettel and line.
+func (s *Storage) BrokenLinks() ([]BrokenLink, error) {
+	links := []BrokenLink{}
+	const query = `
+		SELECT u.id, u.content, u.from_zettel_id, u.to_dir, u.line, u.col, u.kind, u.type, u.context, u.anchor,
+			z.dir_name AS from_dir, z.name AS from_name
+		FROM unresolved_link u
+		JOIN zettel z ON z.id = u.from_zettel_id
+		ORDER BY z.dir_name, z.name, u.line, u.col;`
+	if err := s.DB.Select(&links, query); err != nil {
+		return nil, fmt.Errorf("Error getting broken links: %v", err)
+	}
+	return links, nil
+}
+
+// Backlink is a link pointing to a zettel, along with the zettel the
+// link lives in.
+type Backlink struct {
+	Link
+	FromDir   string `db:"from_dir"`   // directory name of source zettel
+	FromName  string `db:"from_name"`  // file name of source zettel
+	FromTitle string `db:"from_title"` // title of source zettel
+}
+
+// Backlinks returns all links pointing to the zettel with the given
+// id, ordered by source zettel and line.
+func (s *Storage) Backlinks(id int) ([]Backlink, error) {
+	links := []Backlink{}
+	const query = `
+		SELECT l.id, l.content, l.from_zettel_id, l.to_zettel_id, l.line, l.col, l.kind, l.type, l.context, l.anchor,
+			z.dir_name AS from_dir, z.name AS from_name, z.title AS from_title
+		FROM link l
+		JOIN zettel z ON z.id = l.from_zettel_id
+		WHERE l.to_zettel_id = $1
+		ORDER BY z.dir_name, z.name, l.line, l.col;`
+	if err := s.DB.Select(&links, query, id); err != nil {
+		return nil, fmt.Errorf("Error getting backlinks: %v", err)
+	}
+	return links, nil
+}
+
+// AllLinks returns every link between zettels.
+func (s *Storage) AllLinks() ([]Link, error) {
+	links := []Link{}
+	const query = `SELECT * FROM link ORDER BY from_zettel_id, line, col;`
+	if err := s.DB.Select(&links, query); err != nil {
+		return nil, fmt.Errorf("Error getting links: %v", err)
+	}
+	return links, nil
+}
+
+// StaleLink is a link whose text no longer matches the title of the
+// zettel it points to.
+type StaleLink struct {
+	Backlink
+	ToTitle string `db:"to_title"` // current title of target zettel
+}
+
+// linkTitleRegex matches the title of a zettel link.
+var linkTitleRegex = regexp.MustCompile(`^\[.+?\]\(\.\./.*?/?\) (.+)$`)
+
+// LinkTitle returns the title a zettel link carries.
+func LinkTitle(content string) string {
+	m := linkTitleRegex.FindStringSubmatch(content)
+	if m == nil {
+		return ""
+	}
+	return m[1]
+}
+
+// StaleLinks returns all link lines whose title differs from the
+// current title of the zettel they point to, ordered by source zettel
+// and line. Wiki and inline links carry a label of their own rather
+// than the title, so they are never stale.
+func (s *Storage) StaleLinks() ([]StaleLink, error) {
+	links := []StaleLink{}
+	const query = `
+		SELECT l.id, l.content, l.from_zettel_id, l.to_zettel_id, l.line, l.col, l.kind, l.type, l.context, l.anchor,
+			f.dir_name AS from_dir, f.name AS from_name, f.title AS from_title,
+			t.dir_name AS to_dir, t.title AS to_title
+		FROM link l
+		JOIN zettel f ON f.id = l.from_zettel_id
+		JOIN zettel t ON t.id = l.to_zettel_id
+		WHERE l.kind = 'line'
+		ORDER BY f.dir_name, f.name, l.line, l.col;`
+	if err := s.DB.Select(&links, query); err != nil {
+		return nil, fmt.Errorf("Error getting links: %v", err)
+	}
+	stale := links[:0]
+	for _, l := range links {
+		if LinkTitle(l.Content) != l.ToTitle {
+			stale = append(stale, l)
+		}
+	}
+	return stale, nil
+}
@@ -0,0 +1,317 @@
+package storage
+
+import (
+	"fmt"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Migration is a single, ordered change to the database schema. The
+// schema version of a database is kept in its user_version pragma and
+// equals the version of the last migration applied to it.
+type Migration struct {
+	Version     int    // schema version after the migration is applied
+	Description string // short summary of the change
+
+	up func(tx *sqlx.Tx) error
+}
+
+// migrations lists every schema change in the order they are applied.
+// Migrations must never be edited or reordered once released; changes
+// to the schema are made by appending a new migration.
+//
+// Databases created before migrations were introduced have a
+// user_version of zero but may already contain some of the changes
+// below, so every migration has to tolerate that.
+var migrations = []Migration{
+	{
+		Version:     1,
+		Description: "create zettel, link, tag and full text search tables",
+		up: func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(tablesSQL)
+			return err
+		},
+	},
+	{
+		Version:     2,
+		Description: "add content hash and size to zettel",
+		up: func(tx *sqlx.Tx) error {
+			if err := addColumn(tx, `zettel`, `hash`, `TEXT NOT NULL DEFAULT ''`); err != nil {
+				return err
+			}
+			return addColumn(tx, `zettel`, `size`, `INTEGER NOT NULL DEFAULT 0`)
+		},
+	},
+	{
+		Version:     3,
+		Description: "add line to link and create unresolved_link",
+		up: func(tx *sqlx.Tx) error {
+			if err := addColumn(tx, `link`, `line`, `INTEGER NOT NULL DEFAULT 0`); err != nil {
+				return err
+			}
+			_, err := tx.Exec(unresolvedLinkSQL)
+			return err
+		},
+	},
+	{
+		Version:     4,
+		Description: "add parent to tag for hierarchical tags",
+		up: func(tx *sqlx.Tx) error {
+			if err := addColumn(tx, `tag`, `parent`, `TEXT NOT NULL DEFAULT ''`); err != nil {
+				return err
+			}
+			var tags []Tag
+			if err := tx.Select(&tags, `SELECT id, name FROM tag`); err != nil {
+				return err
+			}
+			for _, t := range tags {
+				if _, err := tx.Exec(`UPDATE tag SET parent = $1 WHERE id = $2`, TagParent(t.Name), t.ID); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		Version:     5,
+		Description: "add line to zettel_tags and create setting",
+		up: func(tx *sqlx.Tx) error {
+			if err := addColumn(tx, `zettel_tags`, `line`, `INTEGER NOT NULL DEFAULT 0`); err != nil {
+				return err
+			}
+			_, err := tx.Exec(settingSQL)
+			return err
+		},
+	},
+	{
+		Version:     6,
+		Description: "create zettel_meta for front matter",
+		up: func(tx *sqlx.Tx) error {
+			if _, err := tx.Exec(zettelMetaSQL); err != nil {
+				return err
+			}
+			// Front matter used to end up in the body, so every zettel is
+			// parsed again on the next sync.
+			_, err := tx.Exec(`UPDATE zettel SET hash = ''`)
+			return err
+		},
+	},
+	{
+		Version:     7,
+		Description: "add kind to link and unresolved_link for wiki and inline links",
+		up: func(tx *sqlx.Tx) error {
+			if err := addColumn(tx, `link`, `kind`, `TEXT NOT NULL DEFAULT 'line'`); err != nil {
+				return err
+			}
+			if err := addColumn(tx, `unresolved_link`, `kind`, `TEXT NOT NULL DEFAULT 'line'`); err != nil {
+				return err
+			}
+			// Wiki and inline links used to be skipped, so every zettel is
+			// parsed again on the next sync.
+			_, err := tx.Exec(`UPDATE zettel SET hash = ''`)
+			return err
+		},
+	},
+	{
+		Version:     8,
+		Description: "add type and context to link and unresolved_link",
+		up: func(tx *sqlx.Tx) error {
+			for _, table := range []string{`link`, `unresolved_link`} {
+				if err := addColumn(tx, table, `type`, `TEXT NOT NULL DEFAULT 'see-also'`); err != nil {
+					return err
+				}
+				if err := addColumn(tx, table, `context`, `TEXT NOT NULL DEFAULT ''`); err != nil {
+					return err
+				}
+			}
+			// Every zettel is parsed again on the next sync to find the type
+			// and context of its links.
+			_, err := tx.Exec(`UPDATE zettel SET hash = ''`)
+			return err
+		},
+	},
+	{
+		Version:     9,
+		Description: "create section and add anchor to link and unresolved_link",
+		up: func(tx *sqlx.Tx) error {
+			if _, err := tx.Exec(sectionSQL); err != nil {
+				return err
+			}
+			for _, table := range []string{`link`, `unresolved_link`} {
+				if err := addColumn(tx, table, `anchor`, `TEXT NOT NULL DEFAULT ''`); err != nil {
+					return err
+				}
+			}
+			// Every zettel is parsed again on the next sync to find its
+			// sections and the anchors its links point to.
+			_, err := tx.Exec(`UPDATE zettel SET hash = ''`)
+			return err
+		},
+	},
+	{
+		Version:     10,
+		Description: "add words to zettel",
+		up: func(tx *sqlx.Tx) error {
+			if err := addColumn(tx, `zettel`, `words`, `INTEGER NOT NULL DEFAULT 0`); err != nil {
+				return err
+			}
+			// Every zettel is parsed again on the next sync to count its
+			// words.
+			_, err := tx.Exec(`UPDATE zettel SET hash = ''`)
+			return err
+		},
+	},
+	{
+		Version:     11,
+		Description: "rebuild search indexes with the configured tokenizer",
+		up: func(tx *sqlx.Tx) error {
+			name, err := settingValue(tx, settings[SettingTokenizer])
+			if err != nil {
+				return err
+			}
+			return rebuildSearchIndexes(tx, name)
+		},
+	},
+	{
+		Version:     12,
+		Description: "create word_fts and word_vocab for spelling suggestions",
+		up: func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(wordSQL)
+			return err
+		},
+	},
+	{
+		Version:     13,
+		Description: "create saved_search and search_history",
+		up: func(tx *sqlx.Tx) error {
+			_, err := tx.Exec(searchSQL)
+			return err
+		},
+	},
+	{
+		Version:     14,
+		Description: "add col to zettel_tags",
+		up: func(tx *sqlx.Tx) error {
+			if err := addColumn(tx, `zettel_tags`, `col`, `INTEGER NOT NULL DEFAULT 0`); err != nil {
+				return err
+			}
+			// Every zettel is parsed again on the next sync to record the
+			// column of its tags.
+			_, err := tx.Exec(`UPDATE zettel SET hash = ''`)
+			return err
+		},
+	},
+	{
+		Version:     15,
+		Description: "key link and unresolved_link on line and col",
+		up: func(tx *sqlx.Tx) error {
+			if _, err := tx.Exec(linkKeySQL); err != nil {
+				return err
+			}
+			// Every zettel is parsed again on the next sync to store each
+			// occurrence of a repeated link.
+			_, err := tx.Exec(`UPDATE zettel SET hash = ''`)
+			return err
+		},
+	},
+}
+
+// addColumn adds a column to a table unless the table already has it.
+func addColumn(tx *sqlx.Tx, table, name, def string) error {
+	var n int
+	const query = `SELECT COUNT(*) FROM pragma_table_info($1) WHERE name = $2`
+	if err := tx.Get(&n, query, table, name); err != nil {
+		return fmt.Errorf("Error reading %s columns: %v", table, err)
+	}
+	if n > 0 {
+		return nil
+	}
+	stmt := fmt.Sprintf(`ALTER TABLE %s ADD COLUMN %s %s`, table, name, def)
+	if _, err := tx.Exec(stmt); err != nil {
+		return fmt.Errorf("Error adding %s column: %v", name, err)
+	}
+	return nil
+}
+
+// schemaVersion returns the schema version of the database.
+func schemaVersion(db *sqlx.DB) (int, error) {
+	var v int
+	if err := db.Get(&v, `PRAGMA user_version`); err != nil {
+		return 0, fmt.Errorf("Error reading schema version: %v", err)
+	}
+	return v, nil
+}
+
+// pendingMigrations returns the migrations that haven't been applied to
+// the database yet.
+func pendingMigrations(db *sqlx.DB) ([]Migration, error) {
+	v, err := schemaVersion(db)
+	if err != nil {
+		return nil, err
+	}
+	if v > migrations[len(migrations)-1].Version {
+		return nil, fmt.Errorf("database schema version %d is newer than this version of zet supports", v)
+	}
+	var pending []Migration
+	for _, m := range migrations {
+		if m.Version > v {
+			pending = append(pending, m)
+		}
+	}
+	return pending, nil
+}
+
+// migrate applies all pending migrations to the database. Each migration
+// runs in its own transaction together with the schema version bump, so
+// a failed migration leaves the database at the previous version. It
+// returns the migrations that were applied.
+func migrate(db *sqlx.DB) ([]Migration, error) {
+	pending, err := pendingMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+	var applied []Migration
+	for _, m := range pending {
+		tx, err := db.Beginx()
+		if err != nil {
+			return applied, fmt.Errorf("Failed to create transaction: %v", err)
+		}
+		if err := m.up(tx); err != nil {
+			tx.Rollback()
+			return applied, fmt.Errorf("Failed migration %d (%s): %v", m.Version, m.Description, err)
+		}
+		// The pragma doesn't accept bound parameters.
+		if _, err := tx.Exec(fmt.Sprintf(`PRAGMA user_version = %d`, m.Version)); err != nil {
+			tx.Rollback()
+			return applied, fmt.Errorf("Failed to set schema version %d: %v", m.Version, err)
+		}
+		if err := tx.Commit(); err != nil {
+			return applied, fmt.Errorf("Failed to commit migration %d: %v", m.Version, err)
+		}
+		applied = append(applied, m)
+	}
+	return applied, nil
+}
+
+// MigrateDB brings the database at dbPath up to the latest schema
+// version and returns the migrations it applied along with the schema
+// version it started from. If dryRun is true, the pending migrations are
+// returned without being applied.
+func MigrateDB(dbPath string, dryRun bool) ([]Migration, int, error) {
+	db, err := sqlx.Connect("sqlite", dbPath)
+	if err != nil {
+		return nil, 0, fmt.Errorf("Failed to connect to database: %v", err)
+	}
+	defer db.Close()
+
+	v, err := schemaVersion(db)
+	if err != nil {
+		return nil, 0, err
+	}
+	if dryRun {
+		pending, err := pendingMigrations(db)
+		return pending, v, err
+	}
+	applied, err := migrate(db)
+	return applied, v, err
+}
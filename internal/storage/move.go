@@ -0,0 +1,66 @@
+package storage
+
+import (
+	"fmt"
+	"path/filepath"
+)
+
+// MoveZettel records that the zettel directory oldName was renamed to
+// newName. The directories in dirs hold files whose links were edited
+// to follow the rename and are synced again. Everything happens in a
+// single transaction.
+func (s *Storage) MoveZettel(zetPath, oldName, newName string, dirs []string) error {
+	zm := make(map[string]map[string]Zettel)
+	for _, d := range append([]string{oldName}, dirs...) {
+		key := d
+		if d == oldName {
+			key = newName
+		}
+		if _, ok := zm[key]; ok {
+			continue
+		}
+		dm, err := s.dirZettelsMap(d)
+		if err != nil {
+			return fmt.Errorf("Failed to get zettels: %v", err)
+		}
+		zm[key] = make(map[string]Zettel)
+		for name, z := range dm[d] {
+			z.DirName = key
+			// The files were edited just now, possibly within the same
+			// second as the last sync, so always hash them again.
+			z.Hash = ""
+			zm[key][name] = z
+		}
+	}
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("Failed to create transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	if err := insertDir(tx, newName); err != nil {
+		return fmt.Errorf("Failed to insert directory: %v", err)
+	}
+	const (
+		moveQuery   = `UPDATE zettel SET dir_name = $1 WHERE dir_name = $2;`
+		deleteQuery = `DELETE FROM dir WHERE name = $1;`
+	)
+	if _, err := tx.Exec(moveQuery, newName, oldName); err != nil {
+		return fmt.Errorf("Failed to move zettels: %v", err)
+	}
+	if _, err := tx.Exec(deleteQuery, oldName); err != nil {
+		return fmt.Errorf("Failed to delete directory: %v", err)
+	}
+
+	for d := range zm {
+		if err := processFiles(tx, filepath.Join(zetPath, d), zm); err != nil {
+			return err
+		}
+	}
+	if err := resolveLinks(tx); err != nil {
+		return fmt.Errorf("Failed to resolve links: %v", err)
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,820 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// Query is a parsed search query. Filters are terms matched against
+// tables other than the search index, such as `tag:go` or
+// `created:>2024-01`, and everything else is passed on to the search
+// index.
+type Query struct {
+	Text    string   // full text search part, in FTS5 syntax
+	Filters []string // filter terms and groups as written, e.g. `-tag:draft`
+
+	filters []searchFilter
+	section string // Text for the section index, see sectionFTS
+}
+
+var (
+	// ErrQuerySyntax is the error wrapped by every error about a search
+	// query that can't be understood.
+	ErrQuerySyntax = errors.New("invalid search query")
+	// ErrSearchOptions is the error wrapped by every error about
+	// search options that can't be used.
+	ErrSearchOptions = errors.New("invalid search options")
+)
+
+// QueryError is a problem with a search query. It wraps ErrQuerySyntax.
+type QueryError struct {
+	Term string // offending term, if any
+	Msg  string // what is wrong with it
+}
+
+func (e *QueryError) Error() string {
+	if e.Term == "" {
+		return e.Msg
+	}
+	return fmt.Sprintf("%s: %s", e.Term, e.Msg)
+}
+
+func (e *QueryError) Unwrap() error {
+	return ErrQuerySyntax
+}
+
+var (
+	// filterTermRegex matches a search term made of a key and a value,
+	// e.g. `tag:go` or `-created:>2024-01`.
+	filterTermRegex = regexp.MustCompile(`^(-?)([a-zA-Z][\w-]*|#):(.*)$`)
+	// comparisonRegex matches a value compared with an operator, e.g.
+	// `>300` or `<=2024-01`.
+	comparisonRegex = regexp.MustCompile(`^(>=|<=|>|<|=)?(.*)$`)
+	// durationRegex matches a duration back from now, e.g. `7d`.
+	durationRegex = regexp.MustCompile(`^(\d+)([hdwmy])$`)
+)
+
+// ftsColumns maps the columns of the search index and their aliases to
+// the column names.
+var ftsColumns = map[string]string{
+	`title`: `title`,
+	`t`:     `title`,
+	`body`:  `body`,
+	`b`:     `body`,
+	`tags`:  `tags`,
+	`#`:     `tags`,
+}
+
+// hasConds holds the conditions of `has:` filters.
+var hasConds = map[string]string{
+	`links`:     `EXISTS (SELECT 1 FROM link l WHERE l.from_zettel_id = z.id)`,
+	`backlinks`: `EXISTS (SELECT 1 FROM link l WHERE l.to_zettel_id = z.id AND l.from_zettel_id != z.id)`,
+	`broken`:    `EXISTS (SELECT 1 FROM unresolved_link u WHERE u.from_zettel_id = z.id)`,
+	`tags`:      `EXISTS (SELECT 1 FROM zettel_tags zt WHERE zt.zettel_id = z.id)`,
+	`meta`:      `EXISTS (SELECT 1 FROM zettel_meta m WHERE m.zettel_id = z.id)`,
+}
+
+const (
+	// orphanCond is the condition for zettels without links to or from
+	// other zettels.
+	orphanCond = `NOT EXISTS (
+							SELECT 1 FROM link l
+							WHERE (l.from_zettel_id = z.id OR l.to_zettel_id = z.id)
+								AND l.from_zettel_id != l.to_zettel_id)`
+	// createdExpr is the creation time of zettel z as YYYYMMDDhhmmss. It
+	// is the created date of its front matter, if any, and the isosec
+	// of its directory otherwise.
+	createdExpr = `COALESCE((
+							SELECT substr(replace(replace(replace(replace(m.value, '-', ''), ':', ''), 'T', ''), ' ', '')
+								|| '00000000000000', 1, 14)
+							FROM zettel_meta m WHERE m.zettel_id = z.id AND m.key = 'created' LIMIT 1
+						), substr(z.dir_name || '00000000000000', 1, 14))`
+	// modifiedExpr is the modification time of zettel z as
+	// YYYYMMDDhhmmss in local time.
+	modifiedExpr = `strftime('%Y%m%d%H%M%S', z.mtime, 'localtime')`
+	// timeKey formats times the way createdExpr and modifiedExpr do.
+	timeKey = `20060102150405`
+)
+
+// ParseQuery parses a search query. Terms are separated by spaces
+// outside of quotes and parentheses. A term of the form `key:value` is a
+// filter, unless the key is a column of the search index: title (t),
+// body (b) or tags (#). Terms are joined with AND, which may be left
+// out, and OR, and grouped with parentheses. NOT or a `-` prefix
+// excludes the zettels a term or group matches, e.g. `-tag:draft` or
+// `go -(tag:draft OR orphan:true)`. Terms the search index can match on
+// their own make up Text, and everything else, such as a group mixing
+// terms with filters, becomes a filter. The following filters are
+// understood:
+//
+//	tag:<tag>, tags:<tag>      tagged with tag, see parseTagTerm
+//	status:, source:, alias:   front matter values, see parseMetaTerm
+//	meta:<key>=<value>         any front matter value
+//	created:<date>             created in, before or after a date
+//	modified:<date>            modified in, before or after a date
+//	links-to:<isosec>          links to the zettel
+//	linked-from:<isosec>       linked from the zettel
+//	has:<what>                 has links, backlinks, broken links, tags or meta
+//	orphan:<bool>              has no links to or from other zettels
+//	words:<n>                  body has more, fewer or exactly n words
+//
+// Dates take the form YYYY, YYYY-MM or YYYY-MM-DD, or a duration back
+// from now such as 12h, 7d, 2w, 3m or 1y, and numbers and dates may be
+// compared with >, >=, < or <=, e.g. `created:>2024-01` for zettels
+// created after January 2024 or `modified:<7d` for zettels modified
+// less than seven days ago.
+func ParseQuery(q string) (Query, error) {
+	return parseQuery(q, time.Now())
+}
+
+// parseQuery is ParseQuery with durations counted back from now.
+func parseQuery(q string, now time.Time) (Query, error) {
+	var pq Query
+	toks, err := lexQuery(q)
+	if err != nil {
+		return pq, err
+	}
+	p := &queryParser{toks: toks, now: now}
+	root, err := p.parseOr()
+	if err != nil {
+		return pq, err
+	}
+	if p.i < len(p.toks) {
+		// Only a ) can stop the parser before the end.
+		return pq, &QueryError{Msg: "unexpected )"}
+	}
+
+	var conjuncts []queryNode
+	switch n := root.(type) {
+	case nil:
+	case andNode:
+		conjuncts = n
+	default:
+		conjuncts = []queryNode{n}
+	}
+	// Terms the search index can match on its own go to Text to be
+	// ranked and highlighted, and everything else becomes a filter.
+	var text []queryNode
+	positive := false
+	for _, c := range conjuncts {
+		if _, ok := c.fts(); ok {
+			positive = true
+		}
+	}
+	for _, c := range conjuncts {
+		if positive && ftsConjunct(c) {
+			text = append(text, c)
+			continue
+		}
+		pq.Filters = append(pq.Filters, group(c, c.String(), true))
+		pq.filters = append(pq.filters, compileNode(c))
+	}
+	pq.Text, _ = ftsAnd(text)
+	pq.section, _ = sectionAnd(text)
+	return pq, nil
+}
+
+// lexQuery splits a query into terms and the parentheses of groups.
+// Spaces inside quotes don't separate terms, and neither do spaces
+// inside parentheses that are part of a term, such as `title:(a b)` or
+// `NEAR(a b)`. A group excluded with `-` starts with a `-(` token.
+func lexQuery(q string) ([]string, error) {
+	var toks []string
+	var b strings.Builder
+	flush := func() {
+		if b.Len() > 0 {
+			toks = append(toks, b.String())
+			b.Reset()
+		}
+	}
+	quoted := false
+	depth := 0
+	for _, r := range q {
+		switch {
+		case quoted:
+			quoted = r != '"'
+		case r == '"':
+			quoted = true
+		case depth > 0 && r == '(':
+			depth++
+		case depth > 0 && r == ')':
+			depth--
+		case depth > 0:
+		case r == '(' && (b.Len() == 0 || b.String() == `-`):
+			toks = append(toks, b.String()+`(`)
+			b.Reset()
+			continue
+		case r == '(':
+			depth++
+		case r == ')':
+			flush()
+			toks = append(toks, `)`)
+			continue
+		case unicode.IsSpace(r):
+			flush()
+			continue
+		}
+		b.WriteRune(r)
+	}
+	if quoted {
+		return nil, &QueryError{Msg: `missing closing "`}
+	}
+	if depth > 0 {
+		return nil, &QueryError{Msg: "missing )"}
+	}
+	flush()
+	return toks, nil
+}
+
+// queryParser parses the terms of a query into a tree of queryNodes.
+// OR binds looser than AND, which is implied between terms, and NOT
+// and `-` apply to the term or group that follows.
+type queryParser struct {
+	toks []string
+	i    int
+	now  time.Time
+}
+
+// peek returns the next token, or an empty string at the end.
+func (p *queryParser) peek() string {
+	if p.i < len(p.toks) {
+		return p.toks[p.i]
+	}
+	return ""
+}
+
+// operand checks that the operator op just read is followed by a term.
+func (p *queryParser) operand(op string) *QueryError {
+	switch p.peek() {
+	case "", `)`, `AND`, `OR`:
+		return &QueryError{Term: op, Msg: "missing term after it"}
+	}
+	return nil
+}
+
+// parseOr parses terms joined by OR. It returns a nil node if there
+// are no terms.
+func (p *queryParser) parseOr() (queryNode, error) {
+	var kids orNode
+	for {
+		n, err := p.parseAnd()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != `OR` {
+			if n == nil && len(kids) > 0 {
+				return nil, &QueryError{Term: `OR`, Msg: "missing term after it"}
+			}
+			if len(kids) == 0 {
+				return n, nil
+			}
+			return append(kids, n), nil
+		}
+		if n == nil {
+			return nil, &QueryError{Term: `OR`, Msg: "missing term before it"}
+		}
+		kids = append(kids, n)
+		p.i++
+		if err := p.operand(`OR`); err != nil {
+			return nil, err
+		}
+	}
+}
+
+// parseAnd parses terms joined by AND, written or implied. It returns
+// a nil node if there are no terms.
+func (p *queryParser) parseAnd() (queryNode, error) {
+	var kids andNode
+	for {
+		switch p.peek() {
+		case "", `)`, `OR`:
+			switch len(kids) {
+			case 0:
+				return nil, nil
+			case 1:
+				return kids[0], nil
+			}
+			return kids, nil
+		case `AND`:
+			if len(kids) == 0 {
+				return nil, &QueryError{Term: `AND`, Msg: "missing term before it"}
+			}
+			p.i++
+			if err := p.operand(`AND`); err != nil {
+				return nil, err
+			}
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		kids = append(kids, n)
+	}
+}
+
+// parseUnary parses a term or group, along with any NOT before it.
+func (p *queryParser) parseUnary() (queryNode, error) {
+	tok := p.peek()
+	p.i++
+	switch tok {
+	case `NOT`:
+		if err := p.operand(`NOT`); err != nil {
+			return nil, err
+		}
+		n, err := p.parseUnary()
+		if err != nil {
+			return nil, err
+		}
+		return notNode{n, `NOT `}, nil
+	case `(`, `-(`:
+		n, err := p.parseOr()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != `)` {
+			return nil, &QueryError{Msg: "missing )"}
+		}
+		p.i++
+		if n == nil {
+			return nil, &QueryError{Term: `()`, Msg: "empty group"}
+		}
+		if tok == `-(` {
+			return notNode{n, `-`}, nil
+		}
+		return n, nil
+	}
+	return p.parseTerm(tok)
+}
+
+// parseTerm parses a single term, which is either a filter or a term
+// of the search index.
+func (p *queryParser) parseTerm(tok string) (queryNode, error) {
+	m := filterTermRegex.FindStringSubmatch(tok)
+	if m == nil {
+		if len(tok) > 1 && strings.HasPrefix(tok, `-`) {
+			return notNode{textTerm(tok[1:]), `-`}, nil
+		}
+		return textTerm(tok), nil
+	}
+	neg, key, v := m[1] == `-`, strings.ToLower(m[2]), m[3]
+	// Allow a space after the key, e.g. `tags: lang/go`.
+	if v == "" {
+		switch next := p.peek(); next {
+		case "", `(`, `-(`, `)`, `AND`, `OR`, `NOT`:
+		default:
+			v = next
+			p.i++
+			tok += " " + v
+		}
+	}
+
+	if col, ok := ftsColumns[key]; ok {
+		if key == `tags` || key == `#` {
+			if f, ok := parseTagTerm(v); ok {
+				return newFilterTerm(tok, f, neg), nil
+			}
+		}
+		t := textTerm(col + `:` + v)
+		if neg {
+			return notNode{t, `-`}, nil
+		}
+		return t, nil
+	}
+
+	f, err := parseFilter(key, v, p.now)
+	if err != nil {
+		err.Term = tok
+		return nil, err
+	}
+	return newFilterTerm(tok, f, neg), nil
+}
+
+// queryNode is a node of a parsed search query.
+type queryNode interface {
+	// fts returns the node in the query syntax of the search index and
+	// whether the search index can match it on its own.
+	fts() (string, bool)
+	// filter returns the node as a search filter.
+	filter() searchFilter
+	// String returns the node as written in a query.
+	String() string
+}
+
+// compileNode returns the search filter of a node, matching it against
+// the search index as a whole if it can be.
+func compileNode(n queryNode) searchFilter {
+	if q, ok := n.fts(); ok {
+		return ftsFilter(q)
+	}
+	return n.filter()
+}
+
+// ftsFilter returns the filter matching zettels against the search
+// index with the query q.
+func ftsFilter(q string) searchFilter {
+	return exprFilter{`z.id IN (SELECT rowid FROM zettel_fts WHERE zettel_fts MATCH ?)`, []any{q}}
+}
+
+// ftsConjunct reports whether n can be part of a list of terms the
+// search index matches as a whole, which also holds for the exclusion
+// of such a term.
+func ftsConjunct(n queryNode) bool {
+	if nn, ok := n.(notNode); ok {
+		n = nn.node
+	}
+	_, ok := n.fts()
+	return ok
+}
+
+// ftsAnd returns the terms the search index matches when they are all
+// found, in its query syntax. The search index only excludes terms
+// from others, so at least one term has to be found.
+func ftsAnd(nodes []queryNode) (string, bool) {
+	var pos, neg []string
+	for _, n := range nodes {
+		if nn, ok := n.(notNode); ok {
+			q, ok := nn.node.fts()
+			if !ok {
+				return "", false
+			}
+			neg = append(neg, `NOT `+group(nn.node, q, true))
+			continue
+		}
+		q, ok := n.fts()
+		if !ok {
+			return "", false
+		}
+		pos = append(pos, group(n, q, len(nodes) > 1))
+	}
+	if len(pos) == 0 {
+		return "", false
+	}
+	return strings.Join(append(pos, neg...), " "), true
+}
+
+// sectionFTS returns node n in the query syntax of the section index,
+// which has no tags column. Terms on tags are left out, since they
+// can't tell the sections of a zettel apart, and false is returned if
+// nothing is left.
+func sectionFTS(n queryNode) (string, bool) {
+	switch n := n.(type) {
+	case textTerm:
+		if strings.HasPrefix(string(n), `tags:`) {
+			return "", false
+		}
+	case andNode:
+		return sectionAnd(n)
+	case orNode:
+		var terms []string
+		for _, c := range n {
+			if q, ok := sectionFTS(c); ok {
+				terms = append(terms, group(c, q, true))
+			}
+		}
+		if len(terms) == 0 {
+			return "", false
+		}
+		return strings.Join(terms, " OR "), true
+	}
+	return n.fts()
+}
+
+// sectionAnd is ftsAnd for the section index, see sectionFTS.
+func sectionAnd(nodes []queryNode) (string, bool) {
+	var pos, neg []string
+	for _, n := range nodes {
+		if nn, ok := n.(notNode); ok {
+			if q, ok := sectionFTS(nn.node); ok {
+				neg = append(neg, `NOT `+group(nn.node, q, true))
+			}
+			continue
+		}
+		if q, ok := sectionFTS(n); ok {
+			pos = append(pos, group(n, q, len(nodes) > 1))
+		}
+	}
+	if len(pos) == 0 {
+		return "", false
+	}
+	return strings.Join(append(pos, neg...), " "), true
+}
+
+// group wraps s, the node n written out, in parentheses if wrap is set
+// and n is made of other nodes.
+func group(n queryNode, s string, wrap bool) string {
+	switch n.(type) {
+	case andNode, orNode:
+		if wrap {
+			return `(` + s + `)`
+		}
+	}
+	return s
+}
+
+// textTerm is a term matched against the search index, e.g. `go*` or
+// `title:proxy`.
+type textTerm string
+
+func (t textTerm) fts() (string, bool) {
+	return string(t), true
+}
+
+func (t textTerm) filter() searchFilter {
+	return ftsFilter(string(t))
+}
+
+func (t textTerm) String() string {
+	return string(t)
+}
+
+// filterTerm is a filter term such as `tag:go`.
+type filterTerm struct {
+	term string // term as written, e.g. `-tag:draft`
+	f    searchFilter
+}
+
+// newFilterTerm returns the filter term written as term, excluding the
+// zettels f matches if neg is set.
+func newFilterTerm(term string, f searchFilter, neg bool) filterTerm {
+	if neg {
+		f = notFilter{f}
+	}
+	return filterTerm{term, f}
+}
+
+func (t filterTerm) fts() (string, bool) {
+	return "", false
+}
+
+func (t filterTerm) filter() searchFilter {
+	return t.f
+}
+
+func (t filterTerm) String() string {
+	return t.term
+}
+
+// notNode excludes what a node matches. It is written either as NOT
+// or as `-`.
+type notNode struct {
+	node queryNode
+	op   string // `NOT ` or `-`
+}
+
+// fts reports false, as the search index can only exclude terms from
+// others.
+func (n notNode) fts() (string, bool) {
+	return "", false
+}
+
+func (n notNode) filter() searchFilter {
+	return notFilter{compileNode(n.node)}
+}
+
+func (n notNode) String() string {
+	return n.op + group(n.node, n.node.String(), true)
+}
+
+// andNode matches what all of its nodes match.
+type andNode []queryNode
+
+func (n andNode) fts() (string, bool) {
+	return ftsAnd(n)
+}
+
+func (n andNode) filter() searchFilter {
+	f := boolFilter{op: `AND`}
+	for _, c := range n {
+		f.filters = append(f.filters, compileNode(c))
+	}
+	return f
+}
+
+func (n andNode) String() string {
+	var terms []string
+	for _, c := range n {
+		terms = append(terms, group(c, c.String(), true))
+	}
+	return strings.Join(terms, " ")
+}
+
+// orNode matches what any of its nodes match.
+type orNode []queryNode
+
+func (n orNode) fts() (string, bool) {
+	var terms []string
+	for _, c := range n {
+		q, ok := c.fts()
+		if !ok {
+			return "", false
+		}
+		terms = append(terms, group(c, q, true))
+	}
+	return strings.Join(terms, " OR "), true
+}
+
+func (n orNode) filter() searchFilter {
+	f := boolFilter{op: `OR`}
+	for _, c := range n {
+		f.filters = append(f.filters, compileNode(c))
+	}
+	return f
+}
+
+func (n orNode) String() string {
+	var terms []string
+	for _, c := range n {
+		terms = append(terms, group(c, c.String(), true))
+	}
+	return strings.Join(terms, " OR ")
+}
+
+// parseFilter returns the filter for a key and value.
+func parseFilter(key, v string, now time.Time) (searchFilter, *QueryError) {
+	if v == "" {
+		return nil, &QueryError{Msg: "missing value"}
+	}
+	switch key {
+	case `tag`:
+		if f, ok := parseTagTerm(v); ok {
+			return f, nil
+		}
+		return nil, &QueryError{Msg: "not a tag"}
+	case `status`, `source`, `alias`, `aliases`, `meta`:
+		if f, ok := parseMetaTerm(key + `:` + v); ok {
+			return f, nil
+		}
+		return nil, &QueryError{Msg: "expected meta:<key>=<value>"}
+	case `created`:
+		return parseTimeFilter(createdExpr, v, now)
+	case `modified`:
+		return parseTimeFilter(modifiedExpr, v, now)
+	case `links-to`:
+		return exprFilter{`z.id IN (
+							SELECT l.from_zettel_id FROM link l
+							JOIN zettel t ON t.id = l.to_zettel_id
+							WHERE t.dir_name = ?)`, []any{v}}, nil
+	case `linked-from`:
+		return exprFilter{`z.id IN (
+							SELECT l.to_zettel_id FROM link l
+							JOIN zettel f ON f.id = l.from_zettel_id
+							WHERE f.dir_name = ?)`, []any{v}}, nil
+	case `has`:
+		if cond, ok := hasConds[strings.ToLower(v)]; ok {
+			return exprFilter{expr: cond}, nil
+		}
+		return nil, &QueryError{Msg: "expected links, backlinks, broken, tags or meta"}
+	case `orphan`:
+		b, err := strconv.ParseBool(v)
+		if err != nil {
+			return nil, &QueryError{Msg: "expected true or false"}
+		}
+		if !b {
+			return notFilter{exprFilter{expr: orphanCond}}, nil
+		}
+		return exprFilter{expr: orphanCond}, nil
+	case `words`:
+		m := comparisonRegex.FindStringSubmatch(v)
+		n, err := strconv.Atoi(m[2])
+		if err != nil || n < 0 {
+			return nil, &QueryError{Msg: "expected a number of words"}
+		}
+		op := m[1]
+		if op == "" {
+			op = `=`
+		}
+		return exprFilter{`z.words ` + op + ` ?`, []any{n}}, nil
+	}
+	return nil, &QueryError{Msg: "unknown filter"}
+}
+
+// parseTimeFilter returns the filter comparing the time expression expr
+// to the date or duration v. A date on its own matches any time within
+// it, while a duration on its own matches any time since then.
+func parseTimeFilter(expr, v string, now time.Time) (searchFilter, *QueryError) {
+	m := comparisonRegex.FindStringSubmatch(strings.TrimSuffix(v, `*`))
+	op, v := m[1], m[2]
+
+	if d := durationRegex.FindStringSubmatch(v); d != nil {
+		n, _ := strconv.Atoi(d[1])
+		var since time.Time
+		switch d[2] {
+		case `h`:
+			since = now.Add(-time.Duration(n) * time.Hour)
+		case `d`:
+			since = now.AddDate(0, 0, -n)
+		case `w`:
+			since = now.AddDate(0, 0, -7*n)
+		case `m`:
+			since = now.AddDate(0, -n, 0)
+		case `y`:
+			since = now.AddDate(-n, 0, 0)
+		}
+		// Less than a week ago is after the time a week ago.
+		key := since.Format(timeKey)
+		switch op {
+		case `>`:
+			return exprFilter{expr + ` < ?`, []any{key}}, nil
+		case `>=`:
+			return exprFilter{expr + ` <= ?`, []any{key}}, nil
+		default:
+			return exprFilter{expr + ` >= ?`, []any{key}}, nil
+		}
+	}
+
+	var start, end time.Time
+	for _, layout := range []string{`2006-01-02`, `2006-01`, `2006`} {
+		t, err := time.ParseInLocation(layout, v, now.Location())
+		if err != nil {
+			continue
+		}
+		start = t
+		switch layout {
+		case `2006-01-02`:
+			end = t.AddDate(0, 0, 1)
+		case `2006-01`:
+			end = t.AddDate(0, 1, 0)
+		default:
+			end = t.AddDate(1, 0, 0)
+		}
+		break
+	}
+	if start.IsZero() {
+		return nil, &QueryError{Msg: "expected a date such as 2024-01-31 or a duration such as 7d"}
+	}
+	from, to := start.Format(timeKey), end.Format(timeKey)
+	switch op {
+	case `>`:
+		return exprFilter{expr + ` >= ?`, []any{to}}, nil
+	case `>=`:
+		return exprFilter{expr + ` >= ?`, []any{from}}, nil
+	case `<`:
+		return exprFilter{expr + ` < ?`, []any{from}}, nil
+	case `<=`:
+		return exprFilter{expr + ` < ?`, []any{to}}, nil
+	}
+	return exprFilter{expr + ` >= ? AND ` + expr + ` < ?`, []any{from, to}}, nil
+}
+
+// exprFilter is a search filter given as a condition on zettel z with
+// a `?` in place of each value.
+type exprFilter struct {
+	expr string
+	vals []any
+}
+
+func (f exprFilter) args() []any {
+	return f.vals
+}
+
+// cond returns the condition with its values bound to parameters n and
+// up.
+func (f exprFilter) cond(n int) string {
+	var b strings.Builder
+	for _, r := range f.expr {
+		if r == '?' {
+			fmt.Fprintf(&b, `$%d`, n)
+			n++
+			continue
+		}
+		b.WriteRune(r)
+	}
+	return b.String()
+}
+
+// boolFilter joins the conditions of filters with AND or OR.
+type boolFilter struct {
+	op      string // AND or OR
+	filters []searchFilter
+}
+
+func (f boolFilter) args() []any {
+	var args []any
+	for _, c := range f.filters {
+		args = append(args, c.args()...)
+	}
+	return args
+}
+
+func (f boolFilter) cond(n int) string {
+	var conds []string
+	for _, c := range f.filters {
+		conds = append(conds, `(`+c.cond(n)+`)`)
+		n += len(c.args())
+	}
+	return `(` + strings.Join(conds, ` `+f.op+` `) + `)`
+}
+
+// notFilter excludes the zettels matched by a filter.
+type notFilter struct {
+	searchFilter
+}
+
+func (f notFilter) cond(n int) string {
+	return `NOT (` + f.searchFilter.cond(n) + `)`
+}
@@ -0,0 +1,126 @@
+package storage
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/ericstrs/zet/internal/markdown"
+	"github.com/jmoiron/sqlx"
+)
+
+// Section is the part of a zettel under its title or a heading, up to
+// the next heading. Links point to a section with its anchor, e.g.
+// `[iso](../iso#further-reading) title`.
+type Section struct {
+	ID       int    `db:"id"`         // unique section id
+	ZettelID int    `db:"zettel_id"`  // zettel id the section is in
+	Anchor   string `db:"anchor"`     // anchor, e.g. `further-reading`
+	Heading  string `db:"heading"`    // heading, e.g. `Further reading`
+	Level    int    `db:"level"`      // heading level
+	Start    int    `db:"start_line"` // line of the heading
+	End      int    `db:"end_line"`   // last line of the section
+	Body     string `db:"body"`       // text of the section
+}
+
+// splitSections returns the sections of the parsed lines of a zettel.
+// The body of a section is made of its body lines, as with the body of
+// a zettel.
+func splitSections(lines []markdown.Line) []Section {
+	var sections []Section
+	for _, ms := range markdown.Sections(lines) {
+		var body []string
+		for _, l := range lines[ms.Start:ms.End] {
+			if l.IsBody() {
+				body = append(body, l.Text)
+			}
+		}
+		sections = append(sections, Section{
+			Anchor:  ms.Anchor,
+			Heading: ms.Heading,
+			Level:   ms.Level,
+			Start:   ms.Start,
+			End:     ms.End,
+			Body:    strings.TrimSpace(strings.Join(body, "\n")),
+		})
+	}
+	return sections
+}
+
+// replaceSections replaces the sections of the zettel with the given
+// id.
+func replaceSections(tx *sqlx.Tx, id int, sections []Section) error {
+	if _, err := tx.Exec(`DELETE FROM section WHERE zettel_id = $1;`, id); err != nil {
+		return fmt.Errorf("Error deleting sections: %v", err)
+	}
+	const query = `
+		INSERT INTO section (zettel_id, anchor, heading, level, start_line, end_line, body)
+		VALUES ($1, $2, $3, $4, $5, $6, $7);`
+	for _, s := range sections {
+		if _, err := tx.Exec(query, id, s.Anchor, s.Heading, s.Level, s.Start, s.End, s.Body); err != nil {
+			return fmt.Errorf("Error inserting section: %v", err)
+		}
+	}
+	return nil
+}
+
+// ZettelSections returns the sections of the zettel with the given id,
+// in the order they are written.
+func (s *Storage) ZettelSections(id int) ([]Section, error) {
+	sections := []Section{}
+	const query = `SELECT * FROM section WHERE zettel_id = $1 ORDER BY start_line;`
+	if err := s.DB.Select(&sections, query, id); err != nil {
+		return nil, fmt.Errorf("Error getting sections: %v", err)
+	}
+	return sections, nil
+}
+
+// matchSections returns the section of each zettel with one of the
+// given ids that best matches a query in the syntax of the section
+// index, see sectionFTS, keyed by zettel id. The query is matched
+// against the section headings as titles and the section text as body.
+// Zettels without a matching section are left out.
+func matchSections(db *sqlx.DB, ids []int, q string) (map[int]Section, error) {
+	best := make(map[int]Section)
+	if q == "" || len(ids) == 0 {
+		return best, nil
+	}
+	query, args, err := sqlx.In(`
+		SELECT s.* FROM section_fts f
+		JOIN section s ON s.id = f.rowid
+		WHERE section_fts MATCH ? AND s.zettel_id IN (?)
+		ORDER BY bm25(section_fts, 1.5, 1.0);`, q, ids)
+	if err != nil {
+		return nil, err
+	}
+	var sections []Section
+	if err := db.Select(&sections, db.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("Error matching sections: %v", err)
+	}
+	for _, sec := range sections {
+		if _, ok := best[sec.ZettelID]; !ok {
+			best[sec.ZettelID] = sec
+		}
+	}
+	return best, nil
+}
+
+// MissingAnchors returns all links pointing to a section that doesn't
+// exist in the zettel they point to, ordered by source zettel and line.
+func (s *Storage) MissingAnchors() ([]BrokenLink, error) {
+	links := []BrokenLink{}
+	const query = `
+		SELECT l.id, l.content, l.from_zettel_id, l.to_zettel_id, l.line, l.col, l.kind,
+			l.type, l.context, l.anchor, t.dir_name AS to_dir,
+			f.dir_name AS from_dir, f.name AS from_name
+		FROM link l
+		JOIN zettel f ON f.id = l.from_zettel_id
+		JOIN zettel t ON t.id = l.to_zettel_id
+		WHERE l.anchor != '' AND NOT EXISTS (
+			SELECT 1 FROM section s
+			WHERE s.zettel_id = l.to_zettel_id AND s.anchor = LOWER(l.anchor))
+		ORDER BY f.dir_name, f.name, l.line, l.col;`
+	if err := s.DB.Select(&links, query); err != nil {
+		return nil, fmt.Errorf("Error getting links to missing anchors: %v", err)
+	}
+	return links, nil
+}
@@ -0,0 +1,170 @@
+package storage
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// Names of the settings that change what is written to the database
+// rather than how it is read. They are kept in the database so every
+// zet process using it, including a watcher, works the same way, and
+// they are only changed with SetSetting.
+const (
+	SettingInlineTags = `inline-tags` // count inline hashtags, see InlineTags
+	SettingTokenizer  = `tokenizer`   // how search terms are split, see Tokenizers
+)
+
+// setting describes a setting kept in the setting table.
+type setting struct {
+	key   string                            // key in the setting table
+	def   string                            // value when it was never set
+	parse func(v string) (string, error)    // checks and normalizes a value
+	apply func(tx *sqlx.Tx, v string) error // brings the database in line with a new value
+}
+
+var settings = map[string]setting{
+	SettingInlineTags: {
+		key:   `inline_tags`,
+		def:   `false`,
+		parse: parseSwitch,
+		apply: func(tx *sqlx.Tx, v string) error {
+			// Every zettel is parsed again on the next sync to find its
+			// inline tags or drop them.
+			_, err := tx.Exec(`UPDATE zettel SET hash = '';`)
+			return err
+		},
+	},
+	SettingTokenizer: {
+		key: `tokenizer`,
+		def: `porter`,
+		parse: func(v string) (string, error) {
+			v = strings.ToLower(v)
+			_, err := tokenizeOption(v)
+			return v, err
+		},
+		apply: rebuildSearchIndexes,
+	},
+}
+
+// parseSwitch normalizes an on or off value to true or false.
+func parseSwitch(v string) (string, error) {
+	switch strings.ToLower(v) {
+	case `on`, `yes`:
+		return `true`, nil
+	case `off`, `no`:
+		return `false`, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return "", fmt.Errorf("Invalid value %q, expected on or off", v)
+	}
+	return strconv.FormatBool(b), nil
+}
+
+// SettingNames returns the names of the settings, sorted.
+func SettingNames() []string {
+	var names []string
+	for name := range settings {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// lookupSetting returns the setting with the given name.
+func lookupSetting(name string) (setting, error) {
+	st, ok := settings[name]
+	if !ok {
+		return setting{}, fmt.Errorf("Unknown setting %q, expected one of %s", name, strings.Join(SettingNames(), ", "))
+	}
+	return st, nil
+}
+
+// settingValue returns the value of the setting st stored in the
+// database, or its default if it was never set.
+func settingValue(q sqlx.Queryer, st setting) (string, error) {
+	var v string
+	err := sqlx.Get(q, &v, `SELECT value FROM setting WHERE key = $1;`, st.key)
+	if errors.Is(err, sql.ErrNoRows) {
+		return st.def, nil
+	}
+	if err != nil {
+		return "", fmt.Errorf("Error reading setting %s: %v", st.key, err)
+	}
+	return v, nil
+}
+
+// Setting returns the value of the named setting.
+func (s *Storage) Setting(name string) (string, error) {
+	st, err := lookupSetting(name)
+	if err != nil {
+		return "", err
+	}
+	return settingValue(s.DB, st)
+}
+
+// SetSetting changes the named setting and brings the database in line
+// with it in a single transaction. Zettels that have to be parsed again
+// are picked up by the next full sync. It reports whether the value
+// changed.
+func (s *Storage) SetSetting(name, value string) (bool, error) {
+	st, err := lookupSetting(name)
+	if err != nil {
+		return false, err
+	}
+	v, err := st.parse(strings.TrimSpace(value))
+	if err != nil {
+		return false, err
+	}
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return false, fmt.Errorf("Failed to create transaction: %v", err)
+	}
+	defer tx.Rollback()
+	old, err := settingValue(tx, st)
+	if err != nil {
+		return false, err
+	}
+	if old == v {
+		return false, nil
+	}
+	if err := st.apply(tx, v); err != nil {
+		return false, fmt.Errorf("Error applying setting %s: %v", name, err)
+	}
+	if err := saveSetting(tx, st.key, v); err != nil {
+		return false, err
+	}
+	if err := tx.Commit(); err != nil {
+		return false, err
+	}
+	return true, loadSettings(s.DB)
+}
+
+// saveSetting stores the value of a setting under key.
+func saveSetting(tx *sqlx.Tx, key, value string) error {
+	const query = `
+		INSERT INTO setting (key, value) VALUES ($1, $2)
+		ON CONFLICT(key) DO UPDATE SET value = excluded.value;`
+	if _, err := tx.Exec(query, key, value); err != nil {
+		return fmt.Errorf("Error saving settings: %v", err)
+	}
+	return nil
+}
+
+// loadSettings reads the settings that parsing depends on from the
+// database.
+func loadSettings(q sqlx.Queryer) error {
+	v, err := settingValue(q, settings[SettingInlineTags])
+	if err != nil {
+		return err
+	}
+	InlineTags = v == `true`
+	return nil
+}
@@ -1,5 +1,7 @@
 package storage
 
+// tablesSQL is the initial schema of the database. Later changes to the
+// schema are made through migrations.
 const tablesSQL = `
       CREATE TABLE IF NOT EXISTS dir (
         id INTEGER PRIMARY KEY AUTOINCREMENT,
@@ -107,6 +109,174 @@ const tablesSQL = `
           )
           WHERE rowid = old.zettel_id;
       END;
+      `
+
+// unresolvedLinkSQL creates the table for links whose target zettel
+// doesn't exist (yet).
+const unresolvedLinkSQL = `
+      CREATE TABLE IF NOT EXISTS unresolved_link (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        content TEXT NOT NULL,
+        from_zettel_id INTEGER NOT NULL,
+        to_dir TEXT NOT NULL,          -- Directory name the link points to
+        line INTEGER NOT NULL DEFAULT 0, -- Line the link is on
+        UNIQUE(content, from_zettel_id),
+        FOREIGN KEY(from_zettel_id) REFERENCES zettel(id) ON DELETE CASCADE
+      );
+      `
+
+// settingSQL creates the table for settings that affect how zettels
+// are stored, so a change can be detected between runs.
+const settingSQL = `
+      CREATE TABLE IF NOT EXISTS setting (
+        key TEXT PRIMARY KEY,
+        value TEXT NOT NULL
+      );
+      `
+
+// zettelMetaSQL creates the table for the key/value pairs of zettel
+// front matter. A list value is stored as one row per item.
+const zettelMetaSQL = `
+      CREATE TABLE IF NOT EXISTS zettel_meta (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        zettel_id INTEGER NOT NULL,
+        key TEXT NOT NULL,             -- Front matter key, e.g. status
+        value TEXT NOT NULL,           -- Front matter value or list item
+        line INTEGER NOT NULL DEFAULT 0, -- Line the value is on
+        FOREIGN KEY(zettel_id) REFERENCES zettel(id) ON DELETE CASCADE
+      );
+
+      CREATE INDEX IF NOT EXISTS zettel_meta_key_value ON zettel_meta(key, value);
+      `
+
+// sectionSQL creates the table for the sections of zettels, along with
+// a full text search index of their headings and text. The heading is
+// indexed as the title column so title searches work on sections too.
+const sectionSQL = `
+      CREATE TABLE IF NOT EXISTS section (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        zettel_id INTEGER NOT NULL,
+        anchor TEXT NOT NULL,          -- Anchor links use, e.g. further-reading
+        heading TEXT NOT NULL,         -- Heading text
+        level INTEGER NOT NULL,        -- Heading level
+        start_line INTEGER NOT NULL,   -- Line of the heading
+        end_line INTEGER NOT NULL,     -- Last line of the section
+        body TEXT NOT NULL,            -- Text of the section
+        UNIQUE(zettel_id, anchor),
+        FOREIGN KEY(zettel_id) REFERENCES zettel(id) ON DELETE CASCADE
+      );
+
+      CREATE VIRTUAL TABLE IF NOT EXISTS section_fts USING fts5(
+        title,
+        body,
+        tokenize='porter'
+      );
+
+      CREATE TRIGGER IF NOT EXISTS ai_section AFTER INSERT ON section BEGIN
+        INSERT INTO section_fts(rowid, title, body) VALUES (new.id, new.heading, new.body);
+      END;
+
+      CREATE TRIGGER IF NOT EXISTS ad_section AFTER DELETE ON section BEGIN
+        DELETE FROM section_fts WHERE rowid = old.id;
+      END;
+      `
+
+// wordSQL creates an index of the words in zettel titles and bodies as
+// written, without stemming, along with a view of its vocabulary. Its
+// words are offered as spelling suggestions for searches that match
+// nothing. The index reads its content from the zettel table, so it is
+// kept in sync by the triggers below.
+const wordSQL = `
+      CREATE VIRTUAL TABLE IF NOT EXISTS word_fts USING fts5(
+        title,
+        body,
+        content='zettel',
+        content_rowid='id'
+      );
+
+      CREATE VIRTUAL TABLE IF NOT EXISTS word_vocab USING fts5vocab(word_fts, 'row');
+
+      CREATE TRIGGER IF NOT EXISTS ai_zettel_words AFTER INSERT ON zettel BEGIN
+        INSERT INTO word_fts(rowid, title, body) VALUES (new.id, new.title, new.body);
+      END;
+
+      CREATE TRIGGER IF NOT EXISTS au_zettel_words AFTER UPDATE OF title, body ON zettel BEGIN
+        INSERT INTO word_fts(word_fts, rowid, title, body) VALUES ('delete', old.id, old.title, old.body);
+        INSERT INTO word_fts(rowid, title, body) VALUES (new.id, new.title, new.body);
+      END;
+
+      CREATE TRIGGER IF NOT EXISTS ad_zettel_words AFTER DELETE ON zettel BEGIN
+        INSERT INTO word_fts(word_fts, rowid, title, body) VALUES ('delete', old.id, old.title, old.body);
+      END;
+
+      INSERT INTO word_fts(word_fts) VALUES ('rebuild');
+      `
+
+// searchSQL creates the tables for saved searches and the search
+// history. Saved searches are shared by everyone using the database,
+// while the history is kept per user.
+const searchSQL = `
+      CREATE TABLE IF NOT EXISTS saved_search (
+        name TEXT PRIMARY KEY,         -- Name the search is run by
+        query TEXT NOT NULL,           -- Search query
+        created TEXT NOT NULL          -- Time the search was saved
+      );
+
+      CREATE TABLE IF NOT EXISTS search_history (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        user TEXT NOT NULL,            -- User who searched
+        query TEXT NOT NULL,           -- Search query
+        searched_at TEXT NOT NULL      -- Time of the search
+      );
+
+      CREATE INDEX IF NOT EXISTS search_history_user ON search_history(user, id);
+      `
+
+// linkKeySQL rebuilds link and unresolved_link with a col column and a
+// key that includes the line and column, so a link written more than
+// once in a zettel is stored once per occurrence. SQLite can't change
+// the constraints of a table, so the tables are copied.
+const linkKeySQL = `
+      CREATE TABLE link_new (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        content TEXT NOT NULL,
+        from_zettel_id INTEGER NOT NULL,
+        to_zettel_id INTEGER NOT NULL,
+        line INTEGER NOT NULL DEFAULT 0, -- Line the link is on
+        col INTEGER NOT NULL DEFAULT 0,  -- Column the link starts at
+        kind TEXT NOT NULL DEFAULT 'line',
+        type TEXT NOT NULL DEFAULT 'see-also',
+        context TEXT NOT NULL DEFAULT '',
+        anchor TEXT NOT NULL DEFAULT '',
+        UNIQUE(content, from_zettel_id, to_zettel_id, line, col),
+        FOREIGN KEY(from_zettel_id) REFERENCES zettel(id) ON DELETE CASCADE,
+        FOREIGN KEY(to_zettel_id) REFERENCES zettel(id) ON DELETE CASCADE
+      );
+
+      INSERT INTO link_new (id, content, from_zettel_id, to_zettel_id, line, kind, type, context, anchor)
+      SELECT id, content, from_zettel_id, to_zettel_id, line, kind, type, context, anchor FROM link;
+
+      DROP TABLE link;
+      ALTER TABLE link_new RENAME TO link;
+
+      CREATE TABLE unresolved_link_new (
+        id INTEGER PRIMARY KEY AUTOINCREMENT,
+        content TEXT NOT NULL,
+        from_zettel_id INTEGER NOT NULL,
+        to_dir TEXT NOT NULL,          -- Directory name the link points to
+        line INTEGER NOT NULL DEFAULT 0, -- Line the link is on
+        col INTEGER NOT NULL DEFAULT 0,  -- Column the link starts at
+        kind TEXT NOT NULL DEFAULT 'line',
+        type TEXT NOT NULL DEFAULT 'see-also',
+        context TEXT NOT NULL DEFAULT '',
+        anchor TEXT NOT NULL DEFAULT '',
+        UNIQUE(content, from_zettel_id, line, col),
+        FOREIGN KEY(from_zettel_id) REFERENCES zettel(id) ON DELETE CASCADE
+      );
+
+      INSERT INTO unresolved_link_new (id, content, from_zettel_id, to_dir, line, kind, type, context, anchor)
+      SELECT id, content, from_zettel_id, to_dir, line, kind, type, context, anchor FROM unresolved_link;
 
-      PRAGMA foreign_keys = ON;
+      DROP TABLE unresolved_link;
+      ALTER TABLE unresolved_link_new RENAME TO unresolved_link;
       `
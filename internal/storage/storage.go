@@ -1,19 +1,26 @@
 // Package storage provides the functionality for interacting with the
 // zet database.
+//
+// Settings that change what is written to the database rather than
+// how it is read are kept in the database, see SetSetting, so every zet
+// process sharing it, including a watcher, works the same way.
 package storage
 
 import (
-	"bufio"
+	"crypto/sha256"
 	"database/sql"
+	"encoding/hex"
 	"fmt"
 	"log"
 	"os"
 	"path"
 	"path/filepath"
 	"regexp"
+	"sort"
 	"strings"
 	"time"
 
+	"github.com/ericstrs/zet/internal/markdown"
 	"github.com/jmoiron/sqlx"
 	_ "modernc.org/sqlite"
 )
@@ -47,22 +54,35 @@ type ResultZettel struct {
 	// SQLite snippet function. If a match was found, it will be
 	// surrounded by additional text to support highlighting.
 	TagsSnippet string `db:"tags_snippet"`
+
+	// Section is the section of the zettel that best matches the search
+	// query. It is left empty if no single section matches.
+	Section Section `db:"-"`
 }
 
 type Zettel struct {
-	ID      int    `db:"id"`    // unique id
-	Name    string `db:"name"`  // name of file
-	Title   string `db:"title"` // title of file
-	Body    string `db:"body"`  // body of file
-	Links   []Link // links to other zettels
-	Tags    []Tag  // zettels tags
-	Mtime   string `db:"mtime"`    // modification time
-	DirName string `db:"dir_name"` // modification time
+	ID         int       `db:"id"`    // unique id
+	Name       string    `db:"name"`  // name of file
+	Title      string    `db:"title"` // title of file
+	Body       string    `db:"body"`  // body of file
+	Links      []Link    // links to other zettels
+	Unresolved []Link    // links to zettels that don't exist (yet)
+	Tags       []Tag     // zettels tags
+	Meta       []Meta    // front matter key/value pairs
+	Sections   []Section // parts of the zettel under each heading
+	Mtime      string    `db:"mtime"`    // modification time
+	Hash       string    `db:"hash"`     // sha256 of file content
+	Size       int64     `db:"size"`     // size of file in bytes
+	Words      int       `db:"words"`    // number of words in body
+	DirName    string    `db:"dir_name"` // modification time
 }
 
 type Tag struct {
-	ID   int    `db:"id"`   // unique tag id
-	Name string `db:"name"` // unique tag name
+	ID     int    `db:"id"`     // unique tag id
+	Name   string `db:"name"`   // unique tag name, e.g. `lang/go`
+	Parent string `db:"parent"` // name of parent tag, e.g. `lang`
+	Line   int    `db:"line"`   // line the tag was first found on
+	Col    int    `db:"col"`    // column the tag was first found at
 }
 
 type Link struct {
@@ -70,6 +90,13 @@ type Link struct {
 	Content      string `db:"content"`        // zettel link
 	FromZettelID int    `db:"from_zettel_id"` // zettel id where link lives
 	ToZettelID   int    `db:"to_zettel_id"`   // zettel id where link points to
+	ToDir        string `db:"to_dir"`         // directory name link points to
+	Line         int    `db:"line"`           // line the link is on
+	Col          int    `db:"col"`            // column the link starts at
+	Kind         string `db:"kind"`           // how the link is written, e.g. wiki
+	Type         string `db:"type"`           // what the link is for, e.g. see-also
+	Context      string `db:"context"`        // sentence or entry the link is in
+	Anchor       string `db:"anchor"`         // section the link points to, if any
 }
 
 func (s *Storage) GetDB() *sqlx.DB {
@@ -166,6 +193,27 @@ func (s *Storage) ZettelSummaries(sort string) ([]Zettel, error) {
 	return zettels, nil
 }
 
+// ZettelTags returns the tag names of every zettel keyed by zettel id.
+func (s *Storage) ZettelTags() (map[int][]string, error) {
+	rows := []struct {
+		ZettelID int    `db:"zettel_id"`
+		Name     string `db:"name"`
+	}{}
+	const query = `
+		SELECT zt.zettel_id, t.name
+		FROM zettel_tags zt
+		JOIN tag t ON t.id = zt.tag_id
+		ORDER BY zt.zettel_id, t.name;`
+	if err := s.DB.Select(&rows, query); err != nil {
+		return nil, fmt.Errorf("Error getting zettel tags: %v", err)
+	}
+	tags := make(map[int][]string)
+	for _, r := range rows {
+		tags[r.ZettelID] = append(tags[r.ZettelID], r.Name)
+	}
+	return tags, nil
+}
+
 // GetZettel returns a zettel from the database for a given zettel id.
 func GetZettel(db *sqlx.DB, id int) (Zettel, error) {
 	z := Zettel{}
@@ -183,25 +231,147 @@ func GetZettel(db *sqlx.DB, id int) (Zettel, error) {
 	return z, nil
 }
 
+// SnippetMode is how SearchZettels makes the body snippet of a result.
+type SnippetMode int
+
+const (
+	// SnippetLines makes the body snippet out of every body line with a
+	// match, each prefixed with its line number.
+	SnippetLines SnippetMode = iota
+	// SnippetFragment makes the body snippet out of the fragment of the
+	// body that best matches the query, as picked by the search index.
+	SnippetFragment
+	// SnippetNone leaves the body snippet empty.
+	SnippetNone
+)
+
+// defaultWeights are the bm25 weights of the title, body and tags
+// columns of the search index.
+var defaultWeights = []float64{1.5, 1.0, 1.5}
+
+// SearchOptions holds the options of SearchZettels. The zero value
+// returns every result without highlighting, ranked with the default
+// weights, with the body lines that match as snippets.
+type SearchOptions struct {
+	Before, After string      // markers wrapped around matching text
+	Limit         int         // maximum number of results, 0 for all
+	Offset        int         // number of results to skip
+	Weights       []float64   // bm25 weights of title, body and tags
+	Snippets      SnippetMode // how to make body snippets
+}
+
+// validate returns an error wrapping ErrSearchOptions if the options
+// can't be used.
+func (o SearchOptions) validate() error {
+	switch {
+	case o.Limit < 0:
+		return fmt.Errorf("%w: negative limit %d", ErrSearchOptions, o.Limit)
+	case o.Offset < 0:
+		return fmt.Errorf("%w: negative offset %d", ErrSearchOptions, o.Offset)
+	case len(o.Weights) > len(defaultWeights):
+		return fmt.Errorf("%w: %d weights given for %d columns", ErrSearchOptions, len(o.Weights), len(defaultWeights))
+	case o.Snippets < SnippetLines || o.Snippets > SnippetNone:
+		return fmt.Errorf("%w: unknown snippet mode %d", ErrSearchOptions, o.Snippets)
+	}
+	return nil
+}
+
 // SearchZettels searches the zettelkasten for zettels matching the
-// query. The before and after arguments are used for wrapping any
-// matching text. It returns a slice of Zettels.
-func (s *Storage) SearchZettels(term, before, after string) ([]ResultZettel, error) {
-	term = preprocessInput(term)
-	var results []ResultZettel
+// query, see ParseQuery. Every value taken from the query and the
+// options is bound as a parameter rather than written into the SQL. It
+// returns an error wrapping ErrQuerySyntax, a *QueryError, if the query
+// can't be understood and one wrapping ErrSearchOptions if the options
+// are invalid.
+func (s *Storage) SearchZettels(term string, opts SearchOptions) ([]ResultZettel, error) {
+	if err := opts.validate(); err != nil {
+		return nil, err
+	}
+	pq, err := ParseQuery(term)
+	if err != nil {
+		return nil, err
+	}
+	results := []ResultZettel{}
+
+	var args []any
+	// param binds v and returns its parameter.
+	param := func(v any) string {
+		args = append(args, v)
+		return fmt.Sprintf(`$%d`, len(args))
+	}
 
-	query := `
+	var query, order string
+	if pq.Text == "" {
+		// Only filters were asked for, so there is nothing to match,
+		// highlight or rank.
+		query = `
 					SELECT z.id, z.name, z.title, z.body, z.mtime, z.dir_name,
-						COALESCE(highlight(zettel_fts, 0, '` + before + `', '` + after + `'), '') AS title_snippet,
-						COALESCE(highlight(zettel_fts, 1, '` + before + `', '` + after + `'), '') AS body_snippet,
-		      	COALESCE(highlight(zettel_fts, 2, '` + before + `', '` + after + `'), '') AS tags_snippet
+						z.title AS title_snippet, '' AS body_snippet,
+						COALESCE(f.tags, '') AS tags_snippet
+					FROM zettel z
+					JOIN zettel_fts f ON f.rowid = z.id
+					WHERE 1`
+		order = `
+					ORDER BY z.dir_name, z.name`
+	} else {
+		before, after := param(opts.Before), param(opts.After)
+		var body string
+		switch opts.Snippets {
+		case SnippetLines:
+			// Lines are picked by their matches, so they are marked in a
+			// way that is found whatever the markers, empty ones included.
+			body = `highlight(zettel_fts, 1, ` + param(snippetBefore) + `, ` + param(snippetAfter) + `)`
+		case SnippetFragment:
+			body = `snippet(zettel_fts, 1, ` + before + `, ` + after + `, '...', 16)`
+		case SnippetNone:
+			body = `''`
+		}
+		query = `
+					SELECT z.id, z.name, z.title, z.body, z.mtime, z.dir_name,
+						COALESCE(highlight(zettel_fts, 0, ` + before + `, ` + after + `), '') AS title_snippet,
+						COALESCE(` + body + `, '') AS body_snippet,
+						COALESCE(highlight(zettel_fts, 2, ` + before + `, ` + after + `), '') AS tags_snippet
 					FROM zettel_fts
 					JOIN zettel z ON zettel_fts.rowid = z.id
-					WHERE zettel_fts MATCH LOWER($1)
-					ORDER BY bm25(zettel_fts, 1.5, 1.0, 1.5);
-			`
+					WHERE zettel_fts MATCH ` + param(pq.Text)
+		weights := make([]string, len(defaultWeights))
+		for i, w := range defaultWeights {
+			if i < len(opts.Weights) {
+				w = opts.Weights[i]
+			}
+			weights[i] = param(w)
+		}
+		order = `
+					ORDER BY bm25(zettel_fts, ` + strings.Join(weights, ", ") + `)`
+	}
+	for _, f := range pq.filters {
+		query += `
+					AND ` + f.cond(len(args)+1)
+		args = append(args, f.args()...)
+	}
+	query += order
+	if opts.Limit > 0 || opts.Offset > 0 {
+		limit := opts.Limit
+		if limit == 0 {
+			limit = -1
+		}
+		query += `
+					LIMIT ` + param(limit) + ` OFFSET ` + param(opts.Offset)
+	}
+	query += `;`
 
-	if err := s.DB.Select(&results, query, strings.ToLower(term)); err != nil {
+	if err := s.DB.Select(&results, query, args...); err != nil {
+		if qe := ftsError(err); qe != nil {
+			return nil, qe
+		}
+		return nil, fmt.Errorf("Error searching zettels: %v", err)
+	}
+
+	ids := make([]int, len(results))
+	for i, r := range results {
+		ids[i] = r.ID
+	}
+	sections, err := matchSections(s.DB, ids, pq.section)
+	if err != nil {
 		return nil, err
 	}
 
@@ -213,20 +383,57 @@ func (s *Storage) SearchZettels(term, before, after string) ([]ResultZettel, err
 		if err := zettelLinks(s.DB, &z.Zettel); err != nil {
 			return nil, fmt.Errorf("Error getting links: %v", err)
 		}
-		z.BodySnippet = createSnippets(z.BodySnippet, before, after)
+		if opts.Snippets == SnippetLines {
+			z.BodySnippet = createSnippets(z.BodySnippet, opts.Before, opts.After)
+		}
+		z.Section = sections[z.ID]
 	}
 	return results, nil
 }
 
-// createSnippets returns all lines that contain a match as a single
-// string.
+// ftsErrorRegex matches an error the search index returns for a query
+// it can't understand.
+var ftsErrorRegex = regexp.MustCompile(`(?:fts5: )?((?:syntax error near|no such column|unterminated string|unknown special query)[^(]*)`)
+
+// ftsError returns the error the search index returned for the query
+// as a *QueryError, or nil if err is some other error.
+func ftsError(err error) *QueryError {
+	m := ftsErrorRegex.FindStringSubmatch(err.Error())
+	if m == nil {
+		return nil
+	}
+	return &QueryError{Msg: strings.TrimSpace(m[1])}
+}
+
+// searchFilter is a search term that is matched against tables other
+// than the search index.
+type searchFilter interface {
+	// args returns the values to bind to the parameters of the condition.
+	args() []any
+	// cond returns the condition on zettel z to add to a WHERE clause,
+	// with its parameters numbered from n.
+	cond(n int) string
+}
+
+// Markers of the matches in a body highlighted for createSnippets.
+// Control characters don't show up in zettels, unlike the markers of
+// SearchOptions, which may also be empty.
+const (
+	snippetBefore = "\x02"
+	snippetAfter  = "\x03"
+)
+
+// createSnippets returns all lines of a body highlighted with
+// snippetBefore and snippetAfter that contain a match as a single
+// string, with the matches wrapped in before and after.
 func createSnippets(body, before, after string) string {
 	var builder strings.Builder
 	lines := strings.Split(body, "\n")
+	markers := strings.NewReplacer(snippetBefore, before, snippetAfter, after)
 
 	for i, line := range lines {
-		if strings.Contains(line, before) && strings.Contains(line, after) {
-			snippet := fmt.Sprintf("%d: %s\n", i+2, line)
+		if strings.Contains(line, snippetBefore) {
+			snippet := fmt.Sprintf("%d: %s\n", i+2, markers.Replace(line))
 			builder.WriteString(snippet)
 		}
 	}
@@ -234,42 +441,10 @@ func createSnippets(body, before, after string) string {
 	return builder.String()
 }
 
-// preprocessInput processes user input for fts5 search.
-func preprocessInput(s string) string {
-	s = convertAlias(s)
-	return s
-}
-
-// convertAlias converts a user query with aliases into an FTS5 query.
-// Aliases are only considered if they are at the beginning of the query.
-func convertAlias(s string) string {
-	aliasMap := map[string]string{
-		`t:`: `title:`,
-		`b:`: `body:`,
-		`#:`: `tags:`,
-	}
-	tokens := strings.Fields(s)
-
-	// Translate the first token if it matches an alias
-	if len(tokens) > 0 {
-		firstToken := tokens[0]
-		for alias, columnName := range aliasMap {
-			if strings.HasPrefix(firstToken, alias) {
-				tokens[0] = strings.Replace(firstToken, alias, columnName, 1)
-				break
-			}
-		}
-	}
-
-	q := strings.Join(tokens, " ")
-
-	return q
-}
-
 // zettelTags retrieves and assigns tags to the given zettel.
 func zettelTags(db *sqlx.DB, z *Zettel) error {
 	const tagQuery = `
-			SELECT t.*
+			SELECT t.*, zt.line, zt.col
 			FROM tag t
 			JOIN zettel_tags zt ON t.id = zt.tag_id
 			WHERE zt.zettel_id = $1;
@@ -289,34 +464,43 @@ func zettelLinks(db *sqlx.DB, z *Zettel) error {
 // UpdateDB initializes the database, retrieve zet state from the
 // database, and updates the database to sync the flat files and the
 // data storage.
+//
+// If a watcher is keeping the database live, the rescan is skipped.
 func UpdateDB(zetPath, dbPath string) (*Storage, error) {
 	s, err := OpenDB(dbPath)
 	if err != nil {
 		return nil, err
 	}
+	if WatcherAlive(dbPath) {
+		return s, nil
+	}
+	if err := s.Sync(zetPath); err != nil {
+		s.Close()
+		return nil, err
+	}
+	return s, nil
+}
 
+// Sync rescans the whole zet directory and brings the database in line
+// with it, whether or not a watcher is running.
+func (s *Storage) Sync(zetPath string) error {
+	if err := loadSettings(s.DB); err != nil {
+		return err
+	}
 	zm, err := s.zettelsMap()
 	if err != nil {
-		s.Close()
-		return nil, fmt.Errorf("Failed to get zettels: %v.\n", err)
+		return fmt.Errorf("Failed to get zettels: %v.\n", err)
 	}
 
 	tx, err := s.DB.Beginx()
 	if err != nil {
-		s.Close()
-		return nil, fmt.Errorf("Failed to create transaction: %v\n", err)
+		return fmt.Errorf("Failed to create transaction: %v\n", err)
 	}
 	if err := processZettels(tx, zetPath, zm); err != nil {
 		tx.Rollback()
-		s.Close()
-		return nil, fmt.Errorf("Failed to process zettels: %v.\n", err)
-	}
-
-	if err := tx.Commit(); err != nil {
-		s.Close()
-		return nil, err
+		return fmt.Errorf("Failed to process zettels: %v.\n", err)
 	}
-	return s, nil
+	return tx.Commit()
 }
 
 // OpenDB initializes the database connection without syncing flat files.
@@ -341,7 +525,10 @@ func NewStorage(db *sqlx.DB) (*Storage, error) {
 	if _, err = db.Exec(`PRAGMA busy_timeout = 5000; PRAGMA journal_mode = WAL; PRAGMA foreign_keys = ON;`); err != nil {
 		return nil, err
 	}
-	if _, err = db.Exec(tablesSQL); err != nil {
+	if _, err = migrate(db); err != nil {
+		return nil, err
+	}
+	if err = loadSettings(db); err != nil {
 		return nil, err
 	}
 	return &Storage{DB: db}, err
@@ -384,8 +571,9 @@ func processZettels(tx *sqlx.Tx, zetPath string, zm map[string]map[string]Zettel
 
 	// Scan the root directory
 	for _, dir := range dirs {
-		// Skip any files not directory type and skip git directory.
-		if !dir.IsDir() || dir.Name() == `.git` {
+		// Skip any files not directory type and skip hidden directories
+		// such as .git and .trash.
+		if !dir.IsDir() || strings.HasPrefix(dir.Name(), `.`) {
 			continue
 		}
 
@@ -423,6 +611,12 @@ func processZettels(tx *sqlx.Tx, zetPath string, zm map[string]map[string]Zettel
 		log.Printf("Failed to delete a zettel: %v.\n", err)
 	}
 
+	// Now that every zettel has a row, resolve the links that pointed to
+	// zettels that weren't inserted yet.
+	if err := resolveLinks(tx); err != nil {
+		return fmt.Errorf("Failed to resolve links: %v", err)
+	}
+
 	return nil
 }
 
@@ -464,6 +658,8 @@ func addZettel(tx *sqlx.Tx, dirPath string, files []os.DirEntry) error {
 		if err != nil {
 			return err
 		}
+		z.Hash = contentHash(contentBytes)
+		z.Size = int64(len(contentBytes))
 		content := string(contentBytes)
 		SplitZettel(tx, &z, content)
 
@@ -475,6 +671,12 @@ func addZettel(tx *sqlx.Tx, dirPath string, files []os.DirEntry) error {
 	return nil
 }
 
+// contentHash returns the hex encoded sha256 sum of file content.
+func contentHash(b []byte) string {
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:])
+}
+
 // ContainsMD reports whether a slice of files contains a README.md file.
 func ContainsMD(files []os.DirEntry) bool {
 	for _, file := range files {
@@ -503,7 +705,7 @@ func deleteZettels(tx *sqlx.Tx, zm map[string]map[string]Zettel) error {
 func insertDir(tx *sqlx.Tx, n string) error {
 	const query = `
     INSERT INTO dir (name)
-    VALUES ($1);
+    VALUES ($1) ON CONFLICT(name) DO NOTHING;
     `
 	_, err := tx.Exec(query, n)
 	return err
@@ -545,13 +747,15 @@ func processFiles(tx *sqlx.Tx, dirPath string, zm map[string]map[string]Zettel)
 		modTime := info.ModTime().Truncate(time.Second)
 		z.Mtime = modTime.Format(time.RFC3339)
 
+		fp := filepath.Join(dirPath, z.Name)
 		f, exists := existingFiles[z.Name]
 		if !exists {
-			fp := filepath.Join(dirPath, z.Name)
 			contentBytes, err := os.ReadFile(fp)
 			if err != nil {
 				return err
 			}
+			z.Hash = contentHash(contentBytes)
+			z.Size = int64(len(contentBytes))
 			content := string(contentBytes)
 			SplitZettel(tx, &z, content)
 
@@ -567,19 +771,30 @@ func processFiles(tx *sqlx.Tx, dirPath string, zm map[string]map[string]Zettel)
 			return err
 		}
 
-		// If the file has been modified since last recorded, make the
-		// database update operation.
-		if modTime.After(ft) {
-			fp := filepath.Join(dirPath, z.Name)
+		// The mtime and size are only used as a cheap hint. Any difference
+		// from what was last recorded, in either direction, means the file
+		// content has to be hashed. This catches files whose mtime was set
+		// backwards by tools like git or rsync.
+		if !modTime.Equal(ft) || info.Size() != f.Size || f.Hash == "" {
 			contentBytes, err := os.ReadFile(fp)
 			if err != nil {
 				return err
 			}
-			content := string(contentBytes)
-			SplitZettel(tx, &z, content)
-
-			if err := updateFile(tx, z); err != nil {
-				return fmt.Errorf("Failed to update file record: %v", err)
+			z.Hash = contentHash(contentBytes)
+			z.Size = int64(len(contentBytes))
+
+			// If the content has changed since last recorded, make the
+			// database update operation. Otherwise, only record the new
+			// mtime so the file isn't hashed again next time.
+			if z.Hash != f.Hash {
+				content := string(contentBytes)
+				SplitZettel(tx, &z, content)
+
+				if err := updateFile(tx, z); err != nil {
+					return fmt.Errorf("Failed to update file record: %v", err)
+				}
+			} else if err := touchFile(tx, z); err != nil {
+				return fmt.Errorf("Failed to update file mtime: %v", err)
 			}
 		}
 
@@ -599,66 +814,77 @@ func processFiles(tx *sqlx.Tx, dirPath string, zm map[string]map[string]Zettel)
 func SplitZettel(tx *sqlx.Tx, z *Zettel, content string) {
 	var bodyLines []string
 	isBody := false
-	// Match lines that contain a link. E.g., `* [dir][../dir] title`
-	linkRegex := regexp.MustCompile(`^.*(\[(.+)\]\(\.\./(.*?)/?\) (.+))`)
-	tagRegex := regexp.MustCompile(`^ {4,}(#[a-zA-Z]+.*)`)
 
-	scanner := bufio.NewScanner(strings.NewReader(content))
-	for scanner.Scan() {
-		line := scanner.Text()
+	front, _, _ := SplitFrontMatter(content)
+	z.Meta = ParseFrontMatter(front)
 
-		// Is line the title?
-		if z.Title == "" && strings.HasPrefix(line, `# `) {
-			z.Title = strings.TrimPrefix(line, `# `)
+	lines := markdown.Parse(content)
+	z.Sections = splitSections(lines)
+	for _, line := range lines {
+		switch line.Kind {
+		case markdown.FrontMatter:
+			continue
+		case markdown.Title:
+			z.Title = strings.TrimPrefix(line.Text, `# `)
 			isBody = true
 			continue
-		}
-
-		// Is line a markdown link?
-		matches := linkRegex.FindStringSubmatch(line)
-		if len(matches) > 1 {
-			iso := matches[2]
-			id, err := ZettelIdDir(tx, iso)
-			if err != nil {
-				// If referenced zettel id couldn't be found, skip link
-				continue
-			}
-			l := Link{Content: matches[1], ToZettelID: id}
-			z.Links = append(z.Links, l)
+		case markdown.Link:
+			splitLinks(tx, z, line)
 			continue
-		}
-
-		// Is line the tag line?
-		matches = tagRegex.FindStringSubmatch(line)
-		if len(matches) > 1 {
-			tagLine := matches[1]
-			ts := strings.Split(tagLine, ` `)
-
-			for _, t := range ts {
+		case markdown.Tags:
+			tagLine := line.TagLine()
+			col := len(line.Text) - len(tagLine) + 1
+			for _, t := range strings.Split(tagLine, ` `) {
+				// If tag doesn't start with `#`, skip it.
 				if strings.HasPrefix(t, `#`) {
-					tt := strings.TrimPrefix(t, `#`)
-					z.Tags = append(z.Tags, Tag{Name: tt})
+					if tt := NormalizeTag(strings.TrimPrefix(t, `#`)); tt != "" {
+						z.Tags = append(z.Tags, Tag{Name: tt, Parent: TagParent(tt), Line: line.Num, Col: col})
+					}
 				}
-				// If tag doesn't start with `#`, skip it.
+				col += len(t) + 1
 			}
 			continue
 		}
 
-		// Everything else is considered as body.
+		// Everything else is considered as body, which may hold links of
+		// its own.
+		splitLinks(tx, z, line)
 		if isBody {
-			bodyLines = append(bodyLines, line)
+			bodyLines = append(bodyLines, line.Text)
 		}
 	}
 
 	z.Body = strings.Join(bodyLines, "\n")
+	z.Words = len(strings.Fields(z.Body))
+	z.Tags = mergeTags(z.Tags, FrontMatterTags(z.Meta))
+	if InlineTags {
+		z.Tags = mergeTags(z.Tags, ParseInlineTags(content))
+	}
+}
+
+// splitLinks adds the links on a line to the zettel's links, or to its
+// unresolved links if the zettel they point to doesn't exist (yet).
+func splitLinks(tx *sqlx.Tx, z *Zettel, line markdown.Line) {
+	for _, r := range line.Refs {
+		l := Link{Content: r.Content, ToDir: r.ISO, Line: line.Num, Col: r.Col, Kind: r.Kind, Type: r.Type, Context: r.Context, Anchor: r.Anchor}
+		id, err := ZettelIdDir(tx, r.ISO)
+		if err != nil {
+			// If referenced zettel id couldn't be found, hold on to the
+			// link so it can be resolved once the zettel exists.
+			z.Unresolved = append(z.Unresolved, l)
+			continue
+		}
+		l.ToZettelID = id
+		z.Links = append(z.Links, l)
+	}
 }
 
 // ZettelIdDir retrieves and returns the zettel using a given unique
-// isosec (director name).
-func ZettelIdDir(tx *sqlx.Tx, iso string) (int, error) {
+// isosec (director name). It accepts either a database or transaction.
+func ZettelIdDir(q sqlx.Queryer, iso string) (int, error) {
 	const query = `SELECT id FROM zettel WHERE dir_name=$1 LIMIT 1;`
 	var id int
-	err := tx.Get(&id, query, iso)
+	err := sqlx.Get(q, &id, query, iso)
 	return id, err
 }
 
@@ -666,31 +892,40 @@ func ZettelIdDir(tx *sqlx.Tx, iso string) (int, error) {
 func insertFile(tx *sqlx.Tx, z Zettel) error {
 	const (
 		insertZettelSQL = `
-    INSERT INTO zettel (name, title, body, mtime, dir_name)
-    VALUES ($1, $2, $3, $4, $5)
+    INSERT INTO zettel (name, title, body, mtime, hash, size, dir_name, words)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		RETURNING id;`
 		insertLinksSQL = `
-		INSERT INTO link (content, from_zettel_id, to_zettel_id)
-		VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+		INSERT INTO link (content, from_zettel_id, to_zettel_id, line, col, kind, type, context, anchor)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT DO NOTHING`
 	)
 	var id int
-	err := tx.QueryRow(insertZettelSQL, z.Name, z.Title, z.Body, z.Mtime, z.DirName).Scan(&id)
+	err := tx.QueryRow(insertZettelSQL, z.Name, z.Title, z.Body, z.Mtime, z.Hash, z.Size, z.DirName, z.Words).Scan(&id)
 	if err != nil {
 		return fmt.Errorf("Error inserting zettel record: %v", err)
 	}
 
 	// Insert links
 	for _, l := range z.Links {
-		_, err = tx.Exec(insertLinksSQL, l.Content, id, l.ToZettelID)
+		_, err = tx.Exec(insertLinksSQL, l.Content, id, l.ToZettelID, l.Line, l.Col, l.Kind, l.Type, l.Context, l.Anchor)
 		if err != nil {
 			return fmt.Errorf("Error inserting links: %v", err)
 		}
 	}
+	if err := insertUnresolved(tx, id, z.Unresolved); err != nil {
+		return fmt.Errorf("Error inserting unresolved links: %v", err)
+	}
 
 	// Insert tags
 	if err := insertTags(tx, id, z.Tags); err != nil {
 		return fmt.Errorf("Error inserting tags: %v", err)
 	}
+	if err := replaceMeta(tx, id, z.Meta); err != nil {
+		return err
+	}
+	if err := replaceSections(tx, id, z.Sections); err != nil {
+		return err
+	}
 
 	return nil
 }
@@ -702,8 +937,8 @@ func updateFile(tx *sqlx.Tx, z Zettel) error {
 		idQuery = `SELECT id FROM zettel
 			WHERE name=$1 AND dir_name=$2`
 		zettelQuery = `
-    	UPDATE zettel SET title=$1, body=$2, mtime=$3
-			WHERE id=$4;`
+    	UPDATE zettel SET title=$1, body=$2, mtime=$3, hash=$4, size=$5, words=$6
+			WHERE id=$7;`
 	)
 	var id int
 	if err := tx.Get(&id, idQuery, z.Name, z.DirName); err != nil {
@@ -711,7 +946,7 @@ func updateFile(tx *sqlx.Tx, z Zettel) error {
 	}
 
 	// Update zettel table record
-	_, err := tx.Exec(zettelQuery, z.Title, z.Body, z.Mtime, id)
+	_, err := tx.Exec(zettelQuery, z.Title, z.Body, z.Mtime, z.Hash, z.Size, z.Words, id)
 	if err != nil {
 		return fmt.Errorf("Error updating zettel table record: %v", err)
 	}
@@ -721,7 +956,21 @@ func updateFile(tx *sqlx.Tx, z Zettel) error {
 	if err := updateTags(tx, z); err != nil {
 		return fmt.Errorf("Error updating tags: %v", err)
 	}
+	if err := replaceMeta(tx, id, z.Meta); err != nil {
+		return err
+	}
+	if err := replaceSections(tx, id, z.Sections); err != nil {
+		return err
+	}
+
+	return err
+}
 
+// touchFile records a new modification time and size for a file whose
+// content is unchanged.
+func touchFile(tx *sqlx.Tx, z Zettel) error {
+	const query = `UPDATE zettel SET mtime=$1, size=$2 WHERE id=$3;`
+	_, err := tx.Exec(query, z.Mtime, z.Size, z.ID)
 	return err
 }
 
@@ -738,6 +987,73 @@ func updateLinks(tx *sqlx.Tx, z Zettel) error {
 	if err := removeLinks(tx, z.ID, remove); err != nil {
 		return fmt.Errorf("Error removing links: %v", err)
 	}
+	if err := updateLinkDetails(tx, z.ID, z.Links); err != nil {
+		return fmt.Errorf("Error updating link details: %v", err)
+	}
+
+	const delUnresolved = `DELETE FROM unresolved_link WHERE from_zettel_id=$1`
+	if _, err := tx.Exec(delUnresolved, z.ID); err != nil {
+		return fmt.Errorf("Error removing unresolved links: %v", err)
+	}
+	if err := insertUnresolved(tx, z.ID, z.Unresolved); err != nil {
+		return fmt.Errorf("Error inserting unresolved links: %v", err)
+	}
+	return nil
+}
+
+// updateLinkDetails records the current kind, type and context of each
+// link for a given zettel id. Editing the text around a link doesn't
+// change its content or position, so it isn't picked up by diffLinks.
+func updateLinkDetails(tx *sqlx.Tx, zettelID int, links []Link) error {
+	const query = `UPDATE link SET kind=$5, type=$6, context=$7
+		WHERE from_zettel_id=$1 AND content=$2 AND line=$3 AND col=$4
+			AND (kind!=$5 OR type!=$6 OR context!=$7)`
+	for _, l := range links {
+		if _, err := tx.Exec(query, zettelID, l.Content, l.Line, l.Col, l.Kind, l.Type, l.Context); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// insertUnresolved inserts links whose target zettel couldn't be found
+// for a given zettel id.
+func insertUnresolved(tx *sqlx.Tx, zettelID int, links []Link) error {
+	const query = `
+		INSERT INTO unresolved_link (content, from_zettel_id, to_dir, line, col, kind, type, context, anchor)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT DO NOTHING`
+	for _, l := range links {
+		if _, err := tx.Exec(query, l.Content, zettelID, l.ToDir, l.Line, l.Col, l.Kind, l.Type, l.Context, l.Anchor); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveLinks turns unresolved links whose target zettel now exists
+// into regular links.
+func resolveLinks(tx *sqlx.Tx) error {
+	const (
+		insertQuery = `
+		INSERT INTO link (content, from_zettel_id, to_zettel_id, line, col, kind, type, context, anchor)
+		SELECT u.content, u.from_zettel_id, (
+				SELECT id FROM zettel WHERE dir_name = u.to_dir LIMIT 1
+			), u.line, u.col, u.kind, u.type, u.context, u.anchor
+		FROM unresolved_link u
+		WHERE EXISTS (SELECT 1 FROM zettel WHERE dir_name = u.to_dir)
+		ON CONFLICT DO NOTHING;`
+		deleteQuery = `
+		DELETE FROM unresolved_link
+		WHERE EXISTS (
+			SELECT 1 FROM zettel WHERE dir_name = unresolved_link.to_dir
+		);`
+	)
+	if _, err := tx.Exec(insertQuery); err != nil {
+		return fmt.Errorf("Error inserting resolved links: %v", err)
+	}
+	if _, err := tx.Exec(deleteQuery); err != nil {
+		return fmt.Errorf("Error removing resolved links: %v", err)
+	}
 	return nil
 }
 
@@ -751,33 +1067,41 @@ func currLinks(tx *sqlx.Tx, zettelID int) ([]Link, error) {
 	return l, nil
 }
 
+// linkKey identifies a single occurrence of a link within a zettel, so
+// a link written more than once is kept once per occurrence.
+type linkKey struct {
+	content   string
+	line, col int
+}
+
 // diffLinks determines which links to add and which to remove for a
-// single zettel.
+// single zettel. A link that moved to another line or column is removed
+// and added again.
 func diffLinks(cl, nl []Link) ([]Link, []Link) {
 	var add, remove []Link
 
 	// Create map of current links
-	currLinksMap := make(map[string]bool)
+	currLinksMap := make(map[linkKey]bool)
 	for _, link := range cl {
-		currLinksMap[link.Content] = true
+		currLinksMap[linkKey{link.Content, link.Line, link.Col}] = true
 	}
 
 	// Find links to add
 	for _, link := range nl {
-		if !currLinksMap[link.Content] {
+		if !currLinksMap[linkKey{link.Content, link.Line, link.Col}] {
 			add = append(add, link)
 		}
 	}
 
 	// Create map of new links
-	newLinksMap := make(map[string]bool)
+	newLinksMap := make(map[linkKey]bool)
 	for _, link := range nl {
-		newLinksMap[link.Content] = true
+		newLinksMap[linkKey{link.Content, link.Line, link.Col}] = true
 	}
 
 	// Find links to remove
 	for _, link := range cl {
-		if !newLinksMap[link.Content] {
+		if !newLinksMap[linkKey{link.Content, link.Line, link.Col}] {
 			remove = append(remove, link)
 		}
 	}
@@ -788,10 +1112,10 @@ func diffLinks(cl, nl []Link) ([]Link, []Link) {
 // addLinks inserts links for a given zettel id.
 func addLinks(tx *sqlx.Tx, zettelID int, links []Link) error {
 	const query = `
-			INSERT INTO link (content, from_zettel_id, to_zettel_id)
-			VALUES ($1, $2, $3) ON CONFLICT DO NOTHING`
+			INSERT INTO link (content, from_zettel_id, to_zettel_id, line, col, kind, type, context, anchor)
+			VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9) ON CONFLICT DO NOTHING`
 	for _, l := range links {
-		_, err := tx.Exec(query, l.Content, zettelID, l.ToZettelID)
+		_, err := tx.Exec(query, l.Content, zettelID, l.ToZettelID, l.Line, l.Col, l.Kind, l.Type, l.Context, l.Anchor)
 		if err != nil {
 			return fmt.Errorf("Failed to insert zettel links: %v", err)
 		}
@@ -823,12 +1147,30 @@ func updateTags(tx *sqlx.Tx, z Zettel) error {
 	if err := removeTagLinks(tx, z.ID, remove); err != nil {
 		return fmt.Errorf("Error removing zettel-tag association: %v", err)
 	}
+	if err := updateTagLines(tx, z.ID, z.Tags); err != nil {
+		return fmt.Errorf("Error updating tag lines: %v", err)
+	}
 	if err := cleanTags(tx); err != nil {
 		return err
 	}
 	return nil
 }
 
+// updateTagLines records the line and column each tag of a zettel is
+// at for tags that moved.
+func updateTagLines(tx *sqlx.Tx, zettelID int, tags []Tag) error {
+	const query = `
+		UPDATE zettel_tags SET line = $1, col = $2
+		WHERE zettel_id = $3 AND (line != $1 OR col != $2)
+			AND tag_id = (SELECT id FROM tag WHERE name = $4);`
+	for _, t := range tags {
+		if _, err := tx.Exec(query, t.Line, t.Col, zettelID, t.Name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
 // currTags retrieves the current tags for a given zettel id.
 func currTags(tx *sqlx.Tx, id int) ([]Tag, error) {
 	var ct []Tag
@@ -881,13 +1223,13 @@ func diffTags(ct, nt []Tag) ([]Tag, []Tag) {
 // is used to create the zettel-tag associations.
 func insertTags(tx *sqlx.Tx, zettelID int, tags []Tag) error {
 	const (
-		insertTagSQL = `INSERT INTO tag (name)
-			VALUES ($1) ON CONFLICT(name)
+		insertTagSQL = `INSERT INTO tag (name, parent)
+			VALUES ($1, $2) ON CONFLICT(name)
 			DO NOTHING RETURNING id`
 		selectTagIDSQL = `SELECT id FROM tag
 			WHERE name = $1`
-		insertZettelTagSQL = `INSERT INTO zettel_tags (zettel_id, tag_id)
-			VALUES ($1, $2) ON CONFLICT DO NOTHING`
+		insertZettelTagSQL = `INSERT INTO zettel_tags (zettel_id, tag_id, line, col)
+			VALUES ($1, $2, $3, $4) ON CONFLICT DO NOTHING`
 	)
 
 	for _, tag := range tags {
@@ -900,14 +1242,14 @@ func insertTags(tx *sqlx.Tx, zettelID int, tags []Tag) error {
 				return fmt.Errorf("Failed to get tag id: %v", err)
 			}
 			// The tag doesn't exist, insert it and retrieve id.
-			err = tx.QueryRow(insertTagSQL, tag.Name).Scan(&tagID)
+			err = tx.QueryRow(insertTagSQL, tag.Name, TagParent(tag.Name)).Scan(&tagID)
 			if err != nil {
 				return fmt.Errorf("Error inserting tag: %v", err)
 			}
 		}
 
 		// Insert the zettel-tag association into the zettel_tags table
-		_, err = tx.Exec(insertZettelTagSQL, zettelID, tagID)
+		_, err = tx.Exec(insertZettelTagSQL, zettelID, tagID, tag.Line, tag.Col)
 		if err != nil {
 			return fmt.Errorf("Error inserting zettel-tag link: %v", err)
 		}
@@ -944,7 +1286,16 @@ func removeTagLinks(tx *sqlx.Tx, zettelID int, tags []Tag) error {
 // associated with any zettels. Thus, this function performs a clean up
 // process that removes any orphaned tags.
 func deleteFiles(tx *sqlx.Tx, zm map[string]Zettel) error {
-	const query = `DELETE FROM zettel WHERE id = $1;`
+	const (
+		query = `DELETE FROM zettel WHERE id = $1;`
+		// Links pointing at a deleted zettel become unresolved so they come
+		// back if the zettel does.
+		unresolveQuery = `
+		INSERT INTO unresolved_link (content, from_zettel_id, to_dir, line, col, kind, type, context, anchor)
+		SELECT content, from_zettel_id, $2, line, col, kind, type, context, anchor FROM link
+		WHERE to_zettel_id = $1 AND from_zettel_id != $1
+		ON CONFLICT DO NOTHING;`
+	)
 	stmt, err := tx.Prepare(query)
 	if err != nil {
 		return err
@@ -953,6 +1304,9 @@ func deleteFiles(tx *sqlx.Tx, zm map[string]Zettel) error {
 
 	// Iterate through each remaining file in the directory
 	for _, z := range zm {
+		if _, err := tx.Exec(unresolveQuery, z.ID, z.DirName); err != nil {
+			log.Printf("Error keeping links to file with id %d: %v", z.ID, err)
+		}
 		if _, err := stmt.Exec(z.ID); err != nil {
 			// Log the error but continue deleting other files
 			log.Printf("Error deleting file with id %d: %v", z.ID, err)
@@ -1022,28 +1376,22 @@ func (s *Storage) Merge(rootContent string) (string, error) {
 	rz := Zettel{}
 
 	var bodyLines []string
+	var front []string
 	isBody := false
-	// Match lines that contain a link. E.g., `* [dir][../dir] title`
-	linkRegex := regexp.MustCompile(`^.*(\[(.+)\]\(\.\./(.*?)/?\) (.+))`)
-
-	scanner := bufio.NewScanner(strings.NewReader(rootContent))
-	for scanner.Scan() {
-		line := scanner.Text()
 
-		// Is line the title?
-		if rz.Title == "" && strings.HasPrefix(line, `# `) {
-			rz.Title = strings.TrimPrefix(line, `# `)
+	for _, line := range markdown.Parse(rootContent) {
+		switch line.Kind {
+		case markdown.FrontMatter:
+			// Front matter of the root zettel is kept as it is.
+			front = append(front, line.Text)
+			continue
+		case markdown.Title:
+			rz.Title = strings.TrimPrefix(line.Text, `# `)
 			isBody = true
 			continue
-		}
-
-		// Is line a markdown link?
-		matches := linkRegex.FindStringSubmatch(line)
-		if len(matches) > 1 {
-			iso := matches[2]
-
+		case markdown.Link:
 			// Ensure zettel directory in the link is unique.
-			id, err := ZettelIdDir(tx, iso)
+			id, err := ZettelIdDir(tx, line.ISO)
 			if err != nil {
 				// If referenced zettel id couldn't be found, skip link
 				continue
@@ -1062,8 +1410,14 @@ func (s *Storage) Merge(rootContent string) (string, error) {
 			if z.Body != "" {
 				subZettel += z.Body + "\n"
 			}
-			for _, l := range z.Links {
-				subZettel += "* " + l.Content + "\n"
+			// Wiki and inline links are already part of the body, so only
+			// link lines are added back.
+			links := z.Links
+			sort.SliceStable(links, func(i, j int) bool { return links[i].Line < links[j].Line })
+			for _, l := range links {
+				if l.Kind == markdown.LinkLine {
+					subZettel += "* " + l.Content + "\n"
+				}
 			}
 			if len(z.Tags) > 0 {
 				var tags string
@@ -1079,12 +1433,15 @@ func (s *Storage) Merge(rootContent string) (string, error) {
 
 		// Everything else is considered as body.
 		if isBody {
-			bodyLines = append(bodyLines, line)
+			bodyLines = append(bodyLines, line.Text)
 		}
 	}
 
 	// Build merged content string.
 	mergedContent := ""
+	if len(front) > 0 {
+		mergedContent += strings.Join(front, "\n") + "\n"
+	}
 	if rz.Title != "" {
 		mergedContent += "# " + rz.Title + "\n"
 	}
@@ -2,11 +2,13 @@ package storage
 
 import (
 	"database/sql"
+	"errors"
 	"fmt"
 	"os"
 	"path/filepath"
 	"sort"
 	"strings"
+	"time"
 
 	"github.com/jmoiron/sqlx"
 )
@@ -48,7 +50,10 @@ func getTestTransaction() (*sqlx.Tx, error) {
 }
 
 func setupTestDB(db *sqlx.DB) error {
-	_, err := db.Exec(tablesSQL)
+	if _, err := migrate(db); err != nil {
+		return err
+	}
+	_, err := db.Exec(`PRAGMA foreign_keys = ON;`)
 	return err
 }
 
@@ -85,7 +90,7 @@ func insertDummyData(db *sqlx.DB) error {
 	return nil
 }
 
-func ExampleZettelsMap() {
+func Example_zettelsMap() {
 	db, err := getDBConnection()
 	if err != nil {
 		fmt.Printf("Failed to establish database connection: %v.\n", err)
@@ -98,7 +103,7 @@ func ExampleZettelsMap() {
 		return
 	}
 
-	s := Storage{db: db}
+	s := Storage{DB: db}
 
 	ez, err := s.zettelsMap()
 	if err != nil {
@@ -126,7 +131,7 @@ func ExampleZettelsMap() {
 	// ./20231028013045/outline.md id: 6
 }
 
-func ExampleProcessZettels_EmptyDB() {
+func Example_processZettels_emptyDB() {
 	tx, err := getTestTransaction()
 	if err != nil {
 		fmt.Printf("Failed to establish database connection: %v.\n", err)
@@ -158,9 +163,10 @@ func ExampleProcessZettels_EmptyDB() {
 	// ./20231028013010/README.md id: 2
 	// ./20231028013031/README.md id: 3
 	// ./20231028013031/outline.md id: 4
+	// ./20240108034433/README.md id: 5
 }
 
-func ExampleProcessZettels_Update() {
+func Example_processZettels_update() {
 	existingZettels := getTestZettelMap()
 	db, err := insertTestZettelMap(existingZettels)
 	if err != nil {
@@ -199,9 +205,10 @@ func ExampleProcessZettels_Update() {
 	// ./20231028013010/README.md id: 2
 	// ./20231028013031/README.md id: 3
 	// ./20231028013031/outline.md id: 4
+	// ./20240108034433/README.md id: 7
 }
 
-func ExampleProcessZettels_Delete() {
+func Example_processZettels_delete() {
 	existingZettels := getTestZettelMap()
 	db, err := insertTestZettelMap(existingZettels)
 	if err != nil {
@@ -252,11 +259,45 @@ func ExampleProcessZettels_Delete() {
 	// 20231028012959
 	// 20231028013010
 	// 20231028013031
+	// 20240108034433
 	// Files
 	// ./20231028012959/README.md id: 1
 	// ./20231028013010/README.md id: 2
 	// ./20231028013031/README.md id: 3
 	// ./20231028013031/outline.md id: 4
+	// ./20240108034433/README.md id: 7
+}
+
+// writeZet creates a temporary zet directory holding the zettels, keyed
+// by directory name, and syncs a database in it. The caller removes the
+// directory and closes the storage.
+func writeZet(zettels map[string]string) (string, *Storage, error) {
+	zetDir, err := os.MkdirTemp("", "zet")
+	if err != nil {
+		return "", nil, fmt.Errorf("Failed to create temporary zet directory: %v", err)
+	}
+	for d, content := range zettels {
+		if err := writeZettel(zetDir, d, content); err != nil {
+			os.RemoveAll(zetDir)
+			return "", nil, fmt.Errorf("Failed to write zettel: %v", err)
+		}
+	}
+	s, err := UpdateDB(zetDir, filepath.Join(zetDir, "data.db"))
+	if err != nil {
+		os.RemoveAll(zetDir)
+		return "", nil, fmt.Errorf("Failed to sync database: %v", err)
+	}
+	return zetDir, s, nil
+}
+
+// writeZettel writes the README.md of the zettel in directory dir of
+// zetDir, creating the directory if need be.
+func writeZettel(zetDir, dir, content string) error {
+	d := filepath.Join(zetDir, dir)
+	if err := os.MkdirAll(d, 0700); err != nil {
+		return err
+	}
+	return os.WriteFile(filepath.Join(d, "README.md"), []byte(content), 0644)
 }
 
 func getTestZettelMap() map[string]map[string]Zettel {
@@ -431,7 +472,7 @@ func insertTestZettelMap(zm map[string]map[string]Zettel) (*sqlx.DB, error) {
 	return db, nil
 }
 
-func ExampleAddZettel() {
+func Example_addZettel() {
 	testZetDir := filepath.Join("..", "testdata", "zet", "20231028013031")
 
 	tx, err := getTestTransaction()
@@ -469,7 +510,7 @@ func ExampleAddZettel() {
 	// ./20231028013031/outline.md id: 2
 }
 
-func ExampleProcessFiles_EmptyDB() {
+func Example_processFiles_emptyDB() {
 	tx, err := getTestTransaction()
 	if err != nil {
 		fmt.Printf("Failed to establish database connection: %v.\n", err)
@@ -554,7 +595,7 @@ See:
 	// 	tag2
 }
 
-func ExampleSearchZettels() {
+func ExampleStorage_SearchZettels() {
 	existingZettels := getTestZettelMap()
 	db, err := insertTestZettelMap(existingZettels)
 	if err != nil {
@@ -563,10 +604,10 @@ func ExampleSearchZettels() {
 	}
 	defer db.Close()
 
-	s := Storage{db: db}
+	s := Storage{DB: db}
 
 	term := `zettel productive`
-	zettels, err := s.SearchZettels(term, `[red]`, `[white]`)
+	zettels, err := s.SearchZettels(term, SearchOptions{Before: `[red]`, After: `[white]`})
 	if err != nil {
 		fmt.Printf("Error searching zettels: %v", err)
 		return
@@ -588,3 +629,1504 @@ func ExampleSearchZettels() {
 	// "4:         This is the [red]zettel[white] body\n"
 	//     #[red]productivity[white] #pkms
 }
+
+func ExampleStorage_SearchZettels_options() {
+	db, err := insertTestZettelMap(getTestZettelMap())
+	if err != nil {
+		fmt.Printf("Error inserting zettel map: %v", err)
+		return
+	}
+	defer db.Close()
+	s := Storage{DB: db}
+
+	// Markers are bound as parameters, so quotes in them are harmless.
+	opts := SearchOptions{Before: `'<`, After: `>');--`, Limit: 2, Snippets: SnippetNone}
+	zettels, err := s.SearchZettels(`zettel`, opts)
+	if err != nil {
+		fmt.Printf("Error searching zettels: %v", err)
+		return
+	}
+	for _, z := range zettels {
+		fmt.Printf("%s %s %q\n", z.DirName, z.TitleSnippet, z.BodySnippet)
+	}
+
+	opts = SearchOptions{Offset: 1, Weights: []float64{10, 0, 0}, Snippets: SnippetFragment}
+	zettels, err = s.SearchZettels(`zettel OR productivity`, opts)
+	if err != nil {
+		fmt.Printf("Error searching zettels: %v", err)
+		return
+	}
+	fmt.Println(len(zettels), "results after the first")
+
+	// Without markers, body lines with a match are still told apart.
+	zettels, err = s.SearchZettels(`body`, SearchOptions{})
+	if err != nil {
+		fmt.Printf("Error searching zettels: %v", err)
+		return
+	}
+	for _, z := range zettels {
+		fmt.Printf("%s %q\n", z.DirName, z.BodySnippet)
+	}
+
+	_, err = s.SearchZettels(`zettel +`, SearchOptions{})
+	fmt.Println(errors.Is(err, ErrQuerySyntax), err)
+	_, err = s.SearchZettels(`zettel`, SearchOptions{Limit: -1})
+	fmt.Println(errors.Is(err, ErrSearchOptions), err)
+
+	// Output:
+	// 20231028013031 '<Zettel>');-- 3 ""
+	// 20231028012959 '<Zettel>');-- 1 ""
+	// 2 results after the first
+	// 20231028012959 "4:         This is the zettel body\n"
+	// 20231028013010 "4:         This is the zettel body\n"
+	// true syntax error near ""
+	// true invalid search options: negative limit -1
+}
+
+func Example_processFiles_olderMtime() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Old title\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	s.Close()
+	dbPath := filepath.Join(zetDir, "data.db")
+	fp := filepath.Join(zetDir, "20231028012959", "README.md")
+
+	// Rewrite the zettel and set its mtime into the past, as a git
+	// checkout or rsync might.
+	if err := os.WriteFile(fp, []byte("# New title\n"), 0644); err != nil {
+		fmt.Printf("Failed to write zettel: %v\n", err)
+		return
+	}
+	past := time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC)
+	if err := os.Chtimes(fp, past, past); err != nil {
+		fmt.Printf("Failed to set mtime: %v\n", err)
+		return
+	}
+
+	s, err = UpdateDB(zetDir, dbPath)
+	if err != nil {
+		fmt.Printf("Failed to sync database: %v\n", err)
+		return
+	}
+	defer s.Close()
+
+	zettels, err := s.AllZettels("")
+	if err != nil {
+		fmt.Printf("Failed to get zettels: %v\n", err)
+		return
+	}
+	for _, z := range zettels {
+		fmt.Printf("%s %s\n", z.DirName, z.Title)
+	}
+
+	// Output:
+	// 20231028012959 New title
+}
+
+func ExampleStorage_SyncZettel() {
+	zetDir, s, err := writeZet(nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	d := filepath.Join(zetDir, "20231028012959")
+	if err := writeZettel(zetDir, "20231028012959", "# Added\n"); err != nil {
+		fmt.Printf("Failed to write zettel: %v\n", err)
+		return
+	}
+
+	printZettels := func() {
+		zettels, err := s.AllZettels("")
+		if err != nil {
+			fmt.Printf("Failed to get zettels: %v\n", err)
+			return
+		}
+		fmt.Printf("%d zettels\n", len(zettels))
+		for _, z := range zettels {
+			fmt.Printf("%s %s\n", z.DirName, z.Title)
+		}
+	}
+
+	if err := s.SyncZettel(zetDir, "20231028012959"); err != nil {
+		fmt.Printf("Failed to sync zettel: %v\n", err)
+		return
+	}
+	printZettels()
+
+	if err := os.RemoveAll(d); err != nil {
+		fmt.Printf("Failed to remove zettel directory: %v\n", err)
+		return
+	}
+	if err := s.SyncZettel(zetDir, "20231028012959"); err != nil {
+		fmt.Printf("Failed to sync zettel: %v\n", err)
+		return
+	}
+	printZettels()
+
+	// Output:
+	// 1 zettels
+	// 20231028012959 Added
+	// 0 zettels
+}
+
+func ExampleWatcherAlive() {
+	d, err := os.MkdirTemp("", "zet")
+	if err != nil {
+		fmt.Printf("Failed to create temporary directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(d)
+	dbPath := filepath.Join(d, "data.db")
+
+	fmt.Println("no heartbeat:", WatcherAlive(dbPath))
+	if err := Heartbeat(dbPath); err != nil {
+		fmt.Printf("Failed to write heartbeat: %v\n", err)
+		return
+	}
+	fmt.Println("heartbeat:", WatcherAlive(dbPath))
+
+	// A fresh heartbeat naming a process that is gone, as left behind by
+	// a watcher that crashed.
+	if err := os.WriteFile(dbPath+".watch", []byte("999999999\n"), 0644); err != nil {
+		fmt.Printf("Failed to write heartbeat: %v\n", err)
+		return
+	}
+	fmt.Println("crashed watcher:", WatcherAlive(dbPath))
+
+	// Output:
+	// no heartbeat: false
+	// heartbeat: true
+	// crashed watcher: false
+}
+
+func Example_processZettels_links() {
+	tx, err := getTestTransaction()
+	if err != nil {
+		fmt.Printf("Failed to establish database connection: %v.\n", err)
+		return
+	}
+	defer tx.Rollback()
+
+	testZetDir := filepath.Join("..", "testdata", "zet")
+
+	if err := processZettels(tx, testZetDir, make(map[string]map[string]Zettel)); err != nil {
+		fmt.Printf("Failed to process zettels: %v\n", err)
+		return
+	}
+
+	// Links to zettels visited later in the same pass must not be lost.
+	links := []struct {
+		From string `db:"from_dir"`
+		To   string `db:"to_dir"`
+		Line int    `db:"line"`
+	}{}
+	const query = `
+		SELECT f.dir_name AS from_dir, t.dir_name AS to_dir, l.line
+		FROM link l
+		JOIN zettel f ON f.id = l.from_zettel_id
+		JOIN zettel t ON t.id = l.to_zettel_id
+		ORDER BY from_dir, l.line;`
+	if err := tx.Select(&links, query); err != nil {
+		fmt.Printf("Failed to select links: %v\n", err)
+		return
+	}
+	for _, l := range links {
+		fmt.Printf("%s:%d -> %s\n", l.From, l.Line, l.To)
+	}
+
+	// Output:
+	// 20231028013010:16 -> 20240108034433
+	// 20231028013010:17 -> 20231028013031
+	// 20240108034433:7 -> 20231028013010
+}
+
+func Example_resolveLinks() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Source\n\n* [20231028013010](../20231028013010) Target\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	s.Close()
+	dbPath := filepath.Join(zetDir, "data.db")
+
+	sync := func() {
+		s, err := UpdateDB(zetDir, dbPath)
+		if err != nil {
+			fmt.Printf("Failed to sync database: %v\n", err)
+			return
+		}
+		defer s.Close()
+		var links, unresolved int
+		s.DB.Get(&links, `SELECT COUNT(*) FROM link`)
+		s.DB.Get(&unresolved, `SELECT COUNT(*) FROM unresolved_link`)
+		fmt.Printf("links: %d unresolved: %d\n", links, unresolved)
+	}
+
+	sync()
+
+	// The target appears later without the source being touched.
+	if err := writeZettel(zetDir, "20231028013010", "# Target\n"); err != nil {
+		fmt.Printf("Failed to write zettel: %v\n", err)
+		return
+	}
+	sync()
+
+	// Removing the target keeps the link around as unresolved.
+	if err := os.RemoveAll(filepath.Join(zetDir, "20231028013010")); err != nil {
+		fmt.Printf("Failed to remove zettel: %v\n", err)
+		return
+	}
+	sync()
+
+	// Output:
+	// links: 0 unresolved: 1
+	// links: 1 unresolved: 0
+	// links: 0 unresolved: 1
+}
+
+func ExampleStorage_BrokenLinks() {
+	existingZettels := getTestZettelMap()
+	db, err := insertTestZettelMap(existingZettels)
+	if err != nil {
+		fmt.Printf("Error inserting zettel map: %v", err)
+		return
+	}
+	defer db.Close()
+	tx, err := db.Beginx()
+	if err != nil {
+		return
+	}
+
+	const e = `# Example Title
+
+* [20231028013031](../20231028013031) Some linked Zettel
+* [20240000003031](../20240000003031) Non-existent Zettel`
+
+	z := &Zettel{Name: "README.md", DirName: "20231028012959", ID: 1}
+	SplitZettel(tx, z, e)
+	if err := updateFile(tx, *z); err != nil {
+		fmt.Printf("Failed to update zettel: %v\n", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Failed to commit: %v\n", err)
+		return
+	}
+
+	s := Storage{DB: db}
+	links, err := s.BrokenLinks()
+	if err != nil {
+		fmt.Printf("Failed to get broken links: %v\n", err)
+		return
+	}
+	for _, l := range links {
+		fmt.Printf("%s/%s:%d: %s %s\n", l.FromDir, l.FromName, l.Line, l.ToDir, l.Content)
+	}
+
+	// Output:
+	// 20231028012959/README.md:4: 20240000003031 [20240000003031](../20240000003031) Non-existent Zettel
+}
+
+func ExampleStorage_Backlinks() {
+	db, err := getDBConnection()
+	if err != nil {
+		fmt.Printf("Failed to establish database connection: %v.\n", err)
+		return
+	}
+	defer db.Close()
+	tx, err := db.Beginx()
+	if err != nil {
+		return
+	}
+
+	testZetDir := filepath.Join("..", "testdata", "zet")
+	if err := processZettels(tx, testZetDir, make(map[string]map[string]Zettel)); err != nil {
+		fmt.Printf("Failed to process zettels: %v\n", err)
+		return
+	}
+	if err := tx.Commit(); err != nil {
+		fmt.Printf("Failed to commit: %v\n", err)
+		return
+	}
+
+	s := Storage{DB: db}
+	id, err := ZettelIdDir(s.DB, "20231028013031")
+	if err != nil {
+		fmt.Printf("Failed to find zettel: %v\n", err)
+		return
+	}
+	links, err := s.Backlinks(id)
+	if err != nil {
+		fmt.Printf("Failed to get backlinks: %v\n", err)
+		return
+	}
+	for _, l := range links {
+		fmt.Printf("%s:%d %s\n", l.FromDir, l.Line, l.FromTitle)
+	}
+
+	// Output:
+	// 20231028013010:17 Context for conceptual linking
+}
+
+func ExampleStorage_Backlinks_repeated() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Source\n\nSee [[20231028013010]] and [[20231028013010]].\n\nAgain [[20231028013010]], and [[20240000000000]] twice [[20240000000000]].\n",
+		"20231028013010": "# Target\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	id, err := ZettelIdDir(s.DB, "20231028013010")
+	if err != nil {
+		fmt.Printf("Failed to find zettel: %v\n", err)
+		return
+	}
+	links, err := s.Backlinks(id)
+	if err != nil {
+		fmt.Printf("Failed to get backlinks: %v\n", err)
+		return
+	}
+	for _, l := range links {
+		fmt.Printf("%s:%d:%d %s\n", l.FromDir, l.Line, l.Col, l.Content)
+	}
+	broken, err := s.BrokenLinks()
+	if err != nil {
+		fmt.Printf("Failed to get broken links: %v\n", err)
+		return
+	}
+	for _, l := range broken {
+		fmt.Printf("%s:%d:%d %s\n", l.FromDir, l.Line, l.Col, l.Content)
+	}
+
+	// Output:
+	// 20231028012959:3:5 [[20231028013010]]
+	// 20231028012959:3:28 [[20231028013010]]
+	// 20231028012959:5:7 [[20231028013010]]
+	// 20231028012959:5:31 [[20240000000000]]
+	// 20231028012959:5:56 [[20240000000000]]
+}
+
+func ExampleMigrateDB() {
+	d, err := os.MkdirTemp("", "zet")
+	if err != nil {
+		fmt.Printf("Failed to create temporary directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(d)
+	dbPath := filepath.Join(d, "data.db")
+
+	// Create a database the way zet did before migrations existed.
+	db, err := sqlx.Connect("sqlite", dbPath)
+	if err != nil {
+		fmt.Printf("Failed to connect to database: %v\n", err)
+		return
+	}
+	if _, err := db.Exec(tablesSQL); err != nil {
+		fmt.Printf("Failed to create legacy schema: %v\n", err)
+		return
+	}
+	db.Close()
+
+	for _, dryRun := range []bool{true, false, false} {
+		ms, v, err := MigrateDB(dbPath, dryRun)
+		if err != nil {
+			fmt.Printf("Failed to migrate: %v\n", err)
+			return
+		}
+		latest := migrations[len(migrations)-1].Version
+		fmt.Printf("dry run: %t from latest: %t all migrations: %t none: %t\n",
+			dryRun, v == latest, len(ms) == len(migrations), len(ms) == 0)
+	}
+
+	s, err := OpenDB(dbPath)
+	if err != nil {
+		fmt.Printf("Failed to open database: %v\n", err)
+		return
+	}
+	defer s.Close()
+	var n int
+	s.DB.Get(&n, `SELECT COUNT(*) FROM pragma_table_info('zettel') WHERE name IN ('hash', 'size')`)
+	fmt.Println("hash columns:", n)
+
+	// Output:
+	// dry run: true from latest: false all migrations: true none: false
+	// dry run: false from latest: false all migrations: true none: false
+	// dry run: false from latest: true all migrations: false none: true
+	// hash columns: 2
+}
+
+func ExampleStorage_Diagnose() {
+	db, err := getDBConnection()
+	if err != nil {
+		fmt.Printf("Failed to establish database connection: %v.\n", err)
+		return
+	}
+	defer db.Close()
+	s := &Storage{DB: db}
+
+	testZetDir := filepath.Join("..", "testdata", "zet")
+	tx, err := db.Beginx()
+	if err != nil {
+		fmt.Printf("Failed to create transaction: %v\n", err)
+		return
+	}
+	if err := processZettels(tx, testZetDir, make(map[string]map[string]Zettel)); err != nil {
+		fmt.Printf("Failed to process zettels: %v\n", err)
+		return
+	}
+	tx.Commit()
+
+	// Leave the database in the state a crashed sync or a broken trigger
+	// might.
+	_, err = db.Exec(`
+		PRAGMA foreign_keys = OFF;
+		DELETE FROM zettel WHERE dir_name = '20240108034433';
+		UPDATE zettel_fts SET title = 'stale'
+			WHERE rowid = (SELECT id FROM zettel WHERE dir_name = '20231028012959');
+		UPDATE section_fts SET body = 'stale'
+			WHERE rowid = (SELECT MIN(s.id) FROM section s
+				JOIN zettel z ON z.id = s.zettel_id
+				WHERE z.dir_name = '20231028012959');
+		INSERT INTO dir (name) VALUES ('20000101000000');
+		INSERT INTO zettel (name, title, body, mtime, dir_name)
+			VALUES ('README.md', 'Gone', '', '', '20000101000000');
+		PRAGMA foreign_keys = ON;`)
+	if err != nil {
+		fmt.Printf("Failed to break database: %v\n", err)
+		return
+	}
+
+	problems, err := s.Diagnose(testZetDir)
+	if err != nil {
+		fmt.Printf("Failed to diagnose database: %v\n", err)
+		return
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+
+	if err := s.Repair(testZetDir); err != nil {
+		fmt.Printf("Failed to repair database: %v\n", err)
+		return
+	}
+	problems, err = s.Diagnose(testZetDir)
+	if err != nil {
+		fmt.Printf("Failed to diagnose database: %v\n", err)
+		return
+	}
+	fmt.Println("remaining problems:", len(problems))
+
+	var broken []string
+	if err := db.Select(&broken, `SELECT to_dir FROM unresolved_link;`); err != nil {
+		fmt.Printf("Failed to select unresolved links: %v\n", err)
+		return
+	}
+	fmt.Println("broken links to:", broken)
+
+	// Output:
+	// fts: 20231028012959/README.md is out of date in search index
+	// fts: 20231028012959/README.md#zet-tool-scope-and-objective is out of date in section index
+	// links: link 1 from zettel 5 to zettel 2 refers to a missing zettel: [20231028013010](../20231028013010) Context for conceptual linking
+	// links: link 2 from zettel 2 to zettel 5 refers to a missing zettel: [20240108034433](../20240108034433) Linking conventions
+	// dirs: directory 20240108034433 has no zettels
+	// files: directory 20000101000000 no longer exists
+	// remaining problems: 0
+	// broken links to: [20240108034433]
+}
+
+func ExampleStorage_Repair() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Source\n\nSee [[20231028013010|target]] and [its intro](../20231028013010#intro).\n",
+		"20231028013010": "# Target\n\n## Intro\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	// Drop the target without turning the links to it into unresolved
+	// links, the way a crashed sync might.
+	_, err = s.DB.Exec(`
+		PRAGMA foreign_keys = OFF;
+		DELETE FROM zettel WHERE dir_name = '20231028013010';
+		PRAGMA foreign_keys = ON;`)
+	if err != nil {
+		fmt.Printf("Failed to break database: %v\n", err)
+		return
+	}
+	if err := s.Repair(zetDir); err != nil {
+		fmt.Printf("Failed to repair database: %v\n", err)
+		return
+	}
+
+	links, err := s.BrokenLinks()
+	if err != nil {
+		fmt.Printf("Failed to get broken links: %v\n", err)
+		return
+	}
+	for _, l := range links {
+		fmt.Printf("%s %q\n", l.ToDir, l.Anchor)
+	}
+
+	// Output:
+	// 20231028013010 ""
+	// 20231028013010 "intro"
+}
+
+func ExampleStorage_MoveZettel() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Source\n\n* [20231028013010](../20231028013010) Target\n",
+		"20231028013010": "# Target\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	// Rename the target and rewrite the link to it the way zet mv does.
+	if err := os.Rename(filepath.Join(zetDir, "20231028013010"), filepath.Join(zetDir, "target")); err != nil {
+		fmt.Printf("Failed to rename zettel: %v\n", err)
+		return
+	}
+	if err := writeZettel(zetDir, "20231028012959", "# Source\n\n* [target](../target) Target\n"); err != nil {
+		fmt.Printf("Failed to write zettel: %v\n", err)
+		return
+	}
+	if err := s.MoveZettel(zetDir, "20231028013010", "target", []string{"20231028012959"}); err != nil {
+		fmt.Printf("Failed to move zettel: %v\n", err)
+		return
+	}
+
+	var dirs []string
+	s.DB.Select(&dirs, `SELECT name FROM dir ORDER BY name`)
+	var links []string
+	s.DB.Select(&links, `SELECT content FROM link`)
+	var unresolved int
+	s.DB.Get(&unresolved, `SELECT COUNT(*) FROM unresolved_link`)
+	fmt.Println(dirs)
+	fmt.Println(links)
+	fmt.Println("unresolved:", unresolved)
+
+	// Output:
+	// [20231028012959 target]
+	// [[target](../target) Target]
+	// unresolved: 0
+}
+
+func ExampleStorage_StaleLinks() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Source\n\n* [20231028013010](../20231028013010) Old title\n* [20231028013031](../20231028013031) Current\n",
+		"20231028013010": "# New title\n",
+		"20231028013031": "# Current\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	links, err := s.StaleLinks()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, l := range links {
+		fmt.Printf("%s:%d: %q -> %q\n", l.FromDir, l.Line, LinkTitle(l.Content), l.ToTitle)
+	}
+
+	// Output:
+	// 20231028012959:3: "Old title" -> "New title"
+}
+
+func ExampleStorage_TagCounts() {
+	db, err := getDBConnection()
+	if err != nil {
+		fmt.Printf("Failed to establish database connection: %v.\n", err)
+		return
+	}
+	defer db.Close()
+	s := &Storage{DB: db}
+
+	tx, err := db.Beginx()
+	if err != nil {
+		fmt.Printf("Failed to create transaction: %v\n", err)
+		return
+	}
+	testZetDir := filepath.Join("..", "testdata", "zet")
+	if err := processZettels(tx, testZetDir, make(map[string]map[string]Zettel)); err != nil {
+		fmt.Printf("Failed to process zettels: %v\n", err)
+		return
+	}
+	tx.Commit()
+
+	tags, err := s.TagCounts("name")
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, t := range tags {
+		fmt.Println(t.Name, t.Count)
+	}
+	zettels, err := s.TaggedZettels([]string{"pkms", "missing"})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, z := range zettels {
+		fmt.Println(z.DirName, z.Title)
+	}
+
+	// Output:
+	// pkms 1
+	// productivity 1
+	// 20231028012959 Zet tool scope and objective
+}
+
+func Example_parseTagTerm() {
+	pq, err := ParseQuery(`context tags:lang/* #: lang//go tags:pro* tags:"quoted"`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%q\n", pq.Text)
+	for _, f := range pq.filters {
+		f := f.(tagFilter)
+		fmt.Printf("%s descendants=%t prefix=%t\n", f.name, f.descendants, f.prefix)
+	}
+	// Output:
+	// "context tags:\"quoted\""
+	// lang descendants=true prefix=false
+	// lang/go descendants=false prefix=false
+	// pro descendants=false prefix=true
+}
+
+func ExampleStorage_TagTree() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Go\n\n    #lang/go #cli\n",
+		"20231028013010": "# Go and Rust\n\n    #lang/go #lang/rust\n",
+		"20231028013031": "# Languages\n\n    #lang\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	roots, err := s.TagTree()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	var print func(n *TagNode, depth int)
+	print = func(n *TagNode, depth int) {
+		fmt.Printf("%s%s count=%d total=%d\n", strings.Repeat("  ", depth), n.Label(), n.Count, n.Total)
+		for _, c := range n.Children {
+			print(c, depth+1)
+		}
+	}
+	for _, n := range roots {
+		print(n, 0)
+	}
+
+	results, err := s.SearchZettels("tags:lang/*", SearchOptions{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("tags:lang/* matches", len(results))
+	results, err = s.SearchZettels("tags:lang", SearchOptions{})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Println("tags:lang matches", len(results))
+
+	// Output:
+	// cli count=1 total=1
+	// lang count=1 total=3
+	//   go count=2 total=2
+	//   rust count=1 total=1
+	// tags:lang/* matches 3
+	// tags:lang matches 1
+}
+
+func ExampleParseInlineTags() {
+	const content = "# Title with #notatag\n" +
+		"\n" +
+		"An #idea worth keeping, see https://example.com/#anchor and\n" +
+		"[docs](https://example.com/docs#intro). Not an issue#1 either.\n" +
+		"Inline `#code` is skipped but (#lang/go) is not. #idea again.\n" +
+		"\n" +
+		"```sh\n" +
+		"# comment #shell\n" +
+		"```\n" +
+		"\n" +
+		"## Heading #skipped\n" +
+		"\n" +
+		"* [20231028013031](../20231028013031) Linked #title\n" +
+		"\n" +
+		"    #tagline"
+	for _, t := range ParseInlineTags(content) {
+		fmt.Printf("%s %d:%d\n", t.Name, t.Line, t.Col)
+	}
+	// Output:
+	// idea 3:4
+	// lang/go 5:32
+}
+
+func ExampleSplitZettel_inlineTags() {
+	InlineTags = true
+	defer func() { InlineTags = false }()
+
+	z := &Zettel{}
+	SplitZettel(nil, z, "# Title\n\nAn #idea and a #tag.\n\n    #tag #other")
+	for _, t := range z.Tags {
+		fmt.Printf("%s %d:%d\n", t.Name, t.Line, t.Col)
+	}
+	// Output:
+	// tag 5:5
+	// other 5:10
+	// idea 3:4
+}
+
+func ExampleStorage_SetSetting() {
+	defer func() { InlineTags = false }()
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Title\n\nAn #idea.\n\n    #tag\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	s.Close()
+	dbPath := filepath.Join(zetDir, "data.db")
+
+	printTags := func(s *Storage) {
+		var tags []string
+		s.DB.Select(&tags, `SELECT name FROM tag t JOIN zettel_tags zt ON zt.tag_id = t.id ORDER BY name`)
+		v, _ := s.Setting(SettingInlineTags)
+		fmt.Println(v, tags)
+	}
+
+	s, err = OpenDB(dbPath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	if _, err := s.SetSetting(SettingInlineTags, "on"); err != nil {
+		fmt.Printf("Failed to change setting: %v\n", err)
+		return
+	}
+	if err := s.Sync(zetDir); err != nil {
+		fmt.Printf("Failed to sync: %v\n", err)
+		return
+	}
+	printTags(s)
+	s.Close()
+
+	// Another process opening the database uses the stored setting.
+	InlineTags = false
+	s, err = UpdateDB(zetDir, dbPath)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer s.Close()
+	printTags(s)
+
+	_, err = s.SetSetting(SettingInlineTags, "maybe")
+	fmt.Println(err)
+
+	// Output:
+	// true [idea tag]
+	// true [idea tag]
+	// Invalid value "maybe", expected on or off
+}
+
+func ExampleSplitZettel_frontMatter() {
+	content := `---
+# a comment, not a title
+aliases:
+  - Golang
+  - "Go language"
+tags: [lang/go, "#cli"]
+status: draft # still writing
+source: https://go.dev/doc/
+created: 2024-01-31
+---
+# Go
+
+Body.
+
+    #lang/go #tools`
+
+	z := &Zettel{}
+	SplitZettel(nil, z, content)
+	fmt.Printf("%q\n%q\n", z.Title, z.Body)
+	for _, t := range z.Tags {
+		fmt.Printf("#%s %d\n", t.Name, t.Line)
+	}
+	for _, m := range z.Meta {
+		fmt.Printf("%s=%s %d\n", m.Key, m.Value, m.Line)
+	}
+	// Output:
+	// "Go"
+	// "\nBody.\n"
+	// #lang/go 15
+	// #tools 15
+	// #cli 6
+	// aliases=Golang 4
+	// aliases=Go language 5
+	// tags=lang/go 6
+	// tags=#cli 6
+	// status=draft 7
+	// source=https://go.dev/doc/ 8
+	// created=2024-01-31 9
+}
+
+func Example_parseMetaTerm() {
+	pq, err := ParseQuery(`go status:draft alias:Golang source:book* meta:project=zet title:go`)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	fmt.Printf("%q\n", pq.Text)
+	for _, f := range pq.filters {
+		f := f.(metaFilter)
+		fmt.Printf("%s=%s prefix=%t\n", f.key, f.value, f.prefix)
+	}
+	// Output:
+	// "go title:go"
+	// status=draft prefix=false
+	// aliases=Golang prefix=false
+	// source=book prefix=true
+	// project=zet prefix=false
+}
+
+func ExampleStorage_SearchZettels_frontMatter() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "---\nstatus: draft\naliases: [golang]\ncreated: 2024-01-31\n---\n# Go\n\nA language.\n",
+		"20231028013010": "---\nstatus: done\nproject: zet\ntags: cli\n---\n# Zet\n\nA tool written in go.\n",
+		"20231028013031": "# Rust\n\nAnother language.\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	for _, q := range []string{"status:DRAFT", "alias:golang", "created:2024*", "meta:project=zet go", "tags:cli", "language status:draft", "status"} {
+		results, err := s.SearchZettels(q, SearchOptions{})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		var titles []string
+		for _, r := range results {
+			titles = append(titles, r.Title)
+		}
+		fmt.Printf("%s: %v\n", q, titles)
+	}
+
+	// Output:
+	// status:DRAFT: [Go]
+	// alias:golang: [Go]
+	// created:2024*: [Go]
+	// meta:project=zet go: [Zet]
+	// tags:cli: [Zet]
+	// language status:draft: [Go]
+	// status: []
+}
+
+func ExampleSplitZettel_code() {
+	content := "```sh\n" +
+		"# not the title\n" +
+		"```\n" +
+		"# C notes\n" +
+		"\n" +
+		"    #include <stdio.h>\n" +
+		"    #define MAX 10\n" +
+		"\n" +
+		"```\n" +
+		"* [20231028013031](../20231028013031) Not a link\n" +
+		"    #not #tags\n" +
+		"```\n" +
+		"\n" +
+		"    #c #lang/c"
+
+	z := &Zettel{}
+	SplitZettel(nil, z, content)
+	fmt.Printf("Title: %s\n", z.Title)
+	fmt.Printf("Links: %d %d\n", len(z.Links), len(z.Unresolved))
+	for _, t := range z.Tags {
+		fmt.Printf("#%s %d\n", t.Name, t.Line)
+	}
+	// Output:
+	// Title: C notes
+	// Links: 0 0
+	// #c 14
+	// #lang/c 14
+}
+
+func ExampleStorage_AllLinks() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Links\n\nSee [[20231028013010]] and [[20231028013031|rust]] or [go](../20231028013010).\n\n* [20231028013031](../20231028013031) Rust\n* [[20231028013042]]\n\nGo is simple[^1].\n\n[^1]: [20231028013010](../20231028013010) Go\n",
+		"20231028013010": "# Go\n",
+		"20231028013031": "# Rust\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	links, err := s.AllLinks()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, l := range links {
+		fmt.Printf("%d %s %s %s: %s\n", l.Line, l.Kind, l.Type, l.Content, l.Context)
+	}
+	broken, err := s.BrokenLinks()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, l := range broken {
+		fmt.Printf("broken: %d %s %s\n", l.Line, l.Kind, l.Content)
+	}
+
+	// Output:
+	// 3 wiki inline [[20231028013010]]: See [[20231028013010]] and [[20231028013031|rust]] or [go](../20231028013010).
+	// 3 wiki inline [[20231028013031|rust]]: See [[20231028013010]] and [[20231028013031|rust]] or [go](../20231028013010).
+	// 3 inline inline [go](../20231028013010): See [[20231028013010]] and [[20231028013031|rust]] or [go](../20231028013010).
+	// 5 line see-also [20231028013031](../20231028013031) Rust: [20231028013031](../20231028013031) Rust
+	// 10 line footnote [20231028013010](../20231028013010) Go: Go is simple[^1].
+	// broken: 6 wiki [[20231028013042]]
+}
+
+func ExampleStorage_MissingAnchors() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Links\n\nSee [the summary](../20231028013010#summary) and [[20231028013010#Chapter-2]].\n\n* [20231028013010](../20231028013010#chapter-3) Book\n",
+		"20231028013010": "# Book\n\n## Chapter 1\n\nText.\n\n## Chapter 2\n\nMore text.\n\n## Summary\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	id, err := ZettelIdDir(s.DB, "20231028013010")
+	if err != nil {
+		fmt.Printf("Failed to find zettel: %v\n", err)
+		return
+	}
+	sections, err := s.ZettelSections(id)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, sec := range sections {
+		fmt.Printf("%d-%d #%s %q\n", sec.Start, sec.End, sec.Anchor, sec.Body)
+	}
+	links, err := s.MissingAnchors()
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	for _, l := range links {
+		fmt.Printf("missing: %s:%d %s#%s\n", l.FromDir, l.Line, l.ToDir, l.Anchor)
+	}
+
+	// Output:
+	// 1-2 #book ""
+	// 3-6 #chapter-1 "Text."
+	// 7-10 #chapter-2 "More text."
+	// 11-11 #summary ""
+	// missing: 20231028012959:5 20231028013010#chapter-3
+}
+
+func ExampleStorage_SearchZettels_sections() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028013010": "# Book\n\nNotes on a long book.\n\n## Chapter 1\n\nOn habits.\n\n## Chapter 2\n\nOn compound interest.\n\n    #money\n",
+		"20231028013031": "# Essay\n\n## Rates\n\nInterest rates and habits of interest.\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	for _, q := range []string{"interest", "habits", "book", `interest tags:"money"`, `tags:"money"`} {
+		results, err := s.SearchZettels(q, SearchOptions{Before: "[", After: "]"})
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		for _, r := range results {
+			fmt.Printf("%s: %s %s #%s\n", q, r.DirName, r.Section.Heading, r.Section.Anchor)
+		}
+	}
+
+	// Output:
+	// interest: 20231028013031 Rates #rates
+	// interest: 20231028013010 Chapter 2 #chapter-2
+	// habits: 20231028013031 Rates #rates
+	// habits: 20231028013010 Chapter 1 #chapter-1
+	// book: 20231028013010 Book #book
+	// interest tags:"money": 20231028013010 Chapter 2 #chapter-2
+	// tags:"money": 20231028013010  #
+}
+
+func Example_parseQuery() {
+	now := time.Date(2024, 3, 15, 12, 0, 0, 0, time.UTC)
+	for _, q := range []string{
+		`go -tag:draft`,
+		`created:>2024-01 modified:<7d`,
+		`created:2024 words:<=300`,
+		`t:proxy -b:forward has:links orphan:false`,
+		`tag:`,
+		`colour:red`,
+		`-reverse proxy`,
+		`words:many`,
+		`created:last-week`,
+		`title:(go`,
+		`"go`,
+		`tag:go OR tag:rust`,
+		`NOT tag:go`,
+		`go OR tag:go`,
+		`(go OR tag:go)`,
+		`(go OR rust) -(tag:draft has:links) NOT zig`,
+		`go OR`,
+		`AND go`,
+		`go ()`,
+		`go)`,
+	} {
+		pq, err := parseQuery(q, now)
+		if err != nil {
+			fmt.Printf("%s => error: %v\n", q, err)
+			continue
+		}
+		var args []any
+		for _, f := range pq.filters {
+			args = append(args, f.args()...)
+		}
+		fmt.Printf("%s => %q %q %v\n", q, pq.Text, pq.Filters, args)
+	}
+	// Output:
+	// go -tag:draft => "go" ["-tag:draft"] [draft]
+	// created:>2024-01 modified:<7d => "" ["created:>2024-01" "modified:<7d"] [20240201000000 20240308120000]
+	// created:2024 words:<=300 => "" ["created:2024" "words:<=300"] [20240101000000 20250101000000 300]
+	// t:proxy -b:forward has:links orphan:false => "title:proxy NOT body:forward" ["has:links" "orphan:false"] []
+	// tag: => error: tag:: missing value
+	// colour:red => error: colour:red: unknown filter
+	// -reverse proxy => "proxy NOT reverse" [] []
+	// words:many => error: words:many: expected a number of words
+	// created:last-week => error: created:last-week: expected a date such as 2024-01-31 or a duration such as 7d
+	// title:(go => error: missing )
+	// "go => error: missing closing "
+	// tag:go OR tag:rust => "" ["(tag:go OR tag:rust)"] [go rust]
+	// NOT tag:go => "" ["NOT tag:go"] [go]
+	// go OR tag:go => "" ["(go OR tag:go)"] [go go]
+	// (go OR tag:go) => "" ["(go OR tag:go)"] [go go]
+	// (go OR rust) -(tag:draft has:links) NOT zig => "(go OR rust) NOT zig" ["-(tag:draft has:links)"] [draft]
+	// go OR => error: OR: missing term after it
+	// AND go => error: AND: missing term before it
+	// go () => error: (): empty group
+	// go) => error: unexpected )
+}
+
+func ExampleStorage_SearchZettels_query() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Go\n\nA small language. See [[20240108034433]].\n\n    #lang/go\n",
+		"20240108034433": "# Rust\n\nA language with a borrow checker and many more words than the others.\n\n    #lang/rust #draft\n",
+		"20240215000000": "---\ncreated: 2023-12-01\n---\n# Zig\n\nA language.\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	for _, q := range []string{
+		"language -tag:draft",
+		"tag:lang/*",
+		"links-to:20240108034433",
+		"linked-from:20231028012959",
+		"orphan:true",
+		"has:tags -has:links",
+		"created:<2024",
+		"words:>5",
+		"language -borrow",
+		"language AND",
+		"tag:lang/go OR tag:draft",
+		"NOT tag:draft",
+		"zig OR tag:lang/go",
+		"(zig OR tag:lang/go) -small",
+		"language -(borrow OR small)",
+	} {
+		results, err := s.SearchZettels(q, SearchOptions{Before: "[", After: "]"})
+		if err != nil {
+			fmt.Printf("%s: error: %v\n", q, err)
+			continue
+		}
+		var titles []string
+		for _, r := range results {
+			titles = append(titles, r.Title)
+		}
+		sort.Strings(titles)
+		fmt.Printf("%s: %v\n", q, titles)
+	}
+
+	// Output:
+	// language -tag:draft: [Go Zig]
+	// tag:lang/*: [Go Rust]
+	// links-to:20240108034433: [Go]
+	// linked-from:20231028012959: [Rust]
+	// orphan:true: [Zig]
+	// has:tags -has:links: [Rust]
+	// created:<2024: [Go Zig]
+	// words:>5: [Rust]
+	// language -borrow: [Go Zig]
+	// language AND: error: AND: missing term after it
+	// tag:lang/go OR tag:draft: [Go Rust]
+	// NOT tag:draft: [Go Zig]
+	// zig OR tag:lang/go: [Go Zig]
+	// (zig OR tag:lang/go) -small: [Zig]
+	// language -(borrow OR small): [Zig]
+}
+
+func ExampleStorage_SetSetting_tokenizer() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Über Zettel\n\nNotizen für später.\n",
+		"20231028013010": "# 東京\n\n東京は日本の首都です。\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	s.Close()
+	dbPath := filepath.Join(zetDir, "data.db")
+
+	for _, t := range []string{"porter", "unicode61", "trigram", "snowball"} {
+		s, err := OpenDB(dbPath)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		if _, err := s.SetSetting(SettingTokenizer, t); err != nil {
+			fmt.Println(err)
+			s.Close()
+			continue
+		}
+		s.Close()
+
+		// The search indexes are kept as they are by every later process.
+		s, err = UpdateDB(zetDir, dbPath)
+		if err != nil {
+			fmt.Println(err)
+			return
+		}
+		var found []string
+		for _, q := range []string{"uber", "Zettels", "日本の", "ette"} {
+			results, err := s.SearchZettels(q, SearchOptions{})
+			if err != nil {
+				fmt.Printf("Error searching zettels: %v\n", err)
+				return
+			}
+			if len(results) > 0 {
+				found = append(found, q)
+			}
+		}
+		s.Close()
+		fmt.Printf("%s: %v\n", t, found)
+	}
+
+	// Output:
+	// porter: [uber Zettels]
+	// unicode61: [uber]
+	// trigram: [日本の ette]
+	// Unknown tokenizer "snowball", expected one of porter, trigram, unicode61
+}
+
+func ExampleStorage_FuzzyZettels() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Zet tool scope and objective\n",
+		"20231028013010": "# Context for conceptual linking\n",
+		"20231028013031": "# Lazy tree walking\n",
+		"20231028013042": "# Linking your thinking\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	for _, q := range []string{"zt", "cnptl", "lnking", "thinking lnk", "thikning", "xyz"} {
+		results, err := s.FuzzyZettels(q, SearchOptions{Before: "[", After: "]", Limit: 2})
+		if err != nil {
+			fmt.Printf("Error finding zettels: %v\n", err)
+			return
+		}
+		fmt.Printf("%s:", q)
+		for _, r := range results {
+			fmt.Printf(" %q", r.TitleSnippet)
+		}
+		fmt.Println()
+	}
+
+	// Output:
+	// zt: "[Z]e[t] tool scope and objective" "La[z]y [t]ree walking"
+	// cnptl: "Context for [c]o[n]ce[pt]ua[l] linking"
+	// lnking: "[L]i[nking] your thinking" "Context for conceptual [l]i[nking]"
+	// thinking lnk: "[L]i[nk]ing your [thinking]" "Context for conceptual [linking]"
+	// thikning: "Linking your [thinking]"
+	// xyz:
+}
+
+func ExampleStorage_DidYouMean() {
+	zetDir, s, err := writeZet(map[string]string{
+		"20231028012959": "# Zettel productivity\n\nLinking notes.\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	s.Close()
+	dbPath := filepath.Join(zetDir, "data.db")
+
+	suggest := func(queries ...string) {
+		s, err := UpdateDB(zetDir, dbPath)
+		if err != nil {
+			fmt.Printf("Failed to sync database: %v\n", err)
+			return
+		}
+		defer s.Close()
+		for _, q := range queries {
+			got, err := s.DidYouMean(q)
+			if err != nil {
+				fmt.Printf("Error suggesting: %v\n", err)
+				return
+			}
+			fmt.Printf("%s => %q\n", q, got)
+		}
+	}
+	suggest("zettle prodcutivity", "linking -tag:draft notse", "zettel", "zet", `"zettle notes"`,
+		"(zettle OR notse) -(lniking)", "tags: notse", `"zettle`)
+
+	// The word index follows changes to zettels.
+	if err := writeZettel(zetDir, "20231028012959", "# Zettel productivity\n\nLinking many ideas.\n"); err != nil {
+		fmt.Printf("Failed to write zettel: %v\n", err)
+		return
+	}
+	suggest("notse", "idaes")
+
+	// Output:
+	// zettle prodcutivity => "zettel productivity"
+	// linking -tag:draft notse => "linking -tag:draft notes"
+	// zettel => ""
+	// zet => ""
+	// "zettle notes" => ""
+	// (zettle OR notse) -(lniking) => "(zettel OR notes) -(linking)"
+	// tags: notse => ""
+	// Error suggesting: missing closing "
+	// notse => ""
+	// idaes => "ideas"
+}
+
+func ExampleStorage_SaveSearch() {
+	zetDir, s, err := writeZet(nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	fmt.Println(s.SaveSearch("drafts", "tag:draft modified:<7d"))
+	fmt.Println(s.SaveSearch("go", "tag:lang/go"))
+	fmt.Println(s.SaveSearch("go", "tag:lang/go -tag:draft"))
+	fmt.Println(s.SaveSearch("my drafts", "tag:draft"))
+	fmt.Println(s.SaveSearch("broken", "colour:red"))
+
+	searches, err := s.SavedSearches()
+	if err != nil {
+		fmt.Printf("Error getting saved searches: %v\n", err)
+		return
+	}
+	for _, ss := range searches {
+		fmt.Printf("%s: %s\n", ss.Name, ss.Query)
+	}
+	_, err = s.SavedSearch("rust")
+	fmt.Println(errors.Is(err, ErrNoSavedSearch), err)
+
+	// Output:
+	// <nil>
+	// <nil>
+	// <nil>
+	// Invalid saved search name "my drafts": use letters, digits, - and _
+	// colour:red: unknown filter
+	// drafts: tag:draft modified:<7d
+	// go: tag:lang/go -tag:draft
+	// true no such saved search: rust
+}
+
+func ExampleStorage_SearchHistory() {
+	defer func(u string) { HistoryUser = u }(HistoryUser)
+	zetDir, s, err := writeZet(nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	HistoryUser = "ada"
+	for _, q := range []string{"zettel", "tag:go", "tag:go", "proxy", "zettel"} {
+		if err := s.AddHistory(q); err != nil {
+			fmt.Printf("Error adding to history: %v\n", err)
+			return
+		}
+	}
+	HistoryUser = "grace"
+	if err := s.AddHistory("compiler"); err != nil {
+		fmt.Printf("Error adding to history: %v\n", err)
+		return
+	}
+
+	for _, u := range []string{"ada", "grace"} {
+		HistoryUser = u
+		all, err := s.SearchHistory(0)
+		if err != nil {
+			fmt.Printf("Error getting history: %v\n", err)
+			return
+		}
+		latest, err := s.SearchHistory(2)
+		if err != nil {
+			fmt.Printf("Error getting history: %v\n", err)
+			return
+		}
+		fmt.Printf("%s: %q %q\n", u, all, latest)
+	}
+
+	// Output:
+	// ada: ["zettel" "proxy" "tag:go"] ["zettel" "proxy"]
+	// grace: ["compiler"] ["compiler"]
+}
+
+func Example_zettelTags_positions() {
+	zetDir, s, err := writeZet(nil)
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	s.Close()
+	dbPath := filepath.Join(zetDir, "data.db")
+
+	for _, content := range []string{
+		"# Go\n\nText.\n\n    #lang/go #tools\n",
+		"# Go\n\nMore text.\n\n    #tools #lang/go\n",
+	} {
+		if err := writeZettel(zetDir, "20231028012959", content); err != nil {
+			fmt.Printf("Failed to write zettel: %v\n", err)
+			return
+		}
+		s, err := UpdateDB(zetDir, dbPath)
+		if err != nil {
+			fmt.Printf("Failed to sync database: %v\n", err)
+			return
+		}
+		z := Zettel{ID: 1}
+		if err := zettelTags(s.DB, &z); err != nil {
+			fmt.Printf("Error getting tags: %v\n", err)
+			return
+		}
+		sort.Slice(z.Tags, func(i, j int) bool { return z.Tags[i].Name < z.Tags[j].Name })
+		for _, t := range z.Tags {
+			fmt.Printf("%s %d:%d\n", t.Name, t.Line, t.Col)
+		}
+		s.Close()
+	}
+
+	// Output:
+	// lang/go 5:5
+	// tools 5:14
+	// lang/go 5:12
+	// tools 5:5
+}
+
+func ExampleStorage_Merge() {
+	root := "# Root\n\n* [20240101000002](../20240101000002) Sub\n"
+	zetDir, s, err := writeZet(map[string]string{
+		"20240101000000": root,
+		"20240101000001": "# Idea\n\nAn idea.\n",
+		"20240101000002": "# Sub\n\n" +
+			"As shown in [this idea](../20240101000001) it works.\n" +
+			"See [[20240101000001|the idea]] too.\n\n" +
+			"* [20240101000003](../20240101000003) Later\n" +
+			"* [20240101000001](../20240101000001) Idea\n\n" +
+			"    #sub\n",
+		"20240101000003": "# Later\n",
+	})
+	if err != nil {
+		fmt.Println(err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	defer s.Close()
+
+	merged, err := s.Merge(root)
+	if err != nil {
+		fmt.Printf("Error merging zettels: %v\n", err)
+		return
+	}
+	for _, l := range strings.Split(strings.TrimSuffix(merged, "\n"), "\n") {
+		fmt.Printf("%q\n", l)
+	}
+
+	// Output:
+	// "# Root"
+	// ""
+	// "## Sub"
+	// ""
+	// "As shown in [this idea](../20240101000001) it works."
+	// "See [[20240101000001|the idea]] too."
+	// ""
+	// ""
+	// "* [20240101000003](../20240101000003) Later"
+	// "* [20240101000001](../20240101000001) Idea"
+	// "    #sub "
+	// ""
+}
@@ -0,0 +1,105 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode/utf8"
+)
+
+// plainWordRegex matches a search term that is a plain word, as opposed
+// to a phrase, prefix, column or filter term.
+var plainWordRegex = regexp.MustCompile(`^[\p{L}\p{N}]+$`)
+
+// ftsOperators holds the operators of the search index query syntax.
+var ftsOperators = map[string]bool{`AND`: true, `OR`: true, `NOT`: true, `NEAR`: true}
+
+// DidYouMean returns the query with every plain word that matches no
+// zettel replaced by the closest word in the titles and bodies of the
+// zettelkasten, e.g. `zettel productivity` for `zettle productivity`. It
+// returns an empty string if there is nothing to suggest. Other terms,
+// such as phrases and filters, are kept as they are. The query is split
+// the same way a search splits it, so a query a search can't split is
+// an error.
+func (s *Storage) DidYouMean(q string) (string, error) {
+	toks, err := lexQuery(q)
+	if err != nil {
+		return "", err
+	}
+	changed := false
+	for i, tok := range toks {
+		if !plainWordRegex.MatchString(tok) || ftsOperators[tok] {
+			continue
+		}
+		// A value written after a space belongs to the key before it,
+		// e.g. `tags: lang`.
+		if i > 0 {
+			if m := filterTermRegex.FindStringSubmatch(toks[i-1]); m != nil && m[3] == "" {
+				continue
+			}
+		}
+		var n int
+		const query = `SELECT COUNT(*) FROM zettel_fts WHERE zettel_fts MATCH $1;`
+		if err := s.DB.Get(&n, query, `"`+tok+`"`); err != nil {
+			return "", fmt.Errorf("Error matching search term: %v", err)
+		}
+		if n > 0 {
+			continue
+		}
+		word, ok, err := s.closestWord(strings.ToLower(tok))
+		if err != nil {
+			return "", err
+		}
+		if ok && word != strings.ToLower(tok) {
+			toks[i] = word
+			changed = true
+		}
+	}
+	if !changed {
+		return "", nil
+	}
+	return joinTokens(toks), nil
+}
+
+// joinTokens joins the tokens of a query as split by lexQuery, keeping
+// the parentheses of groups next to the terms they hold.
+func joinTokens(toks []string) string {
+	var b strings.Builder
+	for i, tok := range toks {
+		if i > 0 && tok != `)` && !strings.HasSuffix(toks[i-1], `(`) {
+			b.WriteString(" ")
+		}
+		b.WriteString(tok)
+	}
+	return b.String()
+}
+
+// closestWord returns the word in the word index closest to w, if any
+// is within maxTypos edits of it. Of words equally close, the one found
+// in the most zettels is picked.
+func (s *Storage) closestWord(w string) (string, bool, error) {
+	n := utf8.RuneCountInString(w)
+	max := maxTypos(n)
+	if max == 0 {
+		return "", false, nil
+	}
+	words := []struct {
+		Term string `db:"term"`
+		Doc  int    `db:"doc"`
+	}{}
+	const query = `
+		SELECT term, doc FROM word_vocab
+		WHERE length(term) BETWEEN $1 AND $2;`
+	if err := s.DB.Select(&words, query, n-max, n+max); err != nil {
+		return "", false, fmt.Errorf("Error getting words: %v", err)
+	}
+
+	best, bestDist, bestDoc := "", max+1, 0
+	for _, word := range words {
+		d := editDistance([]rune(w), []rune(word.Term))
+		if d < bestDist || (d == bestDist && word.Doc > bestDoc) {
+			best, bestDist, bestDoc = word.Term, d, word.Doc
+		}
+	}
+	return best, best != "", nil
+}
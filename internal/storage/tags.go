@@ -0,0 +1,199 @@
+package storage
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// TagCount is a tag along with the number of zettels tagged with it.
+type TagCount struct {
+	Tag
+	Count int `db:"count"` // number of zettels with the tag
+}
+
+// TagCounts returns every tag with its usage count. Tags are sorted by
+// count, highest first, or by name if sort is "name".
+func (s *Storage) TagCounts(sort string) ([]TagCount, error) {
+	order := `count DESC, t.name ASC`
+	if sort == `name` {
+		order = `t.name ASC`
+	}
+	tags := []TagCount{}
+	query := `
+		SELECT t.id, t.name, COUNT(zt.zettel_id) AS count
+		FROM tag t
+		LEFT JOIN zettel_tags zt ON zt.tag_id = t.id
+		GROUP BY t.id
+		ORDER BY ` + order + `;`
+	if err := s.DB.Select(&tags, query); err != nil {
+		return nil, fmt.Errorf("Error getting tags: %v", err)
+	}
+	return tags, nil
+}
+
+// TaggedZettels returns the zettels tagged with any of the given tags,
+// without their body.
+func (s *Storage) TaggedZettels(tags []string) ([]Zettel, error) {
+	zettels := []Zettel{}
+	if len(tags) == 0 {
+		return zettels, nil
+	}
+	query, args, err := sqlx.In(`
+		SELECT DISTINCT z.id, z.name, z.title, z.dir_name
+		FROM zettel z
+		JOIN zettel_tags zt ON zt.zettel_id = z.id
+		JOIN tag t ON t.id = zt.tag_id
+		WHERE t.name IN (?)
+		ORDER BY z.dir_name, z.name;`, tags)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.DB.Select(&zettels, s.DB.Rebind(query), args...); err != nil {
+		return nil, fmt.Errorf("Error getting tagged zettels: %v", err)
+	}
+	return zettels, nil
+}
+
+// NormalizeTag returns a tag name without leading, trailing or repeated
+// slashes, so `lang//go/` and `lang/go` are the same tag.
+func NormalizeTag(name string) string {
+	var parts []string
+	for _, p := range strings.Split(name, "/") {
+		if p != "" {
+			parts = append(parts, p)
+		}
+	}
+	return strings.Join(parts, "/")
+}
+
+// TagParent returns the name of the parent of a hierarchical tag, e.g.
+// `lang` for `lang/go`. Top level tags have no parent.
+func TagParent(name string) string {
+	i := strings.LastIndex(name, "/")
+	if i < 0 {
+		return ""
+	}
+	return name[:i]
+}
+
+// tagFilter restricts search results to zettels with a given tag.
+type tagFilter struct {
+	name        string
+	descendants bool // also match tags below name
+	prefix      bool // match any tag starting with name
+}
+
+// tagValueRegex matches the value of a tag search term, e.g.
+// `lang/go`, `lang/*` or `pro*`.
+var tagValueRegex = regexp.MustCompile(`^([a-zA-Z][^\s#"()*]*?)(/\*|\*)?$`)
+
+// parseTagTerm returns the filter for the value of a tag search term.
+// A value ending in `/*` also matches every tag below it in the
+// hierarchy and one ending in `*` matches tags by prefix. It reports
+// false if v isn't a tag.
+func parseTagTerm(v string) (tagFilter, bool) {
+	m := tagValueRegex.FindStringSubmatch(v)
+	if m == nil {
+		return tagFilter{}, false
+	}
+	return tagFilter{
+		name:        NormalizeTag(m[1]),
+		descendants: m[2] == "/*",
+		prefix:      m[2] == "*",
+	}, true
+}
+
+func (f tagFilter) args() []any {
+	return []any{f.name}
+}
+
+// cond returns the condition for the filter on zettel z. The tag name
+// is bound to parameter n.
+func (f tagFilter) cond(n int) string {
+	cond := fmt.Sprintf(`t.name = $%d`, n)
+	switch {
+	case f.descendants:
+		cond = fmt.Sprintf(`t.name = $%[1]d OR t.parent = $%[1]d
+			OR substr(t.parent, 1, length($%[1]d) + 1) = $%[1]d || '/'`, n)
+	case f.prefix:
+		cond = fmt.Sprintf(`substr(t.name, 1, length($%[1]d)) = $%[1]d`, n)
+	}
+	return `z.id IN (
+						SELECT zt.zettel_id FROM zettel_tags zt
+						JOIN tag t ON t.id = zt.tag_id
+						WHERE ` + cond + `)`
+}
+
+// TagNode is a tag in the tag hierarchy.
+type TagNode struct {
+	Name     string     // full tag name, e.g. `lang/go`
+	Count    int        // number of zettels with exactly this tag
+	Total    int        // number of zettels with this tag or one below it
+	Children []*TagNode // tags directly below this one, sorted by name
+}
+
+// Label returns the last part of the tag name, e.g. `go` for `lang/go`.
+func (n *TagNode) Label() string {
+	return n.Name[strings.LastIndex(n.Name, "/")+1:]
+}
+
+// TagTree returns the top level tags of the tag hierarchy. Parent tags
+// that no zettel uses directly are included so every tag has a place
+// in the tree.
+func (s *Storage) TagTree() ([]*TagNode, error) {
+	counts, err := s.TagCounts(`name`)
+	if err != nil {
+		return nil, err
+	}
+	zettelTags, err := s.ZettelTags()
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]*TagNode)
+	var node func(name string) *TagNode
+	node = func(name string) *TagNode {
+		if n, ok := nodes[name]; ok {
+			return n
+		}
+		n := &TagNode{Name: name}
+		nodes[name] = n
+		if p := TagParent(name); p != "" {
+			parent := node(p)
+			parent.Children = append(parent.Children, n)
+		}
+		return n
+	}
+	for _, t := range counts {
+		node(t.Name).Count = t.Count
+	}
+
+	// A zettel counts once towards each tag at or above its tags.
+	for _, tags := range zettelTags {
+		seen := make(map[string]bool)
+		for _, t := range tags {
+			for name := t; name != "" && !seen[name]; name = TagParent(name) {
+				seen[name] = true
+				node(name).Total++
+			}
+		}
+	}
+
+	var roots []*TagNode
+	for _, n := range nodes {
+		sort.Slice(n.Children, func(i, j int) bool {
+			return n.Children[i].Name < n.Children[j].Name
+		})
+		if TagParent(n.Name) == "" {
+			roots = append(roots, n)
+		}
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		return roots[i].Name < roots[j].Name
+	})
+	return roots, nil
+}
@@ -0,0 +1,74 @@
+package storage
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/jmoiron/sqlx"
+)
+
+// tokenizers maps tokenizer names to the tokenize option of the search
+// indexes.
+//
+//	porter     Words reduced to their English stem, e.g. zettels
+//	           matches zettel, with diacritics removed.
+//	unicode61  Words as written, for languages other than English,
+//	           with all diacritics removed, e.g. uber matches Über.
+//	trigram    Any run of three or more characters, for substring
+//	           matching and scripts without spaces between words, such
+//	           as Japanese. Terms shorter than three characters match
+//	           nothing.
+var tokenizers = map[string]string{
+	`porter`:    `porter`,
+	`unicode61`: `unicode61 remove_diacritics 2`,
+	`trigram`:   `trigram`,
+}
+
+// Tokenizers returns the names of the tokenizers the tokenizer setting
+// may be set to, sorted.
+func Tokenizers() []string {
+	var names []string
+	for name := range tokenizers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// tokenizeOption returns the tokenize option of the tokenizer with the
+// given name.
+func tokenizeOption(name string) (string, error) {
+	opt, ok := tokenizers[name]
+	if !ok {
+		return "", fmt.Errorf("Unknown tokenizer %q, expected one of %s", name, strings.Join(Tokenizers(), ", "))
+	}
+	return opt, nil
+}
+
+// rebuildSearchIndexes drops the search indexes of zettels and
+// sections, creates them again with the named tokenizer and fills them
+// from the zettel and section tables. The triggers that keep them in
+// sync refer to them by name, so they are left as they are.
+func rebuildSearchIndexes(tx *sqlx.Tx, name string) error {
+	opt, err := tokenizeOption(name)
+	if err != nil {
+		return err
+	}
+	stmts := []string{
+		`DROP TABLE IF EXISTS zettel_fts;`,
+		`DROP TABLE IF EXISTS section_fts;`,
+		`CREATE VIRTUAL TABLE zettel_fts USING fts5(title, body, tags, tokenize='` + opt + `');`,
+		`CREATE VIRTUAL TABLE section_fts USING fts5(title, body, tokenize='` + opt + `');`,
+		`INSERT INTO zettel_fts(rowid, title, body, tags)
+			SELECT z.id, z.title, z.body, ` + ftsTagsSQL + ` FROM zettel z;`,
+		`INSERT INTO section_fts(rowid, title, body)
+			SELECT id, heading, body FROM section;`,
+	}
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(stmt); err != nil {
+			return fmt.Errorf("Error rebuilding search indexes: %v", err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,143 @@
+package storage
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// HeartbeatInterval is how often a running watcher refreshes its
+// heartbeat file. A heartbeat older than three intervals is considered
+// stale.
+const HeartbeatInterval = 5 * time.Second
+
+// SyncZettel syncs a single zettel directory with the database. Unlike
+// UpdateDB, it doesn't rescan the whole zet directory, which makes it
+// suitable for applying incremental changes. If the directory no
+// longer exists, its zettels are removed from the database.
+func (s *Storage) SyncZettel(zetPath, dirName string) error {
+	// A long running watcher picks up settings changed since it started.
+	if err := loadSettings(s.DB); err != nil {
+		return err
+	}
+	zm, err := s.dirZettelsMap(dirName)
+	if err != nil {
+		return fmt.Errorf("Failed to get zettels: %v", err)
+	}
+
+	tx, err := s.DB.Beginx()
+	if err != nil {
+		return fmt.Errorf("Failed to create transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	dirPath := filepath.Join(zetPath, dirName)
+	info, err := os.Stat(dirPath)
+	switch {
+	case os.IsNotExist(err) || (err == nil && !info.IsDir()):
+		// Make sure the directory record goes even if none of its files
+		// made it into the database.
+		if _, exists := zm[dirName]; !exists {
+			zm[dirName] = make(map[string]Zettel)
+		}
+		if err := deleteZettels(tx, zm); err != nil {
+			return fmt.Errorf("Failed to delete zettel: %v", err)
+		}
+	case err != nil:
+		return fmt.Errorf("Failed to stat zettel directory: %v", err)
+	default:
+		if _, exists := zm[dirName]; !exists {
+			files, err := os.ReadDir(dirPath)
+			if err != nil {
+				return fmt.Errorf("Error reading sub-directory: %v", err)
+			}
+			if err := addZettel(tx, dirPath, files); err != nil {
+				return fmt.Errorf("Failed to insert zettel: %v", err)
+			}
+			break
+		}
+		if err := processFiles(tx, dirPath, zm); err != nil {
+			return err
+		}
+	}
+
+	if err := resolveLinks(tx); err != nil {
+		return fmt.Errorf("Failed to resolve links: %v", err)
+	}
+	return tx.Commit()
+}
+
+// dirZettelsMap is like zettelsMap but only holds the zettels for a
+// single directory.
+func (s *Storage) dirZettelsMap(dirName string) (map[string]map[string]Zettel, error) {
+	var zm = make(map[string]map[string]Zettel)
+	zettels := []Zettel{}
+	const query = `SELECT * FROM zettel WHERE dir_name = $1`
+	if err := s.DB.Select(&zettels, query, dirName); err != nil {
+		return zm, err
+	}
+	for _, z := range zettels {
+		if _, exists := zm[z.DirName]; !exists {
+			zm[z.DirName] = make(map[string]Zettel)
+		}
+		zm[z.DirName][z.Name] = z
+	}
+	return zm, nil
+}
+
+// heartbeatPath returns the path to the heartbeat file of a watcher
+// keeping the database at dbPath up to date.
+func heartbeatPath(dbPath string) string {
+	return dbPath + ".watch"
+}
+
+// Heartbeat marks the database at dbPath as being kept live by a
+// watcher. It should be called at least every HeartbeatInterval.
+func Heartbeat(dbPath string) error {
+	pid := []byte(strconv.Itoa(os.Getpid()) + "\n")
+	return os.WriteFile(heartbeatPath(dbPath), pid, 0644)
+}
+
+// ClearHeartbeat removes the heartbeat file for the database at dbPath.
+func ClearHeartbeat(dbPath string) error {
+	err := os.Remove(heartbeatPath(dbPath))
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// WatcherAlive reports whether a watcher has recently refreshed its
+// heartbeat for the database at dbPath and the process it names is
+// still running. A heartbeat left behind by a watcher that crashed
+// names a process that is gone.
+func WatcherAlive(dbPath string) bool {
+	p := heartbeatPath(dbPath)
+	info, err := os.Stat(p)
+	if err != nil || time.Since(info.ModTime()) >= 3*HeartbeatInterval {
+		return false
+	}
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return false
+	}
+	pid, err := strconv.Atoi(strings.TrimSpace(string(b)))
+	if err != nil || pid <= 0 {
+		return false
+	}
+	return processAlive(pid)
+}
+
+// processAlive reports whether the process with the given pid is
+// running. Signal 0 checks the process exists without affecting it.
+func processAlive(pid int) bool {
+	proc, err := os.FindProcess(pid)
+	if err != nil {
+		return false
+	}
+	return proc.Signal(syscall.Signal(0)) == nil
+}
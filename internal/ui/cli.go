@@ -2,6 +2,7 @@ package ui
 
 import (
 	"bufio"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"os"
@@ -13,6 +14,7 @@ import (
 	"github.com/blevesearch/bleve/v2"
 	"github.com/ericstrs/zet"
 	"github.com/ericstrs/zet/internal/config"
+	"github.com/ericstrs/zet/internal/graph"
 	"github.com/ericstrs/zet/internal/meta"
 	"github.com/ericstrs/zet/internal/storage"
 )
@@ -20,6 +22,7 @@ import (
 const (
 	yellow = "\033[33m" // ANSI escape code for yellow
 	red    = "\033[31m" // ANSI escape code for red
+	green  = "\033[32m" // ANSI escape code for green
 	reset  = "\033[0m"  // ANSI escape code to reset to default color
 
 	searchUsage = `NAME
@@ -28,9 +31,135 @@ const (
 
 USAGE
 
-  zet search query|q <term>  - Print zettels given a search term.
-  zet search browse|b <term> - Interactively search for a zettel.
-  zet search help            - Print zettels given a search term.
+  zet search query|q [flags] <term> - Print zettels given a search term.
+  zet search browse|b <term>        - Interactively search for a zettel.
+  zet search save <name> <term>     - Save a search term under a name.
+  zet search run [flags] <name>     - Print zettels given the search term
+                                      saved under name.
+  zet search saved                  - Print saved searches.
+  zet search help                   - Print zettels given a search term.
+
+FLAGS
+
+  -f, --fuzzy            Match titles fuzzily instead, see FUZZY.
+  -l, --limit <n>        Print at most n zettels.
+  -o, --offset <n>       Skip the first n zettels.
+  -s, --snippet <mode>   Print the body lines with a match (lines, the
+                         default), the best matching part of the body
+                         (fragment) or no body at all (none).
+  -w, --weights <t,b,g>  Rank matches in titles, bodies and tags by the
+                         given weights, e.g. 10,1,1 to favour titles.
+                         Defaults to 1.5,1,1.5.
+
+  An invalid query, such as one with an unknown filter or an unclosed
+  quote, is reported as an error and exits with a non-zero status.
+
+SAVED SEARCHES AND HISTORY
+
+  Saved searches are kept in the database, so everyone using it can run
+  them. A name is made of letters, digits, - and _, and saving a search
+  under a name that is taken replaces it. Searches made with query and
+  run, and the ones made in the browse interface, are kept in a search
+  history of the current user. Press up and down in the browse
+  interface to go through it and ctrl+s to list the saved searches.
+
+FUZZY
+
+  Fuzzy matching looks at titles only and ranks them the way fzf does.
+  Every word has to match a title either as letters in the same order,
+  e.g. cnptl for "conceptual", or as a title word with a typo or two,
+  e.g. lnking for "linking". Matches at the start of words and letters
+  in a row rank higher. Press tab in the browse interface to switch to
+  fuzzy matching.
+
+  When a search finds nothing, misspelt words are looked up among the
+  words of all zettels and a query to try instead is suggested, e.g.
+  "No matches found. Did you mean: zettel". The suggestion is printed
+  to stderr.
+
+TERMS
+
+  Terms are separated by spaces outside of quotes and parentheses and
+  are searched for in the title, body and tags of zettels. Limit a term
+  to one of them with title: (t:), body: (b:) or tags: (#:), e.g.
+  "t:(reverse proxy)". Prefix a term with - to exclude zettels matching
+  it, e.g. "proxy -forward".
+
+  Terms, filters included, are joined with AND, which may be left out,
+  or OR, and grouped with parentheses. NOT or - excludes the zettels a
+  term or group matches, e.g.
+
+    (go OR rust) -(tag:draft OR orphan:true)
+
+  Zettels matched by a group mixing terms with filters are neither
+  ranked nor highlighted by those terms.
+
+TAGS
+
+  tag:<tag>     Zettels tagged with tag, e.g. tag:lang/go.
+  tag:<tag>/*   Zettels tagged with tag or any tag below it.
+  tag:<tag>*    Zettels with a tag starting with tag.
+
+  tags:<tag> and #:<tag> work the same way.
+
+FRONT MATTER
+
+  status:<value>         Zettels whose front matter status is value.
+  source:<value>         Zettels whose front matter source is value.
+  alias:<value>          Zettels with value among their aliases.
+  meta:<key>=<value>     Zettels whose front matter key is value.
+
+  Values are matched without regard to case and can't contain spaces.
+  Ending a value with * matches any value starting with it, e.g.
+  source:book*.
+
+FILTERS
+
+  created:<date>         Zettels created in date, see DATES.
+  modified:<date>        Zettels last modified in date, see DATES.
+  links-to:<isosec>      Zettels linking to the zettel isosec.
+  linked-from:<isosec>   Zettels linked from the zettel isosec.
+  has:<what>             Zettels with links, backlinks, broken (links),
+                         tags or meta (front matter).
+  orphan:true|false      Zettels without links to or from others.
+  words:<n>              Zettels whose body has n words, e.g. words:>300.
+
+  Prefix a filter with - to exclude the zettels it matches, e.g.
+  -tag:draft. Filters can be used on their own or along with terms.
+
+DATES
+
+  A date is YYYY, YYYY-MM or YYYY-MM-DD, or a duration back from now
+  made of a number and h (hours), d (days), w (weeks), m (months) or y
+  (years). Compare with >, >=, < or <=, e.g. created:>2024-01 for
+  zettels created after January 2024 and modified:<7d for zettels
+  modified less than seven days ago. The created date is the one in the
+  front matter, if any, and the zettel's isosec otherwise.
+
+TOKENIZERS
+
+  The tokenizer setting picks how text is split into searchable terms,
+  e.g. "zet db set tokenizer unicode61":
+
+  porter     English words reduced to their stem, so zettels matches
+             zettel. The default.
+  unicode61  Words as written in any language, with diacritics removed,
+             so uber matches Über.
+  trigram    Any three or more characters in a row, so ette matches
+             zettel. Suits Japanese, Chinese and other scripts written
+             without spaces. Terms shorter than three characters match
+             nothing.
+
+  Changing it rebuilds the search indexes right away. The setting is
+  kept in the database, so every zet command using it agrees.
+
+SECTIONS
+
+  Every heading of a zettel starts a section that runs up to the next
+  heading. A result matched under a heading other than the title shows
+  the section that best matches the term along with its anchor, e.g.
+  "§ Chapter 2 (20231028013010#chapter-2)".
+  Link to a section with [iso](../iso#anchor) title.
 `
 	splitUsage = `NAME
 
@@ -51,10 +180,33 @@ USAGE
                       or in given directory.
   zet content body  - Prints body from README.md in current directory or
                       in given directory.
-  zet content links - Prints links from README.md in current directory
-                      or in given directory.
+  zet content links [-j] - Prints links from README.md in current
+                           directory or in given directory.
   zet content tags  - Prints tags from README.md in current directory or
                       in given directory.
+  zet content meta  - Prints front matter from README.md in current
+                      directory or in given directory, one key: value
+                      pair per line.
+
+FLAGS
+
+  -j, --json  Print each link of "content links" as JSON, along with
+              its line, kind, type and context.
+
+LINK TYPES
+
+  A link is a footnote when it is on a footnote definition, such as
+  "[^r]: [iso](../iso) title", a see-also entry when it is on a line of
+  its own, such as "* [iso](../iso) title", and inline otherwise. The
+  context of a link is the sentence it is in, the sentence that refers
+  to its footnote or the see-also entry itself.
+
+FRONT MATTER
+
+  A zettel may start with a block of YAML front matter between two ---
+  lines. It is not part of the title or body. The keys aliases, tags,
+  status, source and created are understood, tags are added to the
+  zettel's tags and every key can be searched, see "zet search help".
 `
 	mergeUsage = `NAME
 
@@ -218,6 +370,314 @@ USAGE:
 
 		This command expects the zettel content to be passed in either through
 		standard input or in an argument.
+`
+	watchUsage = `NAME
+
+  watch - keeps the database in sync with the zet directory.
+
+USAGE
+
+  zet watch      - Watches the zet directory and applies changes to the
+                   database as they happen.
+  zet watch help - Provides command information.
+
+DESCRIPTION
+
+  Every command that reads from the database first rescans the whole
+  zet directory. While a watcher is running, that rescan is skipped
+  since the watcher already keeps the database up to date.
+
+  Settings changed with "zet db set" are kept in the database and
+  picked up by the watcher.
+
+  The watcher runs until interrupted.
+`
+	checkUsage = `NAME
+
+  check - reports problems with zettels.
+
+USAGE
+
+  zet check links - Prints every link that points to a zettel, or a
+                    section of a zettel, that doesn't exist.
+  zet check help  - Provides command information.
+
+DESCRIPTION
+
+  Each broken link is printed as the file and line it lives on followed
+  by the missing isosec, or isosec#anchor for a link to a missing
+  section, and the link itself. The command exits with a
+  non-zero status if any broken links are found, which makes it usable
+  from a git pre-commit hook.
+`
+	backlinksUsage = `NAME
+
+  backlinks - prints links to a zettel from other zettels.
+
+USAGE
+
+  zet backlinks [-c] [isosec] - Prints the links pointing to the zettel in
+                                the current directory or the given
+                                isosec directory.
+  zet backlinks help          - Provides command information.
+
+FLAGS
+
+  -c, --context  Print the line, type and context of each reference
+                 below its link. See "zet content help" for link types.
+`
+	graphUsage = `NAME
+
+  graph - works with the graph of links between zettels.
+
+USAGE
+
+  zet graph export [flags] [period]  - Prints the link graph.
+  zet graph orphans [flags] [period] - Prints zettels without any links.
+  zet graph hubs [flags] [period]    - Prints zettels ranked by how well
+                                       connected they are.
+  zet graph path [-u] <from> <to>    - Prints the shortest chain of links
+                                       between two zettels.
+  zet graph help                     - Provides command information.
+
+FLAGS
+
+  -f, --format <format>   Output format: dot, graphml or json. Defaults
+                          to dot.
+  -t, --tag <tag>         Only include zettels with the given tag.
+  -a, --around <isosec>   Only include zettels near the given zettel.
+  -n, --hops <N>          Number of links to follow from the zettel given
+                          to --around. Defaults to 1.
+  -b, --by <ranking>      How hubs are ranked: degree or pagerank.
+                          Defaults to degree.
+  -l, --limit <N>         Maximum number of hubs to print. Defaults to 10.
+                          Zero prints all of them.
+  -u, --undirected        Allow path to follow links backwards.
+
+PERIOD
+
+  Only include zettels created in a period. Takes the same form as the
+  temporal subcommands of the list command:
+
+  day [YYYY-MM-DD] [-N] [-N:]
+  week [YYYY-MM-DD] [-N] [-N:]
+  month [YYYY-MM] [-N] [-N:]
+  year [YYYY] [-N] [-N:]
+
+EXAMPLES
+
+  zet graph export | dot -Tsvg > zet.svg
+  zet graph export -f graphml -t go > go.graphml
+  zet graph export -f json month -3: > recent.json
+  zet graph export -a 20231028013010 -n 2
+  zet graph hubs -b pagerank -t go
+  zet graph path 20231028012959 20240108034433
+
+DESCRIPTION
+
+  Each exported edge carries the type of its link, inline, footnote or
+  see-also, and the sentence or entry it is in. DOT draws footnotes
+  dotted and see-also entries dashed.
+
+  Orphans are zettels that neither link to, nor are linked from, any
+  other zettel. They are good candidates for linking work.
+
+  Hubs are the zettels the rest of the zettelkasten is organized around.
+  Ranking by degree counts the distinct zettels a zettel is linked with.
+  Ranking by pagerank favours zettels that are linked from other well
+  linked zettels.
+`
+	rmUsage = `NAME
+
+  rm - moves a zettel to the trash.
+
+USAGE
+
+  zet rm [flags] [isosec] - Moves the zettel in the current directory or
+                            the given isosec directory to the trash and
+                            prints the zettels that still link to it.
+  zet rm help             - Provides command information.
+
+FLAGS
+
+  -s, --strike            Strike out links to the removed zettel.
+  -r, --rewrite <isosec>  Point links to the removed zettel at the given
+                          zettel instead.
+
+DESCRIPTION
+
+  Removed zettels are moved to the .trash directory within the zet
+  directory and can be brought back with "zet trash restore". Links to
+  a removed zettel are kept as broken links unless they are struck out
+  or rewritten, and resolve again once the zettel is restored.
+`
+	mvUsage = `NAME
+
+  mv - renames a zettel and rewrites the links to it.
+
+USAGE
+
+  zet mv [-n] <old> <new> - Renames the zettel directory old to new and
+                            rewrites every link to it.
+  zet mv help             - Provides command information.
+
+FLAGS
+
+  -n, --dry-run  Print the planned edits without making them.
+
+DESCRIPTION
+
+  The new name is usually an isosec, but any name that is not already
+  taken and can be used in a link works. Links are found through the
+  database, so only links that zet knows about are rewritten. The title
+  of each link is kept as is.
+`
+	linksUsage = `NAME
+
+  links - maintains the links between zettels.
+
+USAGE
+
+  zet links refresh [-y] - Rewrites links whose title no longer matches
+                           the title of the zettel they point to.
+  zet links help         - Provides command information.
+
+FLAGS
+
+  -y, --yes  Rewrite the links without asking for confirmation.
+
+DESCRIPTION
+
+  Every zettel link carries a copy of its target's title. The refresh
+  sub-command prints the changes it would make to bring those copies up
+  to date as a diff and asks before rewriting any files.
+`
+	retitleUsage = `NAME
+
+  retitle - changes the title of a zettel and the links to it.
+
+USAGE
+
+  zet retitle [-y] <isosec> <title> - Changes the title of a zettel and
+                                      refreshes the links to it.
+  zet retitle help                  - Provides command information.
+
+FLAGS
+
+  -y, --yes  Rewrite the links without asking for confirmation.
+`
+	tagsUsage = `NAME
+
+  tags - manages the tag vocabulary.
+
+USAGE
+
+  zet tags [list] [-s count|name] [-t]  - Prints every tag with the number
+                                          of zettels using it.
+  zet tags rename [-y] <old> <new>      - Renames a tag.
+  zet tags merge [-y] <tag>... --into <tag>
+                                        - Replaces tags with another tag.
+  zet tags rm [-y] <tag>...             - Removes tags.
+  zet tags help                         - Provides command information.
+
+FLAGS
+
+  -s, --sort  Sort tags by count (default) or name.
+  -t, --tree  Print the tag hierarchy. Counts include every zettel
+              tagged with a tag or any tag below it.
+  -y, --yes   Rewrite the zettels without asking for confirmation.
+
+DESCRIPTION
+
+  Tags may be hierarchical, with levels separated by a slash, e.g.
+  #lang/go. Tags are written without the leading #.
+
+  Running "zet db set inline-tags on" makes hashtags written inline in
+  the body count as tags too. Only tags on tag lines are rewritten.
+
+  The rename, merge and rm sub-commands rewrite the tag lines of every
+  affected zettel. They print the changes they would make and ask
+  before rewriting any files, then sync the changed zettels with the
+  database.
+`
+	trashUsage = `NAME
+
+  trash - manages removed zettels.
+
+USAGE
+
+  zet trash [list]           - Prints the zettels in the trash.
+  zet trash restore <isosec> - Moves a zettel out of the trash and syncs
+                               it with the database.
+  zet trash help             - Provides command information.
+`
+	doctorUsage = `NAME
+
+  doctor - checks the database for problems and repairs them.
+
+USAGE
+
+  zet doctor [--fix] - Cross-checks the database against the zet
+                       directory and prints every problem found.
+  zet doctor help    - Provides command information.
+
+FLAGS
+
+  -f, --fix  Repair the problems found.
+
+DESCRIPTION
+
+  The following problems are reported:
+
+    fts    The search or section index is corrupt or out of sync with
+           the zettels.
+    links  Links live in or point to zettels that no longer exist.
+    dirs   Directories have no zettels.
+    files  Zettels belong to a directory that no longer exists.
+
+  Repairing deletes zettels whose directory is gone, turns links to
+  missing zettels into broken links, deletes everything else left
+  dangling and rebuilds the search and section indexes.
+
+  The database is inspected as is, without syncing it with the zet
+  directory first. The command exits with a non-zero status if any
+  problems remain.
+`
+	dbUsage = `NAME
+
+  db - manages the zet database.
+
+USAGE
+
+  zet db migrate [--dry-run] - Brings the database schema up to date.
+  zet db set <name> <value>  - Changes a setting of the database.
+  zet db settings            - Prints the settings of the database.
+  zet db help                - Provides command information.
+
+FLAGS
+
+  -n, --dry-run  Print the pending migrations without applying them.
+
+DESCRIPTION
+
+  The database schema is versioned. Migrations are applied in order,
+  each in its own transaction, whenever the database is opened, so
+  running this command is never required. It is useful for checking
+  what a new version of zet will change before running any other
+  command.
+
+SETTINGS
+
+  Settings change what is written to the database, so they are kept in
+  it and shared by every zet command and watcher using it. Changing one
+  rescans the zet directory right away, even while a watcher is running.
+
+  inline-tags  on or off. Whether hashtags written inline in the body,
+               e.g. an #idea worth keeping, count as tags. Headings,
+               code and URLs are skipped. Off by default.
+  tokenizer    porter, unicode61 or trigram. How text is split into
+               searchable terms, see "zet search help". Changing it
+               rebuilds the search indexes. porter by default.
 `
 	annotateUsage = `NAME
 
@@ -256,6 +716,11 @@ func SearchCmd(args []string) error {
 		query := strings.Join(args[3:], " ")
 		switch strings.ToLower(args[2]) {
 		case `query`, `q`:
+			f, err := parseSearchFlags(args[3:])
+			if err != nil {
+				return err
+			}
+			query = strings.Join(f.terms, " ")
 			if query == "" {
 				return nil
 			}
@@ -265,19 +730,58 @@ func SearchCmd(args []string) error {
 			}
 			defer s.Close()
 
-			zettels, err := s.SearchZettels(query, red, reset)
+			return printSearch(s, query, f)
+		case `run`:
+			f, err := parseSearchFlags(args[3:])
 			if err != nil {
-				zettels = []storage.ResultZettel{storage.ResultZettel{TitleSnippet: "Incorrect syntax"}}
+				return err
 			}
-			for _, z := range zettels {
-				fmt.Println(yellow + z.DirName + reset + " " + z.TitleSnippet)
-				if z.BodySnippet != "" {
-					fmt.Println(removeEmptyLines(z.BodySnippet))
-				}
-				if z.TagsSnippet != "" {
-					hashedTags := "    #" + strings.ReplaceAll(z.TagsSnippet, " ", " #")
-					fmt.Println(hashedTags)
-				}
+			if len(f.terms) != 1 {
+				return errors.New("Usage: zet search run <name> [flags]")
+			}
+			s, err := storage.UpdateDB(c.ZetDir, c.DBPath)
+			if err != nil {
+				return fmt.Errorf("Error syncing database and flat files: %v", err)
+			}
+			defer s.Close()
+
+			ss, err := s.SavedSearch(f.terms[0])
+			if err != nil {
+				return fmt.Errorf("Error running saved search: %v", err)
+			}
+			return printSearch(s, ss.Query, f)
+		case `save`:
+			if n < 5 {
+				return errors.New("Usage: zet search save <name> <query>")
+			}
+			s, err := storage.OpenDB(c.DBPath)
+			if err != nil {
+				return fmt.Errorf("Error opening database: %v", err)
+			}
+			defer s.Close()
+
+			err = s.SaveSearch(args[3], strings.Join(args[4:], " "))
+			if errors.Is(err, storage.ErrQuerySyntax) {
+				return fmt.Errorf("Invalid search query: %v", err)
+			}
+			return err
+		case `saved`:
+			s, err := storage.OpenDB(c.DBPath)
+			if err != nil {
+				return fmt.Errorf("Error opening database: %v", err)
+			}
+			defer s.Close()
+
+			searches, err := s.SavedSearches()
+			if err != nil {
+				return err
+			}
+			width := 0
+			for _, ss := range searches {
+				width = max(width, len(ss.Name))
+			}
+			for _, ss := range searches {
+				fmt.Printf("%s%s  %s\n", ss.Name, strings.Repeat(" ", width-len(ss.Name)), ss.Query)
 			}
 		case `browse`, `b`:
 			s, err := storage.OpenDB(c.DBPath)
@@ -297,6 +801,116 @@ func SearchCmd(args []string) error {
 	return nil
 }
 
+// printSearch prints the zettels matching query, searched with the
+// given flags, and adds the query to the search history.
+func printSearch(s *storage.Storage, query string, f searchFlags) error {
+	f.opts.Before, f.opts.After = red, reset
+	var zettels []storage.ResultZettel
+	var err error
+	if f.fuzzy {
+		zettels, err = s.FuzzyZettels(query, f.opts)
+	} else {
+		zettels, err = s.SearchZettels(query, f.opts)
+	}
+	if errors.Is(err, storage.ErrQuerySyntax) {
+		return fmt.Errorf("Invalid search query: %v", err)
+	}
+	if err != nil {
+		return fmt.Errorf("Error searching zettels: %v", err)
+	}
+	if err := s.AddHistory(query); err != nil {
+		return err
+	}
+	if len(zettels) == 0 && !f.fuzzy && f.opts.Offset == 0 {
+		// Suggestions go to stderr to keep stdout empty for scripts.
+		if sq, err := s.DidYouMean(query); err == nil && sq != "" {
+			fmt.Fprintf(os.Stderr, "No matches found. Did you mean: %s\n", sq)
+		}
+	}
+	for _, z := range zettels {
+		fmt.Println(yellow + z.DirName + reset + " " + z.TitleSnippet)
+		if z.Section.Level > 1 {
+			fmt.Println(sectionLine(z))
+		}
+		if z.BodySnippet != "" {
+			fmt.Println(removeEmptyLines(z.BodySnippet))
+		}
+		if z.TagsSnippet != "" {
+			hashedTags := "    #" + strings.ReplaceAll(z.TagsSnippet, " ", " #")
+			fmt.Println(hashedTags)
+		}
+	}
+	return nil
+}
+
+// searchFlags holds the flags of "search query" and "search run".
+type searchFlags struct {
+	opts  storage.SearchOptions
+	fuzzy bool     // match titles fuzzily instead of full text search
+	terms []string // remaining query terms
+}
+
+// parseSearchFlags parses the flags of "search query" and "search run"
+// out of args.
+func parseSearchFlags(args []string) (searchFlags, error) {
+	var f searchFlags
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "-f", "--fuzzy":
+			f.fuzzy = true
+		case "-l", "--limit", "-o", "--offset", "-s", "--snippet", "-w", "--weights":
+			if i+1 >= len(args) {
+				return f, fmt.Errorf("flag %s needs a value", arg)
+			}
+			i++
+			v := args[i]
+			switch arg {
+			case "-l", "--limit":
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 {
+					return f, fmt.Errorf("invalid limit: %s", v)
+				}
+				f.opts.Limit = n
+			case "-o", "--offset":
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 {
+					return f, fmt.Errorf("invalid offset: %s", v)
+				}
+				f.opts.Offset = n
+			case "-s", "--snippet":
+				switch strings.ToLower(v) {
+				case `lines`:
+					f.opts.Snippets = storage.SnippetLines
+				case `fragment`:
+					f.opts.Snippets = storage.SnippetFragment
+				case `none`:
+					f.opts.Snippets = storage.SnippetNone
+				default:
+					return f, fmt.Errorf("invalid snippet mode: %s", v)
+				}
+			case "-w", "--weights":
+				for _, w := range strings.Split(v, ",") {
+					n, err := strconv.ParseFloat(strings.TrimSpace(w), 64)
+					if err != nil {
+						return f, fmt.Errorf("invalid weights: %s", v)
+					}
+					f.opts.Weights = append(f.opts.Weights, n)
+				}
+			}
+		default:
+			f.terms = append(f.terms, arg)
+		}
+	}
+	return f, nil
+}
+
+// sectionLine returns the line that points out the section of a
+// search result, e.g. `  § Chapter 2 (20231028013010#chapter-2)`.
+func sectionLine(z storage.ResultZettel) string {
+	return fmt.Sprintf("  § %s (%s#%s)", z.Section.Heading, z.DirName, z.Section.Anchor)
+}
+
 func removeEmptyLines(str string) string {
 	lines := strings.Split(str, "\n")
 	var nonEmptyLines []string
@@ -406,7 +1020,11 @@ func ContentCmd(args []string) error {
 			return err
 		}
 	case `tags`:
-		if err := tagsCmd(args[2:], c.ZetDir); err != nil {
+		if err := tagsCmd(args[2:], c.ZetDir, c.DBPath); err != nil {
+			return err
+		}
+	case `meta`:
+		if err := metaCmd(args[2:], c.ZetDir); err != nil {
 			return err
 		}
 	case `help`:
@@ -477,28 +1095,47 @@ func bodyCmd(args []string, zetDir string) error {
 }
 
 func linksCmd(args []string, zetDir string) error {
-	var l string
+	// Parse flags and remove from args
+	asJSON := false
+	var filteredArgs []string
+	for _, arg := range args {
+		if arg == "-j" || arg == "--json" {
+			asJSON = true
+		} else {
+			filteredArgs = append(filteredArgs, arg)
+		}
+	}
+	args = filteredArgs
+
+	var p string
 	n := len(args)
 	switch n {
 	case 1:
-		p, ok, err := meta.InZettel(zetDir)
+		var ok bool
+		var err error
+		p, ok, err = meta.InZettel(zetDir)
 		if err != nil {
 			return fmt.Errorf("Error checking if user is in a zettel directory: %v", err)
 		}
 		if !ok {
 			return errors.New("not in a zettel")
 		}
-		l, err = meta.Links(p)
-		if err != nil {
-			return err
-		}
 	default:
-		var err error
-		p := filepath.Join(zetDir, args[1])
-		l, err = meta.Links(p)
+		p = filepath.Join(zetDir, args[1])
+	}
+
+	if asJSON {
+		refs, err := meta.LinkRefs(p)
 		if err != nil {
 			return err
 		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(refs)
+	}
+	l, err := meta.Links(p)
+	if err != nil {
+		return err
 	}
 	if l != "" {
 		fmt.Println(l)
@@ -506,7 +1143,14 @@ func linksCmd(args []string, zetDir string) error {
 	return nil
 }
 
-func tagsCmd(args []string, zetDir string) error {
+func tagsCmd(args []string, zetDir, dbPath string) error {
+	// Opening the database loads the inline-tags setting.
+	s, err := storage.OpenDB(dbPath)
+	if err != nil {
+		return err
+	}
+	s.Close()
+
 	var t string
 	n := len(args)
 	switch n {
@@ -536,19 +1180,49 @@ func tagsCmd(args []string, zetDir string) error {
 	return nil
 }
 
-// MergeCmd merges the contents of split zettel's into single body of text.
-//
-// The non-linear nature of a Zettelkasten is one of its main strengths,
-// but sometimes a linear representation is more suitable.
-//
-// Printing to standard output rather than writing to a file creates
-// flexibility is how you can use this command. It allows the user to
-// view the merged content in various ways (viewing, redirecting to a
-// file, further processing with other tools).
-//
-// Example usage:
-//
-// Print merged content to pager:
+func metaCmd(args []string, zetDir string) error {
+	var m string
+	n := len(args)
+	switch n {
+	case 1:
+		p, ok, err := meta.InZettel(zetDir)
+		if err != nil {
+			return fmt.Errorf("Error checking if user is in a zettel directory: %v", err)
+		}
+		if !ok {
+			return errors.New("not in a zettel")
+		}
+		m, err = meta.Meta(p)
+		if err != nil {
+			return err
+		}
+	default:
+		var err error
+		p := filepath.Join(zetDir, args[1])
+		m, err = meta.Meta(p)
+		if err != nil {
+			return err
+		}
+	}
+	if m != "" {
+		fmt.Println(m)
+	}
+	return nil
+}
+
+// MergeCmd merges the contents of split zettel's into single body of text.
+//
+// The non-linear nature of a Zettelkasten is one of its main strengths,
+// but sometimes a linear representation is more suitable.
+//
+// Printing to standard output rather than writing to a file creates
+// flexibility is how you can use this command. It allows the user to
+// view the merged content in various ways (viewing, redirecting to a
+// file, further processing with other tools).
+//
+// Example usage:
+//
+// Print merged content to pager:
 //
 // `$ zet merge 20231118194243 | less`
 //
@@ -1143,3 +1817,1172 @@ func RelatedCmd(args []string) error {
 
 	return nil
 }
+
+// WatchCmd parses and validates user arguments for the watch command.
+// If arguments are valid, it calls the desired operation.
+func WatchCmd(args []string) error {
+	c := new(config.C)
+	if err := c.Init(); err != nil {
+		return fmt.Errorf("Failed to initialize configuration file: %v", err)
+	}
+
+	if len(args) > 2 {
+		switch strings.ToLower(args[2]) {
+		case `help`:
+			fmt.Printf(watchUsage)
+		default:
+			fmt.Fprintln(os.Stderr, "Error: incorrect sub-command.")
+			fmt.Fprintf(os.Stderr, watchUsage)
+			os.Exit(1)
+		}
+		return nil
+	}
+
+	return zet.Watch(c.ZetDir, c.DBPath)
+}
+
+// CheckCmd parses and validates user arguments for the check command.
+// If arguments are valid, it calls the desired operation.
+func CheckCmd(args []string) error {
+	c := new(config.C)
+	if err := c.Init(); err != nil {
+		return fmt.Errorf("Failed to initialize configuration file: %v", err)
+	}
+
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "Error: Not enough arguments.")
+		fmt.Fprintf(os.Stderr, checkUsage)
+		os.Exit(1)
+	}
+
+	switch strings.ToLower(args[2]) {
+	case `links`:
+		n, err := checkLinks(c.ZetDir, c.DBPath)
+		if err != nil {
+			return err
+		}
+		if n > 0 {
+			os.Exit(1)
+		}
+	case `help`:
+		fmt.Printf(checkUsage)
+	default:
+		fmt.Fprintln(os.Stderr, "Error: incorrect sub-command.")
+		fmt.Fprintf(os.Stderr, checkUsage)
+		os.Exit(1)
+	}
+	return nil
+}
+
+// checkLinks prints all broken links, including links to missing
+// anchors, and returns how many were found.
+func checkLinks(zetDir, dbPath string) (int, error) {
+	s, err := storage.UpdateDB(zetDir, dbPath)
+	if err != nil {
+		return 0, fmt.Errorf("Error syncing database and flat files: %v", err)
+	}
+	defer s.Close()
+
+	links, err := s.BrokenLinks()
+	if err != nil {
+		return 0, err
+	}
+	for _, l := range links {
+		fmt.Printf("%s:%d: %s %s\n", filepath.Join(l.FromDir, l.FromName), l.Line, l.ToDir, l.Content)
+	}
+	anchors, err := s.MissingAnchors()
+	if err != nil {
+		return 0, err
+	}
+	for _, l := range anchors {
+		fmt.Printf("%s:%d: %s#%s %s\n", filepath.Join(l.FromDir, l.FromName), l.Line, l.ToDir, l.Anchor, l.Content)
+	}
+	return len(links) + len(anchors), nil
+}
+
+// BacklinksCmd parses and validates user arguments for the backlinks
+// command. If arguments are valid, it calls the desired operation.
+func BacklinksCmd(args []string) error {
+	c := new(config.C)
+	if err := c.Init(); err != nil {
+		return fmt.Errorf("Failed to initialize configuration file: %v", err)
+	}
+
+	// Parse flags and remove from args
+	context := false
+	var filteredArgs []string
+	for _, arg := range args {
+		if arg == "-c" || arg == "--context" {
+			context = true
+		} else {
+			filteredArgs = append(filteredArgs, arg)
+		}
+	}
+	args = filteredArgs
+
+	var iso string
+	switch len(args) {
+	case 2: // no args, use pwd as path
+		p, ok, err := meta.InZettel(c.ZetDir)
+		if err != nil {
+			return fmt.Errorf("Failed to check if user is in a zettel: %v", err)
+		}
+		if !ok {
+			return errors.New("not in a zettel")
+		}
+		iso = filepath.Base(p)
+	default:
+		if strings.ToLower(args[2]) == `help` {
+			fmt.Printf(backlinksUsage)
+			return nil
+		}
+		iso = args[2]
+	}
+
+	s, err := storage.UpdateDB(c.ZetDir, c.DBPath)
+	if err != nil {
+		return fmt.Errorf("Error syncing database and flat files: %v", err)
+	}
+	defer s.Close()
+
+	id, err := storage.ZettelIdDir(s.DB, iso)
+	if err != nil {
+		return fmt.Errorf("Failed to find zettel %s: %v", iso, err)
+	}
+	links, err := s.Backlinks(id)
+	if err != nil {
+		return err
+	}
+	for _, l := range links {
+		fmt.Println(meta.FormatLink(l.FromDir, l.FromTitle))
+		if context {
+			fmt.Printf("  %d %s: %s\n", l.Line, l.Type, l.Context)
+		}
+	}
+	return nil
+}
+
+// GraphCmd parses and validates user arguments for the graph command.
+// If arguments are valid, it calls the desired operation.
+func GraphCmd(args []string) error {
+	c := new(config.C)
+	if err := c.Init(); err != nil {
+		return fmt.Errorf("Failed to initialize configuration file: %v", err)
+	}
+
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "Error: Not enough arguments.")
+		fmt.Fprintf(os.Stderr, graphUsage)
+		os.Exit(1)
+	}
+
+	switch strings.ToLower(args[2]) {
+	case `export`:
+		return graphExport(c, args[3:])
+	case `orphans`:
+		return graphOrphans(c, args[3:])
+	case `hubs`:
+		return graphHubs(c, args[3:])
+	case `path`:
+		return graphPath(c, args[3:])
+	case `help`:
+		fmt.Printf(graphUsage)
+	default:
+		fmt.Fprintln(os.Stderr, "Error: incorrect sub-command.")
+		fmt.Fprintf(os.Stderr, graphUsage)
+		os.Exit(1)
+	}
+	return nil
+}
+
+// graphFlags holds the flags shared by graph subcommands that narrow
+// down the graph.
+type graphFlags struct {
+	format     string
+	tag        string
+	around     string
+	hops       int
+	by         string
+	limit      int
+	undirected bool
+	period     string   // day, week, month or year
+	args       []string // remaining positional arguments
+}
+
+// parseGraphFlags parses graph flags and the optional temporal period
+// out of args.
+func parseGraphFlags(args []string) (graphFlags, error) {
+	f := graphFlags{format: `dot`, hops: 1, by: `degree`, limit: 10}
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		switch arg {
+		case "-u", "--undirected":
+			f.undirected = true
+		case "-f", "--format", "-t", "--tag", "-a", "--around", "-n", "--hops",
+			"-b", "--by", "-l", "--limit":
+			if i+1 >= len(args) {
+				return f, fmt.Errorf("flag %s needs a value", arg)
+			}
+			i++
+			v := args[i]
+			switch arg {
+			case "-f", "--format":
+				f.format = v
+			case "-t", "--tag":
+				f.tag = strings.TrimPrefix(v, "#")
+			case "-a", "--around":
+				f.around = v
+			case "-n", "--hops":
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 {
+					return f, fmt.Errorf("invalid number of hops: %s", v)
+				}
+				f.hops = n
+			case "-b", "--by":
+				f.by = strings.ToLower(v)
+			case "-l", "--limit":
+				n, err := strconv.Atoi(v)
+				if err != nil || n < 0 {
+					return f, fmt.Errorf("invalid limit: %s", v)
+				}
+				f.limit = n
+			}
+		default:
+			f.args = append(f.args, arg)
+		}
+	}
+	if len(f.args) > 0 {
+		switch p := strings.ToLower(f.args[0]); p {
+		case `day`, `week`, `month`, `year`:
+			f.period = p
+			f.args = f.args[1:]
+		}
+	}
+	return f, nil
+}
+
+// filteredGraph loads the link graph and narrows it down using the
+// given flags.
+func filteredGraph(s *storage.Storage, f graphFlags) (*graph.Graph, error) {
+	g, err := graph.Load(s)
+	if err != nil {
+		return nil, fmt.Errorf("Failed to load graph: %v", err)
+	}
+	if f.period != "" {
+		start, end, err := parseDateArgs(f.period, f.args)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to parse date arguments: %v", err)
+		}
+		g = g.Between(start, end)
+	}
+	if f.tag != "" {
+		g = g.WithTag(f.tag)
+	}
+	if f.around != "" {
+		g, err = g.Neighbourhood(f.around, f.hops)
+		if err != nil {
+			return nil, err
+		}
+	}
+	return g, nil
+}
+
+// graphExport prints the link graph in the requested format.
+func graphExport(c *config.C, args []string) error {
+	f, err := parseGraphFlags(args)
+	if err != nil {
+		return err
+	}
+
+	s, err := storage.UpdateDB(c.ZetDir, c.DBPath)
+	if err != nil {
+		return fmt.Errorf("Error syncing database and flat files: %v", err)
+	}
+	defer s.Close()
+
+	g, err := filteredGraph(s, f)
+	if err != nil {
+		return err
+	}
+	return g.Export(os.Stdout, f.format)
+}
+
+// graphOrphans prints zettels without any links.
+func graphOrphans(c *config.C, args []string) error {
+	f, err := parseGraphFlags(args)
+	if err != nil {
+		return err
+	}
+
+	s, err := storage.UpdateDB(c.ZetDir, c.DBPath)
+	if err != nil {
+		return fmt.Errorf("Error syncing database and flat files: %v", err)
+	}
+	defer s.Close()
+
+	g, err := filteredGraph(s, f)
+	if err != nil {
+		return err
+	}
+	for _, n := range g.Orphans() {
+		fmt.Println(yellow + n.Key + reset + " " + n.Title)
+	}
+	return nil
+}
+
+// graphHubs prints zettels ranked by how well connected they are.
+func graphHubs(c *config.C, args []string) error {
+	f, err := parseGraphFlags(args)
+	if err != nil {
+		return err
+	}
+
+	s, err := storage.UpdateDB(c.ZetDir, c.DBPath)
+	if err != nil {
+		return fmt.Errorf("Error syncing database and flat files: %v", err)
+	}
+	defer s.Close()
+
+	g, err := filteredGraph(s, f)
+	if err != nil {
+		return err
+	}
+
+	var ranked []graph.Ranked
+	format := "%4.0f"
+	switch f.by {
+	case `degree`:
+		ranked = g.Degree()
+	case `pagerank`, `pr`:
+		ranked = g.PageRank()
+		format = "%.4f"
+	default:
+		return fmt.Errorf("unknown ranking %q, expected degree or pagerank", f.by)
+	}
+	if f.limit > 0 && len(ranked) > f.limit {
+		ranked = ranked[:f.limit]
+	}
+	for _, r := range ranked {
+		score := fmt.Sprintf(format, r.Score)
+		fmt.Println(score + " " + yellow + r.Key + reset + " " + r.Title)
+	}
+	return nil
+}
+
+// graphPath prints the shortest chain of links between two zettels.
+func graphPath(c *config.C, args []string) error {
+	f, err := parseGraphFlags(args)
+	if err != nil {
+		return err
+	}
+	if len(f.args) != 2 {
+		fmt.Fprintln(os.Stderr, "Error: path needs two zettels.")
+		fmt.Fprintf(os.Stderr, graphUsage)
+		os.Exit(1)
+	}
+
+	s, err := storage.UpdateDB(c.ZetDir, c.DBPath)
+	if err != nil {
+		return fmt.Errorf("Error syncing database and flat files: %v", err)
+	}
+	defer s.Close()
+
+	g, err := graph.Load(s)
+	if err != nil {
+		return fmt.Errorf("Failed to load graph: %v", err)
+	}
+	path, err := g.ShortestPath(f.args[0], f.args[1], !f.undirected)
+	if err != nil {
+		return err
+	}
+	for _, n := range path {
+		fmt.Println(meta.FormatLink(n.Key, n.Title))
+	}
+	return nil
+}
+
+// RmCmd parses and validates user arguments for the rm command. If
+// arguments are valid, it calls the desired operation.
+func RmCmd(args []string) error {
+	c := new(config.C)
+	if err := c.Init(); err != nil {
+		return fmt.Errorf("Failed to initialize configuration file: %v", err)
+	}
+
+	var iso, rewrite string
+	strike := false
+	for i := 2; i < len(args); i++ {
+		switch args[i] {
+		case `-s`, `--strike`:
+			strike = true
+		case `-r`, `--rewrite`:
+			if i+1 >= len(args) {
+				fmt.Fprintln(os.Stderr, "Error: --rewrite requires an isosec.")
+				fmt.Fprintf(os.Stderr, rmUsage)
+				os.Exit(1)
+			}
+			i++
+			rewrite = args[i]
+		case `help`:
+			fmt.Printf(rmUsage)
+			return nil
+		default:
+			if iso != "" {
+				fmt.Fprintln(os.Stderr, "Error: Too many arguments.")
+				fmt.Fprintf(os.Stderr, rmUsage)
+				os.Exit(1)
+			}
+			iso = args[i]
+		}
+	}
+	if strike && rewrite != "" {
+		fmt.Fprintln(os.Stderr, "Error: --strike and --rewrite can't be used together.")
+		fmt.Fprintf(os.Stderr, rmUsage)
+		os.Exit(1)
+	}
+	if iso == "" {
+		p, ok, err := meta.InZettel(c.ZetDir)
+		if err != nil {
+			return fmt.Errorf("Failed to check if user is in a zettel: %v", err)
+		}
+		if !ok {
+			return errors.New("not in a zettel")
+		}
+		iso = filepath.Base(p)
+	}
+
+	return rm(c.ZetDir, c.DBPath, iso, rewrite, strike)
+}
+
+// rm moves the zettel iso to the trash. Links to it are rewritten to
+// point at the zettel rewrite if it isn't empty, struck out if strike
+// is true and listed otherwise.
+func rm(zetDir, dbPath, iso, rewrite string, strike bool) error {
+	s, err := storage.UpdateDB(zetDir, dbPath)
+	if err != nil {
+		return fmt.Errorf("Error syncing database and flat files: %v", err)
+	}
+	defer s.Close()
+
+	id, err := storage.ZettelIdDir(s.DB, iso)
+	if err != nil {
+		return fmt.Errorf("Failed to find zettel %s: %v", iso, err)
+	}
+	bl, err := s.Backlinks(id)
+	if err != nil {
+		return err
+	}
+	var links []storage.Backlink
+	for _, l := range bl {
+		if l.FromDir != iso {
+			links = append(links, l)
+		}
+	}
+
+	var repl func(storage.Backlink) string
+	switch {
+	case rewrite != "":
+		if _, err := storage.ZettelIdDir(s.DB, rewrite); err != nil {
+			return fmt.Errorf("Failed to find zettel %s: %v", rewrite, err)
+		}
+		repl = func(l storage.Backlink) string { return zet.RenameLink(l.Content, iso, rewrite) }
+	case strike:
+		repl = func(l storage.Backlink) string { return zet.StrikeLink(l.Content) }
+	}
+
+	// Trash the zettel first so a failure to do so leaves its links as
+	// they are.
+	if err := zet.Remove(zetDir, iso); err != nil {
+		return err
+	}
+	var dirs []string
+	if repl != nil {
+		dirs, err = zet.RewriteLinks(zetDir, links, repl)
+		if err != nil {
+			if err := zet.Restore(zetDir, iso); err != nil {
+				return fmt.Errorf("Failed to restore %s from trash: %v", iso, err)
+			}
+			return fmt.Errorf("Failed to rewrite links: %v", err)
+		}
+	}
+	for _, d := range append(dirs, iso) {
+		if err := s.SyncZettel(zetDir, d); err != nil {
+			return fmt.Errorf("Failed to sync zettel %s: %v", d, err)
+		}
+	}
+
+	fmt.Printf("Moved %s to trash.\n", iso)
+	switch {
+	case repl != nil:
+		fmt.Printf("Rewrote %d link(s) in %d zettel(s).\n", len(links), len(dirs))
+	case len(links) > 0:
+		fmt.Println("Zettels still linking to it:")
+		for _, l := range links {
+			fmt.Println(meta.FormatLink(l.FromDir, l.FromTitle))
+		}
+	}
+	return nil
+}
+
+// MvCmd parses and validates user arguments for the mv command. If
+// arguments are valid, it calls the desired operation.
+func MvCmd(args []string) error {
+	c := new(config.C)
+	if err := c.Init(); err != nil {
+		return fmt.Errorf("Failed to initialize configuration file: %v", err)
+	}
+
+	dryRun := false
+	var names []string
+	for _, arg := range args[2:] {
+		switch arg {
+		case `-n`, `--dry-run`:
+			dryRun = true
+		case `help`:
+			fmt.Printf(mvUsage)
+			return nil
+		default:
+			names = append(names, arg)
+		}
+	}
+	if len(names) != 2 {
+		fmt.Fprintln(os.Stderr, "Error: mv requires an old and a new name.")
+		fmt.Fprintf(os.Stderr, mvUsage)
+		os.Exit(1)
+	}
+
+	return mv(c.ZetDir, c.DBPath, names[0], names[1], dryRun)
+}
+
+// mv renames the zettel directory oldName to newName and rewrites every
+// link to it. If dryRun is true, the planned edits are printed instead.
+func mv(zetDir, dbPath, oldName, newName string, dryRun bool) error {
+	if err := zet.ValidName(newName); err != nil {
+		return err
+	}
+	if _, err := os.Stat(filepath.Join(zetDir, newName)); err == nil {
+		return fmt.Errorf("zettel %s already exists", newName)
+	}
+
+	s, err := storage.UpdateDB(zetDir, dbPath)
+	if err != nil {
+		return fmt.Errorf("Error syncing database and flat files: %v", err)
+	}
+	defer s.Close()
+
+	id, err := storage.ZettelIdDir(s.DB, oldName)
+	if err != nil {
+		return fmt.Errorf("Failed to find zettel %s: %v", oldName, err)
+	}
+	links, err := s.Backlinks(id)
+	if err != nil {
+		return err
+	}
+	repl := func(l storage.Backlink) string {
+		return zet.RenameLink(l.Content, oldName, newName)
+	}
+
+	if dryRun {
+		fmt.Printf("rename %s -> %s\n", oldName, newName)
+		for _, l := range links {
+			fmt.Printf("%s:%d: %s -> %s\n", filepath.Join(l.FromDir, l.FromName), l.Line, l.Content, repl(l))
+		}
+		return nil
+	}
+
+	// Rename first so a failed rename leaves no links pointing at a
+	// zettel that isn't there. Links the zettel has to itself now live
+	// in the renamed directory.
+	if err := zet.Move(zetDir, oldName, newName); err != nil {
+		return err
+	}
+	for i, l := range links {
+		if l.FromDir == oldName {
+			links[i].FromDir = newName
+		}
+	}
+	dirs, err := zet.RewriteLinks(zetDir, links, repl)
+	if err != nil {
+		if err := zet.Move(zetDir, newName, oldName); err != nil {
+			return fmt.Errorf("Failed to move %s back to %s: %v", newName, oldName, err)
+		}
+		return fmt.Errorf("Failed to rewrite links: %v", err)
+	}
+	if err := s.MoveZettel(zetDir, oldName, newName, dirs); err != nil {
+		return fmt.Errorf("Failed to update database: %v", err)
+	}
+
+	fmt.Printf("Moved %s to %s and rewrote %d link(s) in %d zettel(s).\n", oldName, newName, len(links), len(dirs))
+	return nil
+}
+
+// LinksCmd parses and validates user arguments for the links command.
+// If arguments are valid, it calls the desired operation.
+func LinksCmd(args []string) error {
+	c := new(config.C)
+	if err := c.Init(); err != nil {
+		return fmt.Errorf("Failed to initialize configuration file: %v", err)
+	}
+
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "Error: Not enough arguments.")
+		fmt.Fprintf(os.Stderr, linksUsage)
+		os.Exit(1)
+	}
+
+	switch strings.ToLower(args[2]) {
+	case `refresh`:
+		yes := false
+		for _, arg := range args[3:] {
+			if arg == `-y` || arg == `--yes` {
+				yes = true
+			}
+		}
+		s, err := storage.UpdateDB(c.ZetDir, c.DBPath)
+		if err != nil {
+			return fmt.Errorf("Error syncing database and flat files: %v", err)
+		}
+		defer s.Close()
+		links, err := s.StaleLinks()
+		if err != nil {
+			return err
+		}
+		return refreshLinks(s, c.ZetDir, links, yes)
+	case `help`:
+		fmt.Printf(linksUsage)
+	default:
+		fmt.Fprintln(os.Stderr, "Error: incorrect sub-command.")
+		fmt.Fprintf(os.Stderr, linksUsage)
+		os.Exit(1)
+	}
+	return nil
+}
+
+// RetitleCmd parses and validates user arguments for the retitle
+// command. If arguments are valid, it calls the desired operation.
+func RetitleCmd(args []string) error {
+	c := new(config.C)
+	if err := c.Init(); err != nil {
+		return fmt.Errorf("Failed to initialize configuration file: %v", err)
+	}
+
+	yes := false
+	var rest []string
+	for _, arg := range args[2:] {
+		switch arg {
+		case `-y`, `--yes`:
+			yes = true
+		case `help`:
+			fmt.Printf(retitleUsage)
+			return nil
+		default:
+			rest = append(rest, arg)
+		}
+	}
+	if len(rest) != 2 {
+		fmt.Fprintln(os.Stderr, "Error: retitle requires an isosec and a title.")
+		fmt.Fprintf(os.Stderr, retitleUsage)
+		os.Exit(1)
+	}
+	iso, title := rest[0], rest[1]
+
+	if err := zet.Retitle(c.ZetDir, iso, title); err != nil {
+		return err
+	}
+	s, err := storage.UpdateDB(c.ZetDir, c.DBPath)
+	if err != nil {
+		return fmt.Errorf("Error syncing database and flat files: %v", err)
+	}
+	defer s.Close()
+	if err := s.SyncZettel(c.ZetDir, iso); err != nil {
+		return fmt.Errorf("Failed to sync zettel %s: %v", iso, err)
+	}
+
+	stale, err := s.StaleLinks()
+	if err != nil {
+		return err
+	}
+	var links []storage.StaleLink
+	for _, l := range stale {
+		if l.ToDir == iso {
+			links = append(links, l)
+		}
+	}
+	return refreshLinks(s, c.ZetDir, links, yes)
+}
+
+// refreshLinks prints the changes needed to bring the titles of the
+// given links up to date and, once confirmed, rewrites the files they
+// live in.
+func refreshLinks(s *storage.Storage, zetDir string, links []storage.StaleLink, yes bool) error {
+	if len(links) == 0 {
+		fmt.Println("All links are up to date.")
+		return nil
+	}
+
+	bl := make([]storage.Backlink, 0, len(links))
+	newContent := make(map[int]string, len(links))
+	for _, l := range links {
+		nc := zet.RetitleLink(l.Content, storage.LinkTitle(l.Content), l.ToTitle)
+		newContent[l.ID] = nc
+		bl = append(bl, l.Backlink)
+		fmt.Printf("%s:%d\n", filepath.Join(l.FromDir, l.FromName), l.Line)
+		fmt.Println(red + "- " + l.Content + reset)
+		fmt.Println(green + "+ " + nc + reset)
+	}
+
+	if !yes && !confirm(fmt.Sprintf("Rewrite %d link(s)?", len(links))) {
+		return nil
+	}
+
+	dirs, err := zet.RewriteLinks(zetDir, bl, func(l storage.Backlink) string {
+		return newContent[l.ID]
+	})
+	if err != nil {
+		return fmt.Errorf("Failed to rewrite links: %v", err)
+	}
+	for _, d := range dirs {
+		if err := s.SyncZettel(zetDir, d); err != nil {
+			return fmt.Errorf("Failed to sync zettel %s: %v", d, err)
+		}
+	}
+	fmt.Printf("Rewrote %d link(s) in %d zettel(s).\n", len(links), len(dirs))
+	return nil
+}
+
+// confirm asks the user a yes or no question on standard input and
+// reports whether they answered yes.
+func confirm(question string) bool {
+	fmt.Printf("%s [y/N] ", question)
+	answer, err := bufio.NewReader(os.Stdin).ReadString('\n')
+	if err != nil {
+		return false
+	}
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	return answer == "y" || answer == "yes"
+}
+
+// TagsCmd parses and validates user arguments for the tags command. If
+// arguments are valid, it calls the desired operation.
+func TagsCmd(args []string) error {
+	c := new(config.C)
+	if err := c.Init(); err != nil {
+		return fmt.Errorf("Failed to initialize configuration file: %v", err)
+	}
+
+	// The list sub-command is optional, even when flags are given, e.g.
+	// `zet tags --tree`.
+	if len(args) < 3 || strings.HasPrefix(args[2], `-`) {
+		args = append(args[:2:2], append([]string{`list`}, args[2:]...)...)
+	}
+
+	// Parse flags shared by all sub-commands and remove from args.
+	yes, tree := false, false
+	sort := `count`
+	into := ""
+	var rest []string
+	for i := 3; i < len(args); i++ {
+		switch args[i] {
+		case `-y`, `--yes`:
+			yes = true
+		case `-t`, `--tree`:
+			tree = true
+		case `-s`, `--sort`, `--into`:
+			if i+1 >= len(args) {
+				fmt.Fprintf(os.Stderr, "Error: %s requires a value.\n", args[i])
+				fmt.Fprintf(os.Stderr, tagsUsage)
+				os.Exit(1)
+			}
+			if args[i] == `--into` {
+				into = args[i+1]
+			} else {
+				sort = args[i+1]
+			}
+			i++
+		default:
+			rest = append(rest, strings.TrimPrefix(args[i], `#`))
+		}
+	}
+	into = strings.TrimPrefix(into, `#`)
+
+	switch strings.ToLower(args[2]) {
+	case `list`, `ls`:
+		if sort != `count` && sort != `name` {
+			fmt.Fprintf(os.Stderr, "Error: unknown sort %q.\n", sort)
+			fmt.Fprintf(os.Stderr, tagsUsage)
+			os.Exit(1)
+		}
+		return tagsList(c, sort, tree)
+	case `rename`, `mv`:
+		if len(rest) != 2 {
+			fmt.Fprintln(os.Stderr, "Error: rename requires an old and a new tag.")
+			fmt.Fprintf(os.Stderr, tagsUsage)
+			os.Exit(1)
+		}
+		if err := zet.ValidTag(rest[1]); err != nil {
+			return err
+		}
+		return retag(c, map[string]string{rest[0]: rest[1]}, yes)
+	case `merge`:
+		if len(rest) == 0 || into == "" {
+			fmt.Fprintln(os.Stderr, "Error: merge requires tags and a tag to merge --into.")
+			fmt.Fprintf(os.Stderr, tagsUsage)
+			os.Exit(1)
+		}
+		if err := zet.ValidTag(into); err != nil {
+			return err
+		}
+		repl := make(map[string]string, len(rest))
+		for _, t := range rest {
+			repl[t] = into
+		}
+		return retag(c, repl, yes)
+	case `rm`:
+		if len(rest) == 0 {
+			fmt.Fprintln(os.Stderr, "Error: rm requires at least one tag.")
+			fmt.Fprintf(os.Stderr, tagsUsage)
+			os.Exit(1)
+		}
+		repl := make(map[string]string, len(rest))
+		for _, t := range rest {
+			repl[t] = ""
+		}
+		return retag(c, repl, yes)
+	case `help`:
+		fmt.Printf(tagsUsage)
+	default:
+		fmt.Fprintln(os.Stderr, "Error: incorrect sub-command.")
+		fmt.Fprintf(os.Stderr, tagsUsage)
+		os.Exit(1)
+	}
+	return nil
+}
+
+// tagsList prints every tag with its usage count. If tree is true, the
+// tag hierarchy is printed instead.
+func tagsList(c *config.C, sort string, tree bool) error {
+	s, err := storage.UpdateDB(c.ZetDir, c.DBPath)
+	if err != nil {
+		return fmt.Errorf("Error syncing database and flat files: %v", err)
+	}
+	defer s.Close()
+
+	if tree {
+		roots, err := s.TagTree()
+		if err != nil {
+			return err
+		}
+		var print func(n *storage.TagNode, depth int)
+		print = func(n *storage.TagNode, depth int) {
+			fmt.Printf("%5d %s%s\n", n.Total, strings.Repeat("  ", depth), yellow+"#"+n.Label()+reset)
+			for _, child := range n.Children {
+				print(child, depth+1)
+			}
+		}
+		for _, n := range roots {
+			print(n, 0)
+		}
+		return nil
+	}
+
+	tags, err := s.TagCounts(sort)
+	if err != nil {
+		return err
+	}
+	for _, t := range tags {
+		fmt.Printf("%5d %s\n", t.Count, yellow+"#"+t.Name+reset)
+	}
+	return nil
+}
+
+// retag replaces every tag that has an entry in repl with its value
+// across all zettels, removing tags whose value is empty. The changes
+// are printed and confirmed before any file is rewritten.
+func retag(c *config.C, repl map[string]string, yes bool) error {
+	s, err := storage.UpdateDB(c.ZetDir, c.DBPath)
+	if err != nil {
+		return fmt.Errorf("Error syncing database and flat files: %v", err)
+	}
+	defer s.Close()
+
+	tags := make([]string, 0, len(repl))
+	for t := range repl {
+		tags = append(tags, t)
+	}
+	zettels, err := s.TaggedZettels(tags)
+	if err != nil {
+		return err
+	}
+
+	var changed []storage.Zettel
+	for _, z := range zettels {
+		f := filepath.Join(z.DirName, z.Name)
+		edits, err := zet.Retag(filepath.Join(c.ZetDir, f), repl, true)
+		if err != nil {
+			return fmt.Errorf("Failed to read %s: %v", f, err)
+		}
+		if len(edits) == 0 {
+			continue
+		}
+		changed = append(changed, z)
+		for _, e := range edits {
+			fmt.Printf("%s:%d\n", f, e.Line)
+			fmt.Println(red + "- " + e.Old + reset)
+			if e.New != "" {
+				fmt.Println(green + "+ " + e.New + reset)
+			}
+		}
+	}
+	if len(changed) == 0 {
+		fmt.Println("No zettels to change.")
+		return nil
+	}
+	if !yes && !confirm(fmt.Sprintf("Rewrite %d zettel(s)?", len(changed))) {
+		return nil
+	}
+
+	synced := make(map[string]bool)
+	for _, z := range changed {
+		f := filepath.Join(z.DirName, z.Name)
+		if _, err := zet.Retag(filepath.Join(c.ZetDir, f), repl, false); err != nil {
+			return fmt.Errorf("Failed to rewrite %s: %v", f, err)
+		}
+		if synced[z.DirName] {
+			continue
+		}
+		synced[z.DirName] = true
+		if err := s.SyncZettel(c.ZetDir, z.DirName); err != nil {
+			return fmt.Errorf("Failed to sync zettel %s: %v", z.DirName, err)
+		}
+	}
+	fmt.Printf("Rewrote %d zettel(s).\n", len(changed))
+	return nil
+}
+
+// TrashCmd parses and validates user arguments for the trash command.
+// If arguments are valid, it calls the desired operation.
+func TrashCmd(args []string) error {
+	c := new(config.C)
+	if err := c.Init(); err != nil {
+		return fmt.Errorf("Failed to initialize configuration file: %v", err)
+	}
+
+	if len(args) < 3 {
+		args = append(args, `list`)
+	}
+
+	switch strings.ToLower(args[2]) {
+	case `list`, `ls`:
+		isos, err := zet.Trashed(c.ZetDir)
+		if err != nil {
+			return err
+		}
+		for _, iso := range isos {
+			t, err := meta.Title(filepath.Join(c.ZetDir, zet.TrashDir, iso))
+			if err != nil {
+				t = ""
+			}
+			fmt.Println(yellow + iso + reset + " " + t)
+		}
+	case `restore`:
+		if len(args) != 4 {
+			fmt.Fprintln(os.Stderr, "Error: restore requires exactly one isosec.")
+			fmt.Fprintf(os.Stderr, trashUsage)
+			os.Exit(1)
+		}
+		iso := args[3]
+		if err := zet.Restore(c.ZetDir, iso); err != nil {
+			return err
+		}
+		s, err := storage.OpenDB(c.DBPath)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		if err := s.SyncZettel(c.ZetDir, iso); err != nil {
+			return fmt.Errorf("Failed to sync zettel %s: %v", iso, err)
+		}
+		l, err := meta.Link(filepath.Join(c.ZetDir, iso))
+		if err != nil {
+			return err
+		}
+		fmt.Println("Restored", l)
+	case `help`:
+		fmt.Printf(trashUsage)
+	default:
+		fmt.Fprintln(os.Stderr, "Error: incorrect sub-command.")
+		fmt.Fprintf(os.Stderr, trashUsage)
+		os.Exit(1)
+	}
+	return nil
+}
+
+// DoctorCmd parses and validates user arguments for the doctor
+// command. If arguments are valid, it calls the desired operation.
+func DoctorCmd(args []string) error {
+	c := new(config.C)
+	if err := c.Init(); err != nil {
+		return fmt.Errorf("Failed to initialize configuration file: %v", err)
+	}
+
+	fix := false
+	for _, arg := range args[2:] {
+		switch strings.ToLower(arg) {
+		case `-f`, `--fix`:
+			fix = true
+		case `help`:
+			fmt.Printf(doctorUsage)
+			return nil
+		default:
+			fmt.Fprintf(os.Stderr, "Error: unknown argument %q.\n", arg)
+			fmt.Fprintf(os.Stderr, doctorUsage)
+			os.Exit(1)
+		}
+	}
+
+	n, err := doctor(c.ZetDir, c.DBPath, fix)
+	if err != nil {
+		return err
+	}
+	if n > 0 {
+		os.Exit(1)
+	}
+	return nil
+}
+
+// doctor prints every problem found in the database, repairing them if
+// fix is true, and returns how many problems remain.
+func doctor(zetDir, dbPath string, fix bool) (int, error) {
+	s, err := storage.OpenDB(dbPath)
+	if err != nil {
+		return 0, err
+	}
+	defer s.Close()
+
+	problems, err := s.Diagnose(zetDir)
+	if err != nil {
+		return 0, err
+	}
+	for _, p := range problems {
+		fmt.Println(p)
+	}
+	if len(problems) == 0 {
+		fmt.Println("No problems found.")
+		return 0, nil
+	}
+	if !fix {
+		fmt.Printf("%d problem(s) found. Run \"zet doctor --fix\" to repair them.\n", len(problems))
+		return len(problems), nil
+	}
+
+	if err := s.Repair(zetDir); err != nil {
+		return 0, fmt.Errorf("Failed to repair database: %v", err)
+	}
+	remaining, err := s.Diagnose(zetDir)
+	if err != nil {
+		return 0, err
+	}
+	fmt.Printf("Repaired %d problem(s).\n", len(problems)-len(remaining))
+	for _, p := range remaining {
+		fmt.Println("unrepaired", p)
+	}
+	return len(remaining), nil
+}
+
+// DBCmd parses and validates user arguments for the db command. If
+// arguments are valid, it calls the desired operation.
+func DBCmd(args []string) error {
+	c := new(config.C)
+	if err := c.Init(); err != nil {
+		return fmt.Errorf("Failed to initialize configuration file: %v", err)
+	}
+
+	if len(args) < 3 {
+		fmt.Fprintln(os.Stderr, "Error: Not enough arguments.")
+		fmt.Fprintf(os.Stderr, dbUsage)
+		os.Exit(1)
+	}
+
+	switch strings.ToLower(args[2]) {
+	case `migrate`:
+		dryRun := false
+		for _, arg := range args[3:] {
+			if arg == "-n" || arg == "--dry-run" {
+				dryRun = true
+			}
+		}
+		ms, v, err := storage.MigrateDB(c.DBPath, dryRun)
+		if err != nil {
+			return err
+		}
+		if len(ms) == 0 {
+			fmt.Printf("Schema is up to date at version %d.\n", v)
+			return nil
+		}
+		verb := "Applied"
+		if dryRun {
+			verb = "Pending"
+		}
+		fmt.Printf("%s migrations from version %d:\n", verb, v)
+		for _, m := range ms {
+			fmt.Printf("  %d: %s\n", m.Version, m.Description)
+		}
+	case `set`:
+		if len(args) != 5 {
+			fmt.Fprintln(os.Stderr, "Error: set requires a setting name and value.")
+			fmt.Fprintf(os.Stderr, dbUsage)
+			os.Exit(1)
+		}
+		return setSetting(c.ZetDir, c.DBPath, args[3], args[4])
+	case `settings`:
+		s, err := storage.OpenDB(c.DBPath)
+		if err != nil {
+			return err
+		}
+		defer s.Close()
+		for _, name := range storage.SettingNames() {
+			v, err := s.Setting(name)
+			if err != nil {
+				return err
+			}
+			fmt.Printf("%s %s\n", name, v)
+		}
+	case `help`:
+		fmt.Printf(dbUsage)
+	default:
+		fmt.Fprintln(os.Stderr, "Error: incorrect sub-command.")
+		fmt.Fprintf(os.Stderr, dbUsage)
+		os.Exit(1)
+	}
+	return nil
+}
+
+// setSetting changes a setting of the database and, if it changed,
+// rescans the whole zet directory so zettels are stored the new way.
+// The rescan happens even while a watcher is running, since the
+// watcher only syncs zettels as they change.
+func setSetting(zetDir, dbPath, name, value string) error {
+	s, err := storage.OpenDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	changed, err := s.SetSetting(name, value)
+	if err != nil {
+		return err
+	}
+	v, err := s.Setting(name)
+	if err != nil {
+		return err
+	}
+	if !changed {
+		fmt.Printf("%s is already %s.\n", name, v)
+		return nil
+	}
+	if err := s.Sync(zetDir); err != nil {
+		return fmt.Errorf("Error syncing database and flat files: %v", err)
+	}
+	fmt.Printf("Set %s to %s.\n", name, v)
+	return nil
+}
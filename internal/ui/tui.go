@@ -1,6 +1,7 @@
 package ui
 
 import (
+	"errors"
 	"fmt"
 	"log"
 	"os"
@@ -28,8 +29,12 @@ type searchMode int32
 const (
 	searchModeTitle searchMode = iota
 	searchModeAll
+	searchModeFuzzy
 )
 
+// suggestion is a query to try instead of one that matched nothing.
+type suggestion string
+
 type searchFilter string
 
 const (
@@ -61,11 +66,64 @@ type SearchUI struct {
 	// screenWidth holds the width of the screen in characters.
 	screenWidth int
 
+	// history holds earlier queries to go through with up and down in
+	// the input field.
+	history *queryHistory
+
 	syncState      atomic.Int32
 	pendingRefresh atomic.Bool
 	searchMode     atomic.Int32
 }
 
+// queryHistory steps through earlier queries, latest first, and keeps
+// the query being typed to come back to.
+type queryHistory struct {
+	queries []string
+	pos     int    // index of the query shown, -1 for the one being typed
+	draft   string // query being typed
+}
+
+func newQueryHistory(queries []string) *queryHistory {
+	return &queryHistory{queries: queries, pos: -1}
+}
+
+// prev returns the query before the one shown, if any. The current
+// query is kept when leaving the one being typed.
+func (h *queryHistory) prev(current string) (string, bool) {
+	if h.pos+1 >= len(h.queries) {
+		return "", false
+	}
+	if h.pos == -1 {
+		h.draft = current
+	}
+	h.pos++
+	return h.queries[h.pos], true
+}
+
+// next returns the query after the one shown, ending with the one that
+// was being typed.
+func (h *queryHistory) next() (string, bool) {
+	if h.pos < 0 {
+		return "", false
+	}
+	h.pos--
+	if h.pos == -1 {
+		return h.draft, true
+	}
+	return h.queries[h.pos], true
+}
+
+// add puts q first in the history and goes back to typing a new query.
+func (h *queryHistory) add(q string) {
+	queries := []string{q}
+	for _, e := range h.queries {
+		if e != q {
+			queries = append(queries, e)
+		}
+	}
+	h.queries, h.pos, h.draft = queries, -1, ""
+}
+
 // NewSearchUI creates and initializes a new SearchUI.
 func NewSearchUI(s *storage.Storage, query, zetDir, dbPath, editor string) *SearchUI {
 	sui := &SearchUI{
@@ -76,6 +134,9 @@ func NewSearchUI(s *storage.Storage, query, zetDir, dbPath, editor string) *Sear
 		storage:     s,
 		screenWidth: 50,
 	}
+	// A history that can't be read just starts out empty.
+	queries, _ := s.SearchHistory(0)
+	sui.history = newQueryHistory(queries)
 
 	sui.setupUI(query, zetDir, dbPath, editor)
 
@@ -138,6 +199,9 @@ func (sui *SearchUI) globalInput() {
 		case tcell.KeyCtrlR:
 			sui.refreshCurrentView()
 			return nil
+		case tcell.KeyCtrlS:
+			sui.displaySavedSearches()
+			return nil
 		}
 		return event
 	})
@@ -148,8 +212,11 @@ func (sui *SearchUI) globalInput() {
 // It interprets the following key bindings and triggers corresponding
 // actions:
 //
-//   - Enter: Sets focus to results list.
+//   - Enter: Sets focus to results list and adds the query to the
+//     search history.
+//   - Up, Down: Goes through the search history.
 //   - Ctrl+Enter: Uses current search query as title for new zettel.
+//   - Ctrl+S: Lists saved searches.
 //   - Ctrl+R: Refreshes the current view from the latest database snapshot.
 //   - Esc: Exits the search interface.
 func (sui *SearchUI) ipInput(zetDir, editor string) {
@@ -169,6 +236,18 @@ func (sui *SearchUI) ipInput(zetDir, editor string) {
 				log.Printf("Failed to add zettel: %v\n", err)
 			}
 		}
+		switch event.Key() {
+		case tcell.KeyUp:
+			if q, ok := sui.history.prev(sui.inputField.GetText()); ok {
+				sui.inputField.SetText(q)
+			}
+			return nil
+		case tcell.KeyDown:
+			if q, ok := sui.history.next(); ok {
+				sui.inputField.SetText(q)
+			}
+			return nil
+		}
 		return event
 	})
 	sui.inputField.SetChangedFunc(func(text string) {
@@ -181,6 +260,7 @@ func (sui *SearchUI) ipInput(zetDir, editor string) {
 	}).
 		SetDoneFunc(func(key tcell.Key) {
 			if key == tcell.KeyEnter {
+				sui.addHistory(strings.TrimSpace(sui.inputField.GetText()))
 				sui.list.SetSelectable(true, false)
 				sui.app.SetFocus(sui.list)
 			}
@@ -206,12 +286,16 @@ func (sui *SearchUI) loadInitialView(query, zetDir, dbPath string) {
 			return
 		}
 
-		zettels := sui.performSearch(query, mode)
+		zettels, sq, err := sui.performSearch(query, mode)
 		sui.app.QueueUpdateDraw(func() {
 			if sui.inputField.GetText() != query || sui.currentSearchMode() != mode {
 				return
 			}
-			sui.updateList(zettels)
+			if err != nil {
+				sui.displayMessage(searchErrorMessage(err))
+				return
+			}
+			sui.updateList(zettels, sq)
 		})
 		sui.startBackgroundSync(zetDir, dbPath)
 	}()
@@ -239,12 +323,16 @@ func (sui *SearchUI) loadView(query string, userInitiated bool) {
 			return
 		}
 
-		zettels := sui.performSearch(query, mode)
+		zettels, sq, err := sui.performSearch(query, mode)
 		sui.app.QueueUpdateDraw(func() {
 			if sui.inputField.GetText() != query || sui.currentSearchMode() != mode {
 				return
 			}
-			sui.updateList(zettels)
+			if err != nil {
+				sui.displayMessage(searchErrorMessage(err))
+			} else {
+				sui.updateList(zettels, sq)
+			}
 			if userInitiated {
 				sui.setStatusAfterRefresh(syncDoneAtStart)
 			}
@@ -277,6 +365,8 @@ func (sui *SearchUI) toggleSearchMode() {
 	switch sui.currentSearchMode() {
 	case searchModeTitle:
 		sui.setSearchMode(searchModeAll)
+	case searchModeAll:
+		sui.setSearchMode(searchModeFuzzy)
 	default:
 		sui.setSearchMode(searchModeTitle)
 	}
@@ -287,6 +377,8 @@ func (mode searchMode) label() string {
 	switch mode {
 	case searchModeAll:
 		return "All: "
+	case searchModeFuzzy:
+		return "Fuzzy: "
 	default:
 		return "Title: "
 	}
@@ -352,6 +444,54 @@ func shortStatusError(err error) string {
 	return msg
 }
 
+// addHistory adds a query to the search history.
+func (sui *SearchUI) addHistory(q string) {
+	if q == "" {
+		return
+	}
+	sui.history.add(q)
+	if err := sui.storage.AddHistory(q); err != nil {
+		sui.setStatus("history failed: " + shortStatusError(err))
+	}
+}
+
+// displaySavedSearches lists the saved searches in the results list and
+// sets focus to it.
+func (sui *SearchUI) displaySavedSearches() {
+	searches, err := sui.storage.SavedSearches()
+	if err != nil {
+		sui.displayMessage(tview.Escape(err.Error()))
+		return
+	}
+	if len(searches) == 0 {
+		sui.displayMessage(`No saved searches. Save one with "zet search save <name> <query>".`)
+		return
+	}
+	sui.list.Clear()
+	for i := range searches {
+		ss := searches[i]
+		s := `[yellow]` + tview.Escape(ss.Name) + `[white] ` + tview.Escape(ss.Query)
+		sui.list.SetCell(i, 0, tview.NewTableCell(s).SetReference(&ss))
+	}
+	sui.list.ScrollToBeginning()
+	sui.list.SetSelectable(true, false)
+	sui.list.Select(0, 0)
+	sui.app.SetFocus(sui.list)
+}
+
+// runQuery puts q in the input field and searches for it in the given
+// mode.
+func (sui *SearchUI) runQuery(q string, mode searchMode) {
+	sui.list.SetSelectable(false, false)
+	sui.app.SetFocus(sui.inputField)
+	sui.setSearchMode(mode)
+	if sui.inputField.GetText() == q {
+		sui.loadView(q, true)
+		return
+	}
+	sui.inputField.SetText(q)
+}
+
 func (sui *SearchUI) displayMessage(msg string) {
 	sui.list.Clear()
 	sui.list.SetCellSimple(0, 0, msg)
@@ -375,20 +515,37 @@ func (sui *SearchUI) displayAll(zettels []storage.Zettel) {
 	sui.list.ScrollToBeginning()
 }
 
-// performSearch gets result zettels to update the results list.
-func (sui *SearchUI) performSearch(query string, mode searchMode) []storage.ResultZettel {
-	if query == "" {
-		return []storage.ResultZettel{}
+// performSearch gets result zettels to update the results list. If a
+// full text search matches nothing, it also returns a query to suggest
+// instead, if any.
+func (sui *SearchUI) performSearch(query string, mode searchMode) ([]storage.ResultZettel, suggestion, error) {
+	opts := storage.SearchOptions{Before: `[red]`, After: `[white]`}
+	if mode == searchModeFuzzy {
+		zettels, err := sui.storage.FuzzyZettels(query, opts)
+		return zettels, "", err
 	}
-	query = buildSearchQuery(query, mode)
-	if query == "" {
-		return []storage.ResultZettel{}
+	q := buildSearchQuery(query, mode)
+	if q == "" {
+		return []storage.ResultZettel{}, "", nil
 	}
-	zettels, err := sui.storage.SearchZettels(query, `[red]`, `[white]`)
+	zettels, err := sui.storage.SearchZettels(q, opts)
+	if err != nil || len(zettels) > 0 {
+		return zettels, "", err
+	}
+	sq, err := sui.storage.DidYouMean(normalizeInitialSearchText(strings.TrimSpace(query)))
 	if err != nil {
-		zettels = []storage.ResultZettel{storage.ResultZettel{TitleSnippet: "Incorrect syntax"}}
+		return zettels, "", nil
+	}
+	return zettels, suggestion(sq), nil
+}
+
+// searchErrorMessage returns the message to show in place of results
+// when a search fails.
+func searchErrorMessage(err error) string {
+	if errors.Is(err, storage.ErrQuerySyntax) {
+		return tview.Escape(fmt.Sprintf("Invalid search query: %v", err))
 	}
-	return zettels
+	return tview.Escape(fmt.Sprintf("Error searching zettels: %v", err))
 }
 
 func buildSearchQuery(query string, mode searchMode) string {
@@ -419,8 +576,22 @@ func buildSearchQuery(query string, mode searchMode) string {
 	}
 }
 
+// titleSearchQuery limits the terms of a query to titles. Filters, such
+// as `tag:go`, are kept out of the title group. A query that can't be
+// parsed is left as is for the search to report what is wrong with it.
 func titleSearchQuery(query string) string {
-	return fmt.Sprintf("title:(%s)", query)
+	pq, err := storage.ParseQuery(query)
+	if err != nil {
+		return query
+	}
+	if len(pq.Filters) == 0 {
+		return fmt.Sprintf("title:(%s)", query)
+	}
+	terms := pq.Filters
+	if pq.Text != "" {
+		terms = append([]string{fmt.Sprintf("title:(%s)", pq.Text)}, terms...)
+	}
+	return strings.Join(terms, " ")
 }
 
 func normalizeInitialSearchText(query string) string {
@@ -454,11 +625,17 @@ func splitSearchFilter(query string) (searchFilter, string, bool) {
 }
 
 // updateList updates the results list with a given slice of zettels.
-func (sui *SearchUI) updateList(zettels []storage.ResultZettel) {
+// If there are none, the suggested query, if any, is shown instead.
+func (sui *SearchUI) updateList(zettels []storage.ResultZettel, sq suggestion) {
 	list := sui.list
 	list.Clear()
 	if len(zettels) == 0 {
-		list.SetCellSimple(0, 0, "No matches found.")
+		if sq == "" {
+			list.SetCellSimple(0, 0, "No matches found.")
+			return
+		}
+		msg := tview.Escape("No matches found. Did you mean: " + string(sq))
+		list.SetCell(0, 0, tview.NewTableCell(msg).SetReference(sq))
 		return
 	}
 	row := 0
@@ -469,6 +646,12 @@ func (sui *SearchUI) updateList(zettels []storage.ResultZettel) {
 		list.SetCell(row, 0, tview.NewTableCell(s).
 			SetReference(&z))
 		row++
+		// Add matching section
+		if z.Section.Level > 1 {
+			list.SetCell(row, 0, tview.NewTableCell(tview.Escape(sectionLine(z))).
+				SetSelectable(false))
+			row++
+		}
 		// Add body snippet
 		if z.BodySnippet != "" {
 			lines := tview.WordWrap(z.BodySnippet, sui.screenWidth)
@@ -499,7 +682,8 @@ func (sui *SearchUI) updateList(zettels []storage.ResultZettel) {
 // It interprets the following key bindings and triggers corresponding
 // actions:
 //
-//   - l: Open selected zettel.
+//   - l: Open selected zettel, or run the selected suggestion or saved
+//     search.
 //   - H: Move to the top of the visible window.
 //   - M: Move to the center of the visible window.
 //   - L: Move to bottom of the visible window.
@@ -536,6 +720,10 @@ func (sui *SearchUI) listInput(zetDir, editor string) {
 					if err := runCmd(fz, editor, fp); err != nil {
 						fmt.Fprintf(os.Stderr, "Failed to open new zettel: %v", err)
 					}
+				case suggestion:
+					sui.runQuery(string(z), sui.currentSearchMode())
+				case *storage.SavedSearch:
+					sui.runQuery(z.Query, searchModeAll)
 				default:
 					log.Printf("Table cell doesn't reference storage.ResultZettel or storage.Zettel: %T\n", z)
 				}
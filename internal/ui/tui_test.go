@@ -57,6 +57,24 @@ func TestBuildSearchQuery(t *testing.T) {
 			mode:  searchModeTitle,
 			want:  "body: zettel",
 		},
+		{
+			name:  "filters stay out of the title group",
+			query: "zettel tag:go -has:links",
+			mode:  searchModeTitle,
+			want:  "title:(zettel) tag:go -has:links",
+		},
+		{
+			name:  "filters alone are left alone in title mode",
+			query: "created:>2024-01",
+			mode:  searchModeTitle,
+			want:  "created:>2024-01",
+		},
+		{
+			name:  "invalid query is left for the search to report",
+			query: "zettel colour:red",
+			mode:  searchModeTitle,
+			want:  "zettel colour:red",
+		},
 	}
 
 	for _, tt := range tests {
@@ -106,3 +124,60 @@ func TestNormalizeInitialSearchText(t *testing.T) {
 		})
 	}
 }
+
+func TestQueryHistory(t *testing.T) {
+	tests := []struct {
+		name  string
+		added []string // queries added after the history is loaded
+		keys  string   // u for up and d for down
+		want  []string // text after each key, "-" when it is left alone
+	}{
+		{
+			name: "up goes back from the latest query",
+			keys: "uuuu",
+			want: []string{"tag:go", "proxy", "zettel", "-"},
+		},
+		{
+			name: "down comes back to the query being typed",
+			keys: "uudd",
+			want: []string{"tag:go", "proxy", "tag:go", "draft"},
+		},
+		{
+			name: "down without going up does nothing",
+			keys: "d",
+			want: []string{"-"},
+		},
+		{
+			name:  "added query comes first without repeats",
+			added: []string{"zettel"},
+			keys:  "uuuu",
+			want:  []string{"zettel", "tag:go", "proxy", "-"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newQueryHistory([]string{"tag:go", "proxy", "zettel"})
+			for _, q := range tt.added {
+				h.add(q)
+			}
+			text := "draft"
+			for i, k := range tt.keys {
+				var q string
+				var ok bool
+				if k == 'u' {
+					q, ok = h.prev(text)
+				} else {
+					q, ok = h.next()
+				}
+				got := "-"
+				if ok {
+					text, got = q, q
+				}
+				if got != tt.want[i] {
+					t.Fatalf("key %d (%c) = %q, want %q", i, k, got, tt.want[i])
+				}
+			}
+		})
+	}
+}
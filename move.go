@@ -0,0 +1,58 @@
+package zet
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// ValidName reports whether name can be used as a zettel directory
+// name.
+func ValidName(name string) error {
+	switch {
+	case name == "":
+		return errors.New("zettel name is empty")
+	case strings.ContainsAny(name, `/\`):
+		return fmt.Errorf("zettel name %q contains a path separator", name)
+	case strings.HasPrefix(name, "."):
+		return fmt.Errorf("zettel name %q starts with a dot", name)
+	case strings.ContainsAny(name, "[]() \t"):
+		return fmt.Errorf("zettel name %q can't be used in a link", name)
+	}
+	return nil
+}
+
+// Move renames the zettel directory oldName to newName.
+func Move(zetDir, oldName, newName string) error {
+	if err := ValidName(newName); err != nil {
+		return err
+	}
+	src := filepath.Join(zetDir, oldName)
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("Failed to find zettel %s: %v", oldName, err)
+	}
+	dst := filepath.Join(zetDir, newName)
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("zettel %s already exists", newName)
+	}
+	return os.Rename(src, dst)
+}
+
+// RenameLink returns the zettel link content with its label and target
+// changed from oldName to newName. The title is kept as is. Wiki links
+// keep their label.
+func RenameLink(content, oldName, newName string) string {
+	target := strings.NewReplacer(
+		"](../"+oldName+")", "](../"+newName+")",
+		"](../"+oldName+"/)", "](../"+newName+"/)",
+		"](../"+oldName+"#", "](../"+newName+"#",
+		"](../"+oldName+"/#", "](../"+newName+"/#",
+		"[["+oldName+"]]", "[["+newName+"]]",
+		"[["+oldName+"|", "[["+newName+"|",
+		"[["+oldName+"#", "[["+newName+"#",
+	)
+	content = target.Replace(content)
+	return strings.Replace(content, "["+oldName+"]", "["+newName+"]", 1)
+}
@@ -0,0 +1,52 @@
+package zet
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ericstrs/zet/internal/markdown"
+)
+
+// Retitle changes the title of the zettel in directory iso to title.
+func Retitle(zetDir, iso, title string) error {
+	title = strings.TrimSpace(title)
+	if title == "" || strings.Contains(title, "\n") {
+		return errors.New("title must be a single non-empty line")
+	}
+	p := filepath.Join(zetDir, iso, "README.md")
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return fmt.Errorf("Failed to read zettel: %v", err)
+	}
+
+	// Comments in front matter and code blocks look like titles, so the
+	// title line is found by parsing the content.
+	n := 0
+	for _, l := range markdown.Parse(string(b)) {
+		if l.Kind == markdown.Title {
+			n = l.Num
+			break
+		}
+	}
+	if n == 0 {
+		return fmt.Errorf("zettel %s has no title", iso)
+	}
+	lines := strings.Split(string(b), "\n")
+	lines[n-1] = `# ` + title
+	content := strings.Join(lines, "\n")
+
+	info, err := os.Stat(p)
+	if err != nil {
+		return err
+	}
+	return os.WriteFile(p, []byte(content), info.Mode())
+}
+
+// RetitleLink returns the zettel link content with its title replaced
+// by title.
+func RetitleLink(content, oldTitle, title string) string {
+	return strings.TrimSuffix(content, oldTitle) + title
+}
@@ -7,6 +7,7 @@ import (
 	"strconv"
 	"strings"
 
+	"github.com/ericstrs/zet/internal/markdown"
 	"github.com/ericstrs/zet/internal/meta"
 	"github.com/ericstrs/zet/internal/storage"
 )
@@ -44,14 +45,18 @@ func SplitZettel(zetDir, zettelDir, b string) error {
 	return nil
 }
 
-// makeZettels construct sub-zettels from a list of strings.
+// makeZettels construct sub-zettels from a list of strings. Headings
+// inside code blocks are left alone.
 func makeZettels(bodyLines []string) []storage.Zettel {
 	var zettels []storage.Zettel
 	var currZettel storage.Zettel
 	var isInsideZettel bool
 
+	lines := markdown.Parse(strings.Join(bodyLines, "\n"))
 	for i, line := range bodyLines {
-		if strings.HasPrefix(line, `## `) || i == len(bodyLines)-1 {
+		isCode := i < len(lines) && (lines[i].Kind == markdown.Code || lines[i].Kind == markdown.Fence)
+
+		if (!isCode && strings.HasPrefix(line, `## `)) || i == len(bodyLines)-1 {
 			if isInsideZettel {
 				zettels = append(zettels, currZettel)
 				currZettel = storage.Zettel{}
@@ -62,7 +67,7 @@ func makeZettels(bodyLines []string) []storage.Zettel {
 		}
 
 		// Check if the line starts with more than two hash symbols
-		if strings.HasPrefix(line, "###") {
+		if !isCode && strings.HasPrefix(line, "###") {
 			// Remove one hash symbol
 			line = "#" + strings.TrimPrefix(line, "##")
 		}
@@ -5,7 +5,7 @@ import (
 	"strings"
 )
 
-func ExampleMakeZettels() {
+func Example_makeZettels() {
 	content := `## Subtopic 1
 
 Subtopic description.
@@ -32,3 +32,27 @@ Subtopic description.
 	// Body: "\nSubtopic description.\n\n"Zettel '\x03' title: Subtopic 3
 	// Body: "\nSubtopic description.\n"
 }
+
+func Example_makeZettels_code() {
+	content := "## Shell\n" +
+		"\n" +
+		"```markdown\n" +
+		"## Not a subtopic\n" +
+		"### Not demoted\n" +
+		"```\n" +
+		"\n" +
+		"### Demoted\n" +
+		"\n" +
+		"## Go\n" +
+		"\n" +
+		"Go notes.\n"
+
+	zettels := makeZettels(strings.Split(content, "\n"))
+	for _, z := range zettels {
+		fmt.Printf("%s: %q\n", z.Title, z.Body)
+	}
+
+	// Output:
+	// Shell: "\n```markdown\n## Not a subtopic\n### Not demoted\n```\n\n## Demoted\n\n"
+	// Go: "\nGo notes.\n"
+}
@@ -0,0 +1,200 @@
+package zet
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/ericstrs/zet/internal/markdown"
+	"github.com/ericstrs/zet/internal/storage"
+)
+
+var (
+	// tagNameRegex matches a valid tag name, without the leading `#`.
+	tagNameRegex = regexp.MustCompile(`^[a-zA-Z][^\s#]*$`)
+	// metaKeyRegex matches a top level front matter key and its value.
+	metaKeyRegex = regexp.MustCompile(`^([a-zA-Z_][\w-]*)(\s*:\s*)(.*)$`)
+	// metaItemRegex matches an item of a block list in front matter.
+	metaItemRegex = regexp.MustCompile(`^(\s+-\s+)(.*)$`)
+)
+
+// ValidTag reports whether name can be used as a tag name. The name
+// excludes the leading `#`.
+func ValidTag(name string) error {
+	if !tagNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid tag %q: tags start with a letter and contain no spaces or #", name)
+	}
+	return nil
+}
+
+// TagEdit is a change to a single tag line of a zettel file.
+type TagEdit struct {
+	Line int    // line number, starting at one
+	Old  string // tag line before the change
+	New  string // tag line after the change, empty if removed
+}
+
+// RetagContent replaces every tag in content that has an entry in repl
+// with its value. Only tag lines are changed, so code that looks like
+// tags is left alone. An empty value removes the tag, and tags that end up
+// on a line twice are only kept once. Tag lines left without any tags
+// are removed. The tags listed in front matter are changed the same
+// way and the rest of the front matter is left as it is. It returns
+// the new content and the edits made.
+func RetagContent(content string, repl map[string]string) (string, []TagEdit) {
+	lines := strings.Split(content, "\n")
+	front, _, n := storage.SplitFrontMatter(content)
+	out, edits := retagFrontMatter(front, repl)
+	if n > 0 {
+		out = append([]string{lines[0]}, append(out, lines[n-1])...)
+	}
+	kinds := markdown.Parse(content)
+	for i, line := range lines {
+		if i < n {
+			continue
+		}
+		if i >= len(kinds) || kinds[i].Kind != markdown.Tags {
+			out = append(out, line)
+			continue
+		}
+		tagLine := strings.TrimLeft(line, ` `)
+		indent := line[:len(line)-len(tagLine)]
+
+		var fields []string
+		seen := make(map[string]bool)
+		for _, f := range strings.Fields(tagLine) {
+			if strings.HasPrefix(f, `#`) {
+				name := strings.TrimPrefix(f, `#`)
+				if n, ok := repl[name]; ok {
+					name = n
+				}
+				if name == "" || seen[name] {
+					continue
+				}
+				seen[name] = true
+				f = `#` + name
+			}
+			fields = append(fields, f)
+		}
+
+		newLine := strings.Join(fields, ` `)
+		if newLine == tagLine {
+			out = append(out, line)
+			continue
+		}
+		edits = append(edits, TagEdit{Line: i + 1, Old: tagLine, New: newLine})
+		if newLine != "" {
+			out = append(out, indent+newLine)
+		}
+	}
+	return strings.Join(out, "\n"), edits
+}
+
+// retagFrontMatter applies repl to the tags listed under the tags key
+// of the front matter lines returned by storage.SplitFrontMatter. List
+// items left without a tag are removed. It returns the new lines and
+// the edits made, numbered from the opening delimiter.
+func retagFrontMatter(front []string, repl map[string]string) ([]string, []TagEdit) {
+	var out []string
+	var edits []TagEdit
+	inTags := false
+	seen := make(map[string]bool)
+	for i, line := range front {
+		newLine := line
+		if m := metaKeyRegex.FindStringSubmatch(line); m != nil {
+			inTags = strings.ToLower(m[1]) == storage.MetaTags
+			if inTags && m[3] != "" {
+				v := retagMetaValue(m[3], repl, seen)
+				newLine = strings.TrimRight(m[1]+m[2]+v, " ")
+			}
+		} else if m := metaItemRegex.FindStringSubmatch(line); m != nil && inTags {
+			if v := retagMetaValue(m[2], repl, seen); v != "" {
+				newLine = m[1] + v
+			} else {
+				newLine = ""
+			}
+		} else if strings.TrimSpace(line) != "" && !strings.HasPrefix(line, " ") && !strings.HasPrefix(line, "\t") {
+			inTags = false
+		}
+
+		if newLine == line {
+			out = append(out, line)
+			continue
+		}
+		edits = append(edits, TagEdit{Line: i + 2, Old: strings.TrimSpace(line), New: strings.TrimSpace(newLine)})
+		if newLine != "" {
+			out = append(out, newLine)
+		}
+	}
+	return out, edits
+}
+
+// retagMetaValue applies repl to the tags of a front matter value, which
+// is either a flow list such as `[go, cli]` or tags separated by spaces.
+// Tags already in seen are dropped.
+func retagMetaValue(v string, repl map[string]string, seen map[string]bool) string {
+	retag := func(items []string) []string {
+		var out []string
+		for _, item := range items {
+			if t := retagMetaItem(strings.TrimSpace(item), repl, seen); t != "" {
+				out = append(out, t)
+			}
+		}
+		return out
+	}
+	if strings.HasPrefix(v, `[`) {
+		end := strings.LastIndex(v, `]`)
+		if end < 0 {
+			return v
+		}
+		items := strings.Split(v[1:end], `,`)
+		return `[` + strings.Join(retag(items), `, `) + v[end:]
+	}
+	return strings.Join(retag(strings.Fields(v)), ` `)
+}
+
+// retagMetaItem applies repl to a single front matter tag, keeping its
+// quotes and leading `#`. It returns an empty string if the tag is
+// removed or already in seen.
+func retagMetaItem(item string, repl map[string]string, seen map[string]bool) string {
+	if item == "" {
+		return ""
+	}
+	quote := ""
+	if len(item) >= 2 && (item[0] == '"' || item[0] == '\'') && item[len(item)-1] == item[0] {
+		quote = item[:1]
+		item = item[1 : len(item)-1]
+	}
+	hash := ""
+	if strings.HasPrefix(item, `#`) {
+		hash = `#`
+		item = item[1:]
+	}
+	if n, ok := repl[item]; ok {
+		item = n
+	}
+	if item == "" || seen[item] {
+		return ""
+	}
+	seen[item] = true
+	return quote + hash + item + quote
+}
+
+// Retag applies RetagContent to the file at path p. If dryRun is true,
+// the file is left untouched and only the edits are returned.
+func Retag(p string, repl map[string]string, dryRun bool) ([]TagEdit, error) {
+	b, err := os.ReadFile(p)
+	if err != nil {
+		return nil, err
+	}
+	content, edits := RetagContent(string(b), repl)
+	if dryRun || len(edits) == 0 {
+		return edits, nil
+	}
+	info, err := os.Stat(p)
+	if err != nil {
+		return nil, err
+	}
+	return edits, os.WriteFile(p, []byte(content), info.Mode())
+}
@@ -0,0 +1,163 @@
+package zet
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/ericstrs/zet/internal/markdown"
+	"github.com/ericstrs/zet/internal/storage"
+)
+
+// TrashDir is the name of the directory within the zet directory that
+// removed zettels are moved to.
+const TrashDir = `.trash`
+
+// Remove moves the zettel directory iso into the trash.
+func Remove(zetDir, iso string) error {
+	src := filepath.Join(zetDir, iso)
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("Failed to find zettel %s: %v", iso, err)
+	}
+	trash := filepath.Join(zetDir, TrashDir)
+	if err := os.MkdirAll(trash, 0755); err != nil {
+		return fmt.Errorf("Failed to create trash directory: %v", err)
+	}
+	dst := filepath.Join(trash, iso)
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("zettel %s is already in the trash", iso)
+	}
+	return os.Rename(src, dst)
+}
+
+// Restore moves the zettel directory iso out of the trash and back into
+// the zet directory.
+func Restore(zetDir, iso string) error {
+	src := filepath.Join(zetDir, TrashDir, iso)
+	if _, err := os.Stat(src); err != nil {
+		return fmt.Errorf("Failed to find zettel %s in trash: %v", iso, err)
+	}
+	dst := filepath.Join(zetDir, iso)
+	if _, err := os.Stat(dst); err == nil {
+		return fmt.Errorf("zettel %s already exists", iso)
+	}
+	return os.Rename(src, dst)
+}
+
+// Trashed returns the names of the zettel directories in the trash.
+func Trashed(zetDir string) ([]string, error) {
+	entries, err := os.ReadDir(filepath.Join(zetDir, TrashDir))
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("Failed to read trash directory: %v", err)
+	}
+	var isos []string
+	for _, e := range entries {
+		if e.IsDir() {
+			isos = append(isos, e.Name())
+		}
+	}
+	sort.Strings(isos)
+	return isos, nil
+}
+
+// StrikeLink returns the struck out text of a zettel link. The link
+// markup is dropped so the result is no longer a link. Wiki and inline
+// links are replaced by their label.
+func StrikeLink(content string) string {
+	if m := linkRegex.FindStringSubmatch(content); m != nil {
+		content = m[2] + " " + m[4]
+	} else if lines := markdown.Parse(content); len(lines) > 0 && len(lines[0].Refs) > 0 {
+		r := lines[0].Refs[0]
+		content = r.Label
+		if content == "" {
+			content = r.ISO
+		}
+	}
+	return "~~" + content + "~~"
+}
+
+// RewriteLinks replaces every link that matches the content of one of
+// the backlinks with the result of repl, in the files the backlinks
+// live in. Files are parsed to find the links, so a link written more
+// than once is rewritten each time and links inside code are left
+// alone. If a file can't be written, the files already written are
+// restored. It returns the directory names of the zettels that were
+// changed.
+func RewriteLinks(zetDir string, links []storage.Backlink, repl func(storage.Backlink) string) ([]string, error) {
+	byFile := make(map[string]map[string]storage.Backlink)
+	var files []string
+	for _, l := range links {
+		p := filepath.Join(l.FromDir, l.FromName)
+		if _, ok := byFile[p]; !ok {
+			files = append(files, p)
+			byFile[p] = make(map[string]storage.Backlink)
+		}
+		byFile[p][l.Content] = l
+	}
+
+	type rewrite struct {
+		path, dir string
+		old, new  []byte
+		mode      os.FileMode
+	}
+	var rewrites []rewrite
+	for _, f := range files {
+		p := filepath.Join(zetDir, f)
+		b, err := os.ReadFile(p)
+		if err != nil {
+			return nil, fmt.Errorf("Failed to read %s: %v", f, err)
+		}
+		info, err := os.Stat(p)
+		if err != nil {
+			return nil, err
+		}
+		lines := strings.Split(string(b), "\n")
+		var dir string
+		for _, line := range markdown.Parse(string(b)) {
+			// Replace from the right so the columns of the links to the
+			// left still hold.
+			for i := len(line.Refs) - 1; i >= 0; i-- {
+				r := line.Refs[i]
+				l, ok := byFile[f][r.Content]
+				if !ok {
+					continue
+				}
+				t := lines[line.Num-1]
+				start := r.Col - 1
+				if !strings.HasPrefix(t[start:], r.Content) {
+					continue
+				}
+				lines[line.Num-1] = t[:start] + repl(l) + t[start+len(r.Content):]
+				dir = l.FromDir
+			}
+		}
+		nb := []byte(strings.Join(lines, "\n"))
+		if bytes.Equal(b, nb) {
+			continue
+		}
+		rewrites = append(rewrites, rewrite{path: p, dir: dir, old: b, new: nb, mode: info.Mode()})
+	}
+
+	var dirs []string
+	seen := make(map[string]bool)
+	for i, r := range rewrites {
+		if err := os.WriteFile(r.path, r.new, r.mode); err != nil {
+			for _, w := range rewrites[:i+1] {
+				os.WriteFile(w.path, w.old, w.mode)
+			}
+			return nil, fmt.Errorf("Failed to write %s: %v", r.path, err)
+		}
+		if !seen[r.dir] {
+			seen[r.dir] = true
+			dirs = append(dirs, r.dir)
+		}
+	}
+	return dirs, nil
+}
@@ -0,0 +1,180 @@
+package zet
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/ericstrs/zet/internal/storage"
+	"github.com/fsnotify/fsnotify"
+)
+
+// watchDebounce is how long the watcher waits for a burst of file
+// system events to settle before syncing the affected zettels.
+const watchDebounce = 200 * time.Millisecond
+
+// Watch keeps the database in sync with the zet directory until
+// interrupted. It performs a full sync on startup and then applies
+// incremental updates for each zettel directory that changes. While
+// running, it maintains a heartbeat so other commands can skip their
+// own rescan of the zet directory.
+func Watch(zetDir, dbPath string) error {
+	s, err := storage.OpenDB(dbPath)
+	if err != nil {
+		return err
+	}
+	defer s.Close()
+
+	w, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("Failed to create watcher: %v", err)
+	}
+	defer w.Close()
+
+	if err := w.Add(zetDir); err != nil {
+		return fmt.Errorf("Failed to watch %s: %v", zetDir, err)
+	}
+	dirs, err := os.ReadDir(zetDir)
+	if err != nil {
+		return fmt.Errorf("Error reading root directory: %v", err)
+	}
+	// Known holds the zettel directories being watched.
+	known := make(map[string]bool)
+	for _, d := range dirs {
+		if !isZettelDir(d.Name(), d.IsDir()) {
+			continue
+		}
+		if err := w.Add(filepath.Join(zetDir, d.Name())); err != nil {
+			log.Printf("Failed to watch %s: %v\n", d.Name(), err)
+		}
+		known[d.Name()] = true
+	}
+
+	// The watches are in place before the full sync so changes made
+	// while it runs are picked up. The sync ignores any heartbeat, since
+	// it may have been left behind by a watcher that crashed.
+	if err := s.Sync(zetDir); err != nil {
+		return fmt.Errorf("Error syncing database and flat files: %v", err)
+	}
+	if err := storage.Heartbeat(dbPath); err != nil {
+		return fmt.Errorf("Failed to write heartbeat: %v", err)
+	}
+	defer storage.ClearHeartbeat(dbPath)
+
+	sig := make(chan os.Signal, 1)
+	signal.Notify(sig, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(sig)
+
+	heartbeat := time.NewTicker(storage.HeartbeatInterval)
+	defer heartbeat.Stop()
+
+	// Pending holds the zettel directories with unsynced changes.
+	pending := make(map[string]bool)
+	flush := time.NewTimer(watchDebounce)
+	flush.Stop()
+
+	for {
+		select {
+		case <-sig:
+			return nil
+		case <-heartbeat.C:
+			if err := storage.Heartbeat(dbPath); err != nil {
+				log.Printf("Failed to write heartbeat: %v\n", err)
+			}
+		case err, ok := <-w.Errors:
+			if !ok {
+				return nil
+			}
+			log.Printf("Watcher error: %v\n", err)
+		case e, ok := <-w.Events:
+			if !ok {
+				return nil
+			}
+			d := eventDir(zetDir, e.Name, known)
+			if d == "" {
+				continue
+			}
+			// A new zettel directory needs its own watch to catch the files
+			// created inside of it.
+			if e.Name == filepath.Join(zetDir, d) && e.Has(fsnotify.Create) {
+				if err := w.Add(e.Name); err != nil {
+					log.Printf("Failed to watch %s: %v\n", d, err)
+				}
+				known[d] = true
+			}
+			pending[d] = true
+			flush.Reset(watchDebounce)
+		case <-flush.C:
+			synced := make(map[string]bool, len(pending))
+			for d := range pending {
+				if err := s.SyncZettel(zetDir, d); err != nil {
+					log.Printf("Failed to sync zettel %s: %v\n", d, err)
+				}
+				synced[d] = true
+				delete(pending, d)
+			}
+			reportMissingAnchors(s, synced)
+		}
+	}
+}
+
+// reportMissingAnchors logs the links from the given zettel
+// directories that point to a section that doesn't exist.
+func reportMissingAnchors(s *storage.Storage, dirs map[string]bool) {
+	links, err := s.MissingAnchors()
+	if err != nil {
+		log.Printf("Failed to check anchors: %v\n", err)
+		return
+	}
+	for _, l := range links {
+		if dirs[l.FromDir] {
+			log.Printf("Missing anchor: %s:%d: %s#%s\n", filepath.Join(l.FromDir, l.FromName), l.Line, l.ToDir, l.Anchor)
+		}
+	}
+}
+
+// eventDir returns the zettel directory name a file system event at
+// path p belongs to. An empty string is returned if the event is
+// outside of a zettel directory. Known holds the zettel directories
+// that are being watched.
+func eventDir(zetDir, p string, known map[string]bool) string {
+	rel, err := filepath.Rel(zetDir, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return ""
+	}
+	parts := strings.Split(rel, string(filepath.Separator))
+	d := parts[0]
+
+	// Events for the zettel directory itself can be a create, rename or
+	// removal. In the case of a removal, there is nothing left to stat,
+	// so fall back on whether it was being watched.
+	if len(parts) == 1 {
+		info, err := os.Stat(p)
+		if err != nil {
+			if !known[d] {
+				return ""
+			}
+			delete(known, d)
+			return d
+		}
+		if !isZettelDir(d, info.IsDir()) {
+			return ""
+		}
+		return d
+	}
+	if !isZettelDir(d, true) || !strings.HasSuffix(p, ".md") {
+		return ""
+	}
+	return d
+}
+
+// isZettelDir reports whether an entry in the zet directory may hold a
+// zettel.
+func isZettelDir(name string, isDir bool) bool {
+	return isDir && !strings.HasPrefix(name, ".")
+}
@@ -0,0 +1,160 @@
+package zet
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/ericstrs/zet/internal/storage"
+)
+
+func ExampleStrikeLink() {
+	fmt.Println(StrikeLink(`[20231028013010](../20231028013010) Context for conceptual linking`))
+	fmt.Println(StrikeLink(`[[20231028013010|context]]`))
+	fmt.Println(StrikeLink(`[[20231028013010]]`))
+	fmt.Println(StrikeLink(`[context](../20231028013010)`))
+	// Output:
+	// ~~20231028013010 Context for conceptual linking~~
+	// ~~context~~
+	// ~~20231028013010~~
+	// ~~context~~
+}
+
+func ExampleRemove() {
+	zetDir, err := os.MkdirTemp("", "zet")
+	if err != nil {
+		fmt.Printf("Failed to create temporary directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	if err := os.Mkdir(filepath.Join(zetDir, "20231028013010"), 0755); err != nil {
+		fmt.Printf("Failed to create zettel: %v\n", err)
+		return
+	}
+
+	if err := Remove(zetDir, "20231028013010"); err != nil {
+		fmt.Printf("Failed to remove zettel: %v\n", err)
+		return
+	}
+	isos, _ := Trashed(zetDir)
+	fmt.Println("trash:", isos)
+
+	if err := Restore(zetDir, "20231028013010"); err != nil {
+		fmt.Printf("Failed to restore zettel: %v\n", err)
+		return
+	}
+	isos, _ = Trashed(zetDir)
+	_, err = os.Stat(filepath.Join(zetDir, "20231028013010"))
+	fmt.Println("trash:", isos, "restored:", err == nil)
+
+	// Output:
+	// trash: [20231028013010]
+	// trash: [] restored: true
+}
+
+func ExampleRewriteLinks() {
+	zetDir, err := os.MkdirTemp("", "zet")
+	if err != nil {
+		fmt.Printf("Failed to create temporary directory: %v\n", err)
+		return
+	}
+	defer os.RemoveAll(zetDir)
+	content := "# Source\n\nSee [[20231028013010]] and [[20231028013010|it]].\n\n```\n[[20231028013010]]\n```\n\nAgain [[20231028013010]].\n"
+	if err := os.Mkdir(filepath.Join(zetDir, "20231028012959"), 0755); err != nil {
+		fmt.Printf("Failed to create zettel: %v\n", err)
+		return
+	}
+	if err := os.WriteFile(filepath.Join(zetDir, "20231028012959", "README.md"), []byte(content), 0644); err != nil {
+		fmt.Printf("Failed to write zettel: %v\n", err)
+		return
+	}
+
+	links := []storage.Backlink{
+		{Link: storage.Link{Content: "[[20231028013010]]", Line: 3}, FromDir: "20231028012959", FromName: "README.md"},
+		{Link: storage.Link{Content: "[[20231028013010|it]]", Line: 3}, FromDir: "20231028012959", FromName: "README.md"},
+	}
+	dirs, err := RewriteLinks(zetDir, links, func(l storage.Backlink) string {
+		return RenameLink(l.Content, "20231028013010", "context")
+	})
+	if err != nil {
+		fmt.Printf("Failed to rewrite links: %v\n", err)
+		return
+	}
+	b, _ := os.ReadFile(filepath.Join(zetDir, "20231028012959", "README.md"))
+	fmt.Println(dirs)
+	fmt.Print(string(b))
+
+	// Output:
+	// [20231028012959]
+	// # Source
+	//
+	// See [[context]] and [[context|it]].
+	//
+	// ```
+	// [[20231028013010]]
+	// ```
+	//
+	// Again [[context]].
+}
+
+func ExampleRenameLink() {
+	fmt.Println(RenameLink(`[20231028013010](../20231028013010) Context`, "20231028013010", "context"))
+	fmt.Println(RenameLink(`[20231028013010](../20231028013010/) Context`, "20231028013010", "context"))
+	fmt.Println(RenameLink(`[[20231028013010]]`, "20231028013010", "context"))
+	fmt.Println(RenameLink(`[[20231028013010|label]]`, "20231028013010", "context"))
+	fmt.Println(RenameLink(`[label](../20231028013010)`, "20231028013010", "context"))
+	// Output:
+	// [context](../context) Context
+	// [context](../context/) Context
+	// [[context]]
+	// [[context|label]]
+	// [label](../context)
+}
+
+func ExampleRetitleLink() {
+	fmt.Println(RetitleLink(`[20231028013010](../20231028013010) Old title`, "Old title", "New title"))
+	// Output:
+	// [20231028013010](../20231028013010) New title
+}
+
+func ExampleRetagContent() {
+	content := "# Title\n\nBody.\n\n    #golang #go #cli\n    #golang\n"
+	repl := map[string]string{"golang": "go", "cli": ""}
+	out, edits := RetagContent(content, repl)
+	for _, e := range edits {
+		fmt.Printf("%d: %q -> %q\n", e.Line, e.Old, e.New)
+	}
+	fmt.Print(out)
+	// Output:
+	// 5: "#golang #go #cli" -> "#go"
+	// 6: "#golang" -> "#go"
+	// # Title
+	//
+	// Body.
+	//
+	//     #go
+	//     #go
+}
+
+func ExampleRetagContent_frontMatter() {
+	content := "---\n# tags: golang\ntags: [golang, cli]\nkeywords:\n  - golang\nlabels:\naliases: [Golang]\n---\n# Title\n\n    #golang\n"
+	out, edits := RetagContent(content, map[string]string{"golang": "go"})
+	for _, e := range edits {
+		fmt.Printf("%d: %q -> %q\n", e.Line, e.Old, e.New)
+	}
+	fmt.Print(out)
+	// Output:
+	// 3: "tags: [golang, cli]" -> "tags: [go, cli]"
+	// 11: "#golang" -> "#go"
+	// ---
+	// # tags: golang
+	// tags: [go, cli]
+	// keywords:
+	//   - golang
+	// labels:
+	// aliases: [Golang]
+	// ---
+	// # Title
+	//
+	//     #go
+}